@@ -0,0 +1,644 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"smart-cat/internal/config"
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+)
+
+// cliFlags 子命令共用参数
+type cliFlags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	json       *bool
+}
+
+// newCLIFlags 创建子命令参数集：配置项参数加 --json
+func newCLIFlags(name string) *cliFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return &cliFlags{
+		fs:         fs,
+		configPath: config.RegisterFlags(fs),
+		json:       fs.Bool("json", false, "以 JSON 输出"),
+	}
+}
+
+// signalContext 返回 Ctrl+C 时取消的 context，中断正在执行的 smartctl
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// runScan scan 子命令：列出设备
+func runScan(args []string) error {
+	f := newCLIFlags("scan")
+	if _, err := parseArgs(f.fs, args); err != nil {
+		return err
+	}
+
+	a, err := newApp(f.fs, *f.configPath)
+	if err != nil {
+		return err
+	}
+	if err := a.detector.CheckSmartctlInstalled(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	devices, err := a.deviceService.GetAllDevices(ctx, false)
+	if err != nil {
+		return err
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+
+	if *f.json {
+		return writeJSON(os.Stdout, devices)
+	}
+
+	tw := newTable(os.Stdout, "DEVICE", "ID", "MODEL", "SERIAL", "TYPE", "CAPACITY", "EXTERNAL", "HISTORY", "ERROR")
+	for _, d := range devices {
+		tw.row(d.Name, d.ID, d.Model, d.Serial, d.DeviceType, formatCapacity(d.CapacityGB), yesNo(d.IsExternal), yesNo(d.HasHistory), d.ErrorMessage)
+	}
+	return tw.flush()
+}
+
+// runShow show 子命令：读取实时 SMART 数据
+func runShow(args []string) error {
+	f := newCLIFlags("show")
+	positional, err := parseArgs(f.fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: smart-cat show <device> [--json]")
+	}
+
+	a, err := newApp(f.fs, *f.configPath)
+	if err != nil {
+		return err
+	}
+	if err := a.detector.CheckSmartctlInstalled(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+	ctx, cancelTimeout := context.WithTimeout(ctx, a.cfg.Collector.DeviceTimeout)
+	defer cancelTimeout()
+
+	data, err := a.deviceService.GetSMARTData(ctx, devicePath(positional[0]))
+	if err != nil {
+		return err
+	}
+	data.Timestamp = time.Now()
+
+	if *f.json {
+		return writeJSON(os.Stdout, data)
+	}
+	return printSMARTData(os.Stdout, data)
+}
+
+// runHistory history 子命令：查看单个设备的历史数据
+func runHistory(args []string) error {
+	f := newCLIFlags("history")
+	fromStr := f.fs.String("from", "", "起始时间：RFC3339、2006-01-02 或相对时长（如 72h、30d）；默认为 history-window")
+	toStr := f.fs.String("to", "", "结束时间，格式同 --from；默认为现在")
+	positional, err := parseArgs(f.fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: smart-cat history <id|serial> [--from] [--to] [--json]")
+	}
+
+	from, to, err := parseRange(*fromStr, *toStr, time.Now())
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(f.fs, *f.configPath)
+	if err != nil {
+		return err
+	}
+
+	records, err := a.deviceService.GetHistory(positional[0], from, to)
+	if err != nil {
+		return err
+	}
+
+	if *f.json {
+		return writeJSON(os.Stdout, records)
+	}
+
+	tw := newTable(os.Stdout, historyColumns...)
+	for _, rec := range records {
+		tw.row(historyRow(rec)...)
+	}
+	return tw.flush()
+}
+
+// runExport export 子命令：导出多个设备的历史数据
+func runExport(args []string) error {
+	f := newCLIFlags("export")
+	fromStr := f.fs.String("from", "", "起始时间，格式同 history --from；默认导出全部历史")
+	toStr := f.fs.String("to", "", "结束时间，格式同 history --to")
+	serials := f.fs.String("serial", "", "只导出这些设备（设备标识或序列号），逗号分隔；默认全部")
+	asCSV := f.fs.Bool("csv", false, "以 CSV 输出（每行带 serial 列）")
+	output := f.fs.String("o", "", "输出文件，默认标准输出")
+	if _, err := parseArgs(f.fs, args); err != nil {
+		return err
+	}
+	if *f.json && *asCSV {
+		return fmt.Errorf("--json and --csv are mutually exclusive")
+	}
+
+	from, to, err := parseRange(*fromStr, *toStr, time.Now())
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(f.fs, *f.configPath)
+	if err != nil {
+		return err
+	}
+
+	var list []string
+	if *serials != "" {
+		for _, serial := range strings.Split(*serials, ",") {
+			if serial = strings.TrimSpace(serial); serial != "" {
+				list = append(list, serial)
+			}
+		}
+	} else if list, err = a.store.GetAllSerials(); err != nil {
+		return err
+	}
+	sort.Strings(list)
+
+	history := make(map[string][]smart.HistoryRecord, len(list))
+	for _, serial := range list {
+		records, err := a.deviceService.ExportHistory(serial, from, to)
+		if err != nil {
+			return fmt.Errorf("history %s: %w", serial, err)
+		}
+		history[serial] = records
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("create output: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch {
+	case *f.json:
+		return writeJSON(w, history)
+	case *asCSV:
+		writer := csv.NewWriter(w)
+		header := []string{"serial"}
+		for _, column := range historyColumns {
+			header = append(header, strings.ToLower(column))
+		}
+		writer.Write(header)
+		for _, serial := range list {
+			for _, rec := range history[serial] {
+				writer.Write(append([]string{serial}, historyRow(rec)...))
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		tw := newTable(w, append([]string{"SERIAL"}, historyColumns...)...)
+		for _, serial := range list {
+			for _, rec := range history[serial] {
+				tw.row(append([]string{serial}, historyRow(rec)...)...)
+			}
+		}
+		return tw.flush()
+	}
+}
+
+// runMigrate migrate 子命令：把数据目录（以及汇聚端 hosts/ 下每台主机的目录）中的 CSV 历史导入 SQLite
+func runMigrate(args []string) error {
+	f := newCLIFlags("migrate")
+	if _, err := parseArgs(f.fs, args); err != nil {
+		return err
+	}
+	cfg, err := config.FromFlags(f.fs, *f.configPath)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := dataDirs(cfg.Collector.DataDir)
+	if err != nil {
+		return err
+	}
+
+	results := make(map[string]storage.ImportStats, len(dirs))
+	for _, dir := range dirs {
+		stats, err := migrateDir(dir)
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", dir, err)
+		}
+		results[dir] = stats
+	}
+
+	if *f.json {
+		return writeJSON(os.Stdout, results)
+	}
+	tw := newTable(os.Stdout, "DIR", "DEVICES", "RECORDS", "AGGREGATES", "ATTRIBUTES", "POWER STATES")
+	for _, dir := range dirs {
+		s := results[dir]
+		tw.row(filepath.Join(dir, storage.SQLiteFile), strconv.Itoa(s.Devices), strconv.Itoa(s.Records),
+			strconv.Itoa(s.Aggregates), strconv.Itoa(s.Attributes), strconv.Itoa(s.PowerStates))
+	}
+	if err := tw.flush(); err != nil {
+		return err
+	}
+	if cfg.Storage.Backend != config.BackendSQLite {
+		fmt.Println("\nSet storage.backend: sqlite (or -storage-backend sqlite) to use the imported data.")
+	}
+	return nil
+}
+
+// migrateDir 把一个目录中的 CSV 历史导入同目录下的 smartcat.db
+func migrateDir(dir string) (storage.ImportStats, error) {
+	src, err := storage.NewCSVStorage(dir)
+	if err != nil {
+		return storage.ImportStats{}, err
+	}
+	dst, err := storage.NewSQLiteStorage(filepath.Join(dir, storage.SQLiteFile))
+	if err != nil {
+		return storage.ImportStats{}, err
+	}
+	defer dst.Close()
+	return dst.ImportCSV(src)
+}
+
+// dataDirs 数据目录和聚合模式下各 agent 的子目录（hosts/*）
+func dataDirs(dataDir string) ([]string, error) {
+	dirs := []string{dataDir}
+	hosts, err := os.ReadDir(filepath.Join(dataDir, "hosts"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read hosts dir: %w", err)
+	}
+	for _, entry := range hosts {
+		if entry.IsDir() {
+			dirs = append(dirs, filepath.Join(dataDir, "hosts", entry.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+func runStorage(args []string) error {
+	f := newCLIFlags("storage")
+	positional, err := parseArgs(f.fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || (positional[0] != "verify" && positional[0] != "repair") {
+		return fmt.Errorf("usage: smart-cat storage verify|repair [--json]")
+	}
+	repair := positional[0] == "repair"
+
+	cfg, err := config.FromFlags(f.fs, *f.configPath)
+	if err != nil {
+		return err
+	}
+	dirs, err := dataDirs(cfg.Collector.DataDir)
+	if err != nil {
+		return err
+	}
+
+	var reports []storage.FileReport
+	for _, dir := range dirs {
+		store, err := storage.NewCSVStorage(dir)
+		if err != nil {
+			return err
+		}
+		check := store.Verify
+		if repair {
+			check = store.Repair
+		}
+		r, err := check()
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", positional[0], dir, err)
+		}
+		reports = append(reports, r...)
+	}
+
+	damaged := 0
+	for _, r := range reports {
+		if r.Damaged() && !r.Repaired {
+			damaged++
+		}
+	}
+
+	if *f.json {
+		if err := writeJSON(os.Stdout, reports); err != nil {
+			return err
+		}
+	} else {
+		tw := newTable(os.Stdout, "FILE", "KIND", "ROWS", "PROBLEMS", "STATUS")
+		for _, r := range reports {
+			status := "ok"
+			switch {
+			case r.Repaired:
+				status = "repaired"
+			case r.Damaged():
+				status = "damaged"
+			}
+			tw.row(r.Path, r.Kind, strconv.Itoa(r.Rows), fileProblems(r), status)
+		}
+		if err := tw.flush(); err != nil {
+			return err
+		}
+	}
+
+	if damaged > 0 {
+		return fmt.Errorf("%d damaged file(s), run 'smart-cat storage repair' with the service stopped", damaged)
+	}
+	return nil
+}
+
+// fileProblems 文件问题的简短描述
+func fileProblems(r storage.FileReport) string {
+	var problems []string
+	if r.Leftover {
+		problems = append(problems, "leftover temp file")
+	}
+	if r.BadHeader {
+		problems = append(problems, "bad header")
+	}
+	if r.Partial {
+		problems = append(problems, "partial last line")
+	}
+	if r.Malformed > 0 {
+		problems = append(problems, fmt.Sprintf("%d malformed row(s)", r.Malformed))
+	}
+	return strings.Join(problems, ", ")
+}
+
+// devicePath 补全设备路径：Linux/macOS 上 sda → /dev/sda
+func devicePath(name string) string {
+	if runtime.GOOS != "windows" && !strings.HasPrefix(name, "/") {
+		return "/dev/" + name
+	}
+	return name
+}
+
+// parseRange 解析 --from / --to
+func parseRange(fromStr, toStr string, now time.Time) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if fromStr != "" {
+		if from, err = parseTime(fromStr, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("--from: %w", err)
+		}
+	}
+	if toStr != "" {
+		if to, err = parseTime(toStr, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("--to: %w", err)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--to is before --from")
+	}
+	return from, to, nil
+}
+
+// parseTime 解析时间：RFC3339、本地日期 2006-01-02、本地时间 2006-01-02 15:04，
+// 或相对于现在的时长（72h、30d）
+func parseTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
+}
+
+// historyColumns 历史数据表格列
+var historyColumns = []string{"TIMESTAMP", "RESOLUTION", "SAMPLES", "TEMP", "HEALTH", "POWER_ON_HOURS", "POWER_CYCLES", "REALLOCATED", "PENDING", "UNCORRECTABLE"}
+
+// historyRow 历史记录的表格行
+func historyRow(rec smart.HistoryRecord) []string {
+	samples := rec.Samples
+	if samples == 0 {
+		samples = 1
+	}
+	return []string{
+		rec.Timestamp.Format(time.RFC3339),
+		rec.Resolution,
+		strconv.Itoa(samples),
+		strconv.Itoa(rec.Temperature),
+		strconv.Itoa(rec.HealthPercent),
+		strconv.FormatInt(rec.PowerOnHours, 10),
+		strconv.FormatInt(rec.PowerCycleCount, 10),
+		strconv.FormatInt(rec.ReallocatedSectors, 10),
+		strconv.FormatInt(rec.PendingSectors, 10),
+		strconv.FormatInt(rec.UncorrectableErrors, 10),
+	}
+}
+
+// formatTemperature 输出温度和按设备类别判定的状态，如 "48°C (warm, hdd: warm 45°C, critical 55°C)"
+func formatTemperature(data *smart.SMARTData) string {
+	s := fmt.Sprintf("%d°C", data.Temperature)
+	t := data.Thermal
+	if t == nil || t.State == "" || t.Limits == nil {
+		return s
+	}
+	return fmt.Sprintf("%s (%s, %s: warm %d°C, critical %d°C)", s, t.State, t.Class, t.Limits.Warm, t.Limits.Critical)
+}
+
+// formatHealth 输出健康度、等级和使用的模型，如 "71% (warning, backblaze)"
+func formatHealth(data *smart.SMARTData) string {
+	s := fmt.Sprintf("%d%%", data.HealthPercent)
+	if h := data.Health; h != nil {
+		s += fmt.Sprintf(" (%s, %s)", h.Severity, h.Model)
+	}
+	return s
+}
+
+// printSMARTData 以可读格式输出 SMART 快照
+func printSMARTData(w io.Writer, data *smart.SMARTData) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fields := [][2]string{
+		{"Device", data.Device.Name},
+		{"ID", data.Device.ID},
+		{"Model", data.Device.Model},
+		{"Serial", data.Device.Serial},
+		{"WWN", data.Device.WWN},
+		{"Type", data.Device.DeviceType},
+		{"Capacity", formatCapacity(data.Device.CapacityGB)},
+		{"External", yesNo(data.Device.IsExternal)},
+		{"Bridge", data.Device.BridgeType},
+		{"SMART status", data.SmartStatus},
+		{"Health", formatHealth(data)},
+		{"Temperature", formatTemperature(data)},
+		{"Power-on hours", strconv.FormatInt(data.PowerOnHours, 10)},
+		{"Power cycles", strconv.FormatInt(data.PowerCycleCount, 10)},
+		{"Reallocated sectors", strconv.FormatInt(data.ReallocatedSectors, 10)},
+		{"Pending sectors", strconv.FormatInt(data.PendingSectors, 10)},
+		{"Uncorrectable errors", strconv.FormatInt(data.UncorrectableErrors, 10)},
+	}
+	if h := data.Health; h != nil {
+		for _, f := range h.Factors {
+			fields = append(fields, [2]string{"Health factor", fmt.Sprintf("%s (-%d, %s)", f.Description, f.Impact, f.Severity)})
+		}
+	}
+	if t := data.Thermal; t != nil && t.LifetimeMax != nil {
+		min := "-"
+		if t.LifetimeMin != nil {
+			min = fmt.Sprintf("%d°C", *t.LifetimeMin)
+		}
+		fields = append(fields, [2]string{"Lifetime temperature", fmt.Sprintf("%s / %d°C", min, *t.LifetimeMax)})
+	}
+	if r := data.Trend; r != nil && r.DaysRemaining != nil {
+		fields = append(fields, [2]string{"Days remaining", fmt.Sprintf("%.1f (%s, confidence %.2f)", *r.DaysRemaining, r.Limiting, r.Confidence)})
+	}
+	if h := data.NVMe; h != nil {
+		fields = append(fields,
+			[2]string{"NVMe critical warning", formatNVMeWarning(h)},
+			[2]string{"NVMe available spare", fmt.Sprintf("%d%% (threshold %d%%)", h.AvailableSpare, h.AvailableSpareThreshold)},
+			[2]string{"NVMe percentage used", fmt.Sprintf("%d%%", h.PercentageUsed)},
+			[2]string{"NVMe data read", formatBytes(h.BytesRead())},
+			[2]string{"NVMe data written", formatBytes(h.BytesWritten())},
+			[2]string{"NVMe unsafe shutdowns", strconv.FormatInt(h.UnsafeShutdowns, 10)},
+			[2]string{"NVMe media errors", strconv.FormatInt(h.MediaErrors, 10)},
+		)
+	}
+	for _, f := range fields {
+		fmt.Fprintf(tw, "%s:\t%s\n", f[0], f[1])
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(data.Attributes) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	table := newTable(w, "ID", "ATTRIBUTE", "VALUE", "WORST", "THRESH", "RAW", "FAILED")
+	for _, attr := range data.Attributes {
+		table.row(
+			strconv.Itoa(attr.ID),
+			attr.Name,
+			strconv.Itoa(attr.Value),
+			strconv.Itoa(attr.Worst),
+			strconv.Itoa(attr.Threshold),
+			strconv.FormatInt(attr.RawValue, 10),
+			attr.WhenFailed,
+		)
+	}
+	return table.flush()
+}
+
+// formatNVMeWarning 关键警告位图及其含义
+func formatNVMeWarning(h *smart.NVMeHealth) string {
+	if h.CriticalWarning == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("0x%02x (%s)", h.CriticalWarning, strings.Join(h.Warnings(), ", "))
+}
+
+// formatCapacity 格式化容量
+func formatCapacity(gb int64) string {
+	if gb <= 0 {
+		return "-"
+	}
+	if gb >= 1000 {
+		return fmt.Sprintf("%.1f TB", float64(gb)/1000)
+	}
+	return fmt.Sprintf("%d GB", gb)
+}
+
+// formatBytes 以十进制单位格式化字节数
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	v := float64(n)
+	i := 0
+	for v >= 1000 && i < len(units)-1 {
+		v /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.2f %s", v, units[i])
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// writeJSON 输出带缩进的 JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table 对齐的文本表格
+type table struct {
+	tw *tabwriter.Writer
+}
+
+func newTable(w io.Writer, columns ...string) *table {
+	t := &table{tw: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+	t.row(columns...)
+	return t
+}
+
+func (t *table) row(cells ...string) {
+	for i, cell := range cells {
+		if cell == "" {
+			cell = "-"
+		}
+		if i > 0 {
+			t.tw.Write([]byte{'\t'})
+		}
+		t.tw.Write([]byte(cell))
+	}
+	t.tw.Write([]byte{'\n'})
+}
+
+func (t *table) flush() error {
+	return t.tw.Flush()
+}
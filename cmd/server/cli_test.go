@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+)
+
+func TestExportWithoutFromIncludesFullHistory(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewCSVStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	// 早于默认的历史查询窗口（7 天）的记录也要导出
+	old := now.Add(-10 * 24 * time.Hour)
+	for _, ts := range []time.Time{old, now.Add(-time.Hour)} {
+		if err := store.SaveRecord("AAA", &smart.SMARTData{Timestamp: ts, Temperature: 35, HealthPercent: 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "export.json")
+	if err := runExport([]string{"-data-dir", dir, "-history-window", "168h", "--json", "-o", out}); err != nil {
+		t.Fatalf("runExport: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history map[string][]smart.HistoryRecord
+	if err := json.Unmarshal(data, &history); err != nil {
+		t.Fatalf("parse export: %v", err)
+	}
+	records := history["AAA"]
+	if len(records) != 2 {
+		t.Fatalf("exported %d records, want 2: %+v", len(records), records)
+	}
+	if !records[0].Timestamp.Equal(old) {
+		t.Errorf("first record at %v, want %v", records[0].Timestamp, old)
+	}
+}
@@ -1,88 +1,200 @@
 package main
 
 import (
-	"embed"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"path/filepath"
+	"strings"
 
 	"smart-cat/internal/config"
-	"smart-cat/internal/handler"
+	"smart-cat/internal/identity"
 	"smart-cat/internal/service"
 	"smart-cat/internal/smart"
 	"smart-cat/internal/storage"
+	"smart-cat/internal/trend"
 )
 
-//go:embed web
-var webFiles embed.FS
+// command 一个子命令
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"scan", "列出设备", runScan},
+	{"show", "show <device>：读取设备的实时 SMART 数据", runShow},
+	{"history", "history <serial> [--from] [--to]：查看历史数据", runHistory},
+	{"export", "导出所有设备（或 --serial 指定设备）的历史数据", runExport},
+	{"migrate", "把数据目录中的 CSV 历史导入 SQLite（storage.backend: sqlite）", runMigrate},
+	{"storage", "storage verify|repair：检查或修复数据目录中损坏的 CSV 文件", runStorage},
+	{"serve", "启动 HTTP 服务器和后台采集（默认）", runServe},
+}
 
 func main() {
-	// 加载配置
-	cfg := config.DefaultConfig()
-	if err := cfg.Validate(); err != nil {
-		log.Fatal(err)
+	args := os.Args[1:]
+
+	// 不带子命令（或直接带参数）时保持原来的行为：启动服务器
+	run := runServe
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name := args[0]
+		args = args[1:]
+		if name == "help" {
+			usage()
+			return
+		}
+		run = nil
+		for _, cmd := range commands {
+			if cmd.name == name {
+				run = cmd.run
+				break
+			}
+		}
+		if run == nil {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+			usage()
+			os.Exit(2)
+		}
 	}
 
-	// 检查系统依赖
-	detector := smart.NewDeviceDetector()
-	if err := detector.CheckSmartctlInstalled(); err != nil {
+	if err := run(args); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// usage 打印子命令列表
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: smart-cat <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'smart-cat <command> -h' for the flags of a command.")
+}
+
+// parseArgs 解析参数，允许参数和位置参数交错（如 show sda --json），返回位置参数
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// app 各子命令共用的组件
+type app struct {
+	cfg           *config.Config
+	detector      *smart.DeviceDetector
+	store         storage.Storage
+	resolver      *identity.Resolver
+	trend         *trend.Analyzer
+	deviceService *service.DeviceService
+}
 
-	// 初始化存储层
-	store, err := storage.NewCSVStorage(cfg.Collector.DataDir)
+// newApp 加载配置（配置文件 → SMARTCAT_* 环境变量 → 命令行参数）并初始化检测器、存储和服务
+func newApp(fs *flag.FlagSet, configPath string) (*app, error) {
+	cfg, err := config.FromFlags(fs, configPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
+		return nil, err
 	}
 
-	// 初始化服务层
-	deviceService := service.NewDeviceService(detector, store)
-	collectorConfig := smart.DefaultCollectorConfig()
-	collectorConfig.Interval = cfg.Collector.Interval
-	collectorConfig.DataDir = cfg.Collector.DataDir
-	collectorConfig.Enabled = cfg.Collector.Enabled
-	collector := service.NewCollector(detector, store, collectorConfig)
+	detector := smart.NewDeviceDetectorWithRunner(newRunner(cfg.SMART.ReplayDir, cfg.SMART.RecordDir))
+	detector.SetBridgeTypes(cfg.SMART.USBBridgeTypes)
+	detector.SetBridgePins(cfg.SMART.USBBridgePins)
+	detector.SetThermalPolicy(cfg.Thermal)
+	healthModel, err := smart.NewHealthModel(cfg.Health.Model)
+	if err != nil {
+		return nil, err
+	}
+	detector.SetHealthModel(healthModel)
+	detector.SetDeviceFilter(cfg.Devices.Include, cfg.Devices.Exclude)
+	// 单次探测不超过单个设备的采集超时，整次发现同样以它为上限
+	detector.SetDiscoveryTimeout(min(smart.DefaultProbeTimeout, cfg.Collector.DeviceTimeout), cfg.Collector.DeviceTimeout)
 
-	// 启动后台采集器
-	go collector.Start()
+	store, err := newStorage(cfg, cfg.Collector.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
 
-	// 初始化HTTP处理器
-	h := handler.NewHandler(deviceService)
-	deviceHandler := handler.NewDeviceHandler(h, webFiles)
+	resolver, err := identity.NewResolver(filepath.Join(cfg.Collector.DataDir, "identities.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device identities: %w", err)
+	}
+	detector.SetIdentityResolver(resolver)
+	// 记住每块硬盘可用的桥接类型，下次先尝试它
+	detector.SetBridgeMemory(resolver)
 
-	// 设置路由
-	setupRoutes(deviceHandler)
+	deviceService := service.NewDeviceService(detector, store)
+	deviceService.SetHistoryWindow(cfg.Server.HistoryWindow)
+	deviceService.SetIdentityResolver(resolver)
+	analyzer := trend.NewAnalyzer(cfg.Trend)
+	deviceService.SetTrendAnalyzer(analyzer)
 
-	// 启动服务器
-	startServer(cfg.Server.Addr, collector)
+	return &app{
+		cfg:           cfg,
+		detector:      detector,
+		store:         store,
+		resolver:      resolver,
+		trend:         analyzer,
+		deviceService: deviceService,
+	}, nil
 }
 
-// setupRoutes 设置路由
-func setupRoutes(deviceHandler *handler.DeviceHandler) {
-	http.HandleFunc("/", deviceHandler.HandleIndex)
-	http.HandleFunc("/api/devices", deviceHandler.HandleDevices)
-	http.HandleFunc("/api/smart/", deviceHandler.HandleSmart)
-	http.HandleFunc("/api/history/", deviceHandler.HandleHistory)
+// newStorage 在 dir 下创建配置的后端、按配置的保留策略汇总的存储（本机数据目录和汇聚端每台主机各一个）
+func newStorage(cfg *config.Config, dir string) (storage.Storage, error) {
+	policy := storage.RetentionPolicy{
+		RawDays:    cfg.Storage.RetentionDays,
+		HourlyDays: cfg.Storage.HourlyRetentionDays,
+		DailyDays:  cfg.Storage.DailyRetentionDays,
+	}
+
+	csvStore, err := storage.NewCSVStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	csvStore.SetRetentionPolicy(policy)
+	if cfg.Storage.Backend != config.BackendSQLite {
+		return csvStore, nil
+	}
+
+	store, err := storage.NewSQLiteStorage(filepath.Join(dir, storage.SQLiteFile))
+	if err != nil {
+		return nil, err
+	}
+	store.SetRetentionPolicy(policy)
+
+	// 刚切换到 sqlite 时提示导入已有的 CSV 数据
+	if devices, err := store.GetAllSerials(); err == nil && len(devices) == 0 {
+		if csvDevices, err := csvStore.GetAllSerials(); err == nil && len(csvDevices) > 0 {
+			log.Printf("%s has CSV history for %d devices that is not in %s; run 'smart-cat migrate' to import it",
+				dir, len(csvDevices), storage.SQLiteFile)
+		}
+	}
+	return store, nil
 }
 
-// startServer 启动HTTP服务器
-func startServer(addr string, collector *service.Collector) {
-	log.Printf("Server starting on http://localhost%s", addr)
-	log.Printf("Press Ctrl+C to stop")
-
-	// 优雅退出
-	go func() {
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		<-sigChan
-		log.Println("\nShutting down...")
-		collector.Stop()
-		os.Exit(0)
-	}()
-
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatal(err)
+// newRunner 根据配置选择 smartctl 执行器
+func newRunner(replayDir, recordDir string) smart.Runner {
+	if replayDir != "" {
+		log.Printf("Replaying smartctl output from %s", replayDir)
+		return smart.NewReplayRunner(replayDir)
+	}
+
+	var runner smart.Runner = smart.NewExecRunner()
+	if recordDir != "" {
+		log.Printf("Recording smartctl output to %s", recordDir)
+		runner = smart.NewRecordRunner(runner, recordDir)
 	}
-}
\ No newline at end of file
+	return runner
+}
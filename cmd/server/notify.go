@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"smart-cat/internal/config"
+	"smart-cat/internal/notify"
+)
+
+// newDispatcher 按配置创建通知渠道，发件箱保存在数据目录中
+func newDispatcher(cfg *config.Config) (*notify.Dispatcher, error) {
+	var channels []notify.Channel
+	for _, chCfg := range cfg.Notifications.Channels {
+		notifier, err := newNotifier(chCfg)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %s: %w", chCfg.Name, err)
+		}
+
+		retry := cfg.Notifications.Retry
+		if chCfg.Retry != nil {
+			retry = *chCfg.Retry
+		}
+
+		channels = append(channels, notify.Channel{
+			Name:        chCfg.Name,
+			Type:        chCfg.Type,
+			MinSeverity: chCfg.MinSeverity,
+			Retry: notify.RetryPolicy{
+				MaxAttempts:    retry.MaxAttempts,
+				InitialBackoff: retry.InitialBackoff,
+				MaxBackoff:     retry.MaxBackoff,
+			},
+			Notifier: notifier,
+		})
+	}
+
+	return notify.NewDispatcher(channels, filepath.Join(cfg.Collector.DataDir, "notifications.json"))
+}
+
+// newNotifier 创建渠道后端
+func newNotifier(ch config.ChannelConfig) (notify.Notifier, error) {
+	switch ch.Type {
+	case config.ChannelWebhook:
+		return notify.NewWebhook(ch.Webhook.URL, ch.Webhook.Method, ch.Webhook.Headers, ch.Webhook.Body)
+	case config.ChannelSMTP:
+		return notify.NewSMTP(notify.SMTPConfig{
+			Addr:     ch.SMTP.Addr,
+			From:     ch.SMTP.From,
+			To:       ch.SMTP.To,
+			Username: ch.SMTP.Username,
+			Password: ch.SMTP.Password,
+			Subject:  ch.SMTP.Subject,
+			Body:     ch.SMTP.Body,
+		})
+	case config.ChannelSyslog:
+		var s config.SyslogConfig
+		if ch.Syslog != nil {
+			s = *ch.Syslog
+		}
+		return notify.NewSyslog(s.Network, s.Addr, s.Tag)
+	case config.ChannelJournald:
+		var j config.JournaldConfig
+		if ch.Journald != nil {
+			j = *ch.Journald
+		}
+		return notify.NewJournald(j.Socket, j.Identifier)
+	default:
+		return nil, fmt.Errorf("unknown channel type %q", ch.Type)
+	}
+}
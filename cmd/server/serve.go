@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"smart-cat/internal/alert"
+	"smart-cat/internal/config"
+	"smart-cat/internal/handler"
+	"smart-cat/internal/identity"
+	"smart-cat/internal/metrics"
+	"smart-cat/internal/notify"
+	"smart-cat/internal/service"
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// runServe 启动 HTTP 服务器和后台采集器（serve 子命令，也是不带子命令时的默认行为）
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := config.RegisterFlags(fs)
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	a, err := newApp(fs, *configPath)
+	if err != nil {
+		return err
+	}
+
+	// 退出时关闭存储（SQLite 需要关闭数据库）
+	if closer, ok := a.store.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// 把以序列号命名的旧数据迁移到设备标识下：启动时处理已登记的设备（可能由只读的命令登记），
+	// 之后在首次识别设备时处理。只在服务中进行，只读的命令不改动数据文件
+	for _, ident := range a.resolver.List() {
+		migrateSerialData(a.store, ident)
+	}
+	a.resolver.OnCreate(func(ident identity.Identity) {
+		migrateSerialData(a.store, ident)
+	})
+
+	cfg := a.cfg
+	host, err := clusterHost(cfg)
+	if err != nil {
+		return err
+	}
+
+	// 检查系统依赖，汇聚端不采集本机时不需要 smartctl
+	if cfg.Cluster.Mode != config.ModeAggregator || cfg.Collector.Enabled {
+		if err := a.detector.CheckSmartctlInstalled(); err != nil {
+			return err
+		}
+	}
+
+	// 初始化采集器
+	collectorConfig := smart.DefaultCollectorConfig()
+	collectorConfig.Interval = cfg.Collector.Interval
+	collectorConfig.DataDir = cfg.Collector.DataDir
+	collectorConfig.Enabled = cfg.Collector.Enabled
+	collectorConfig.Workers = cfg.Collector.Workers
+	collectorConfig.DeviceTimeout = cfg.Collector.DeviceTimeout
+	collectorConfig.SkipStandby = cfg.Collector.SkipStandby
+	collectorConfig.MaxStandbySkips = cfg.Collector.MaxStandbySkips
+	var store storage.Storage = a.store
+	if cfg.Cluster.Mode == config.ModeAgent {
+		// agent 不保存历史，采集结果全部推送到汇聚端
+		store = nil
+	}
+	collector := service.NewCollector(a.detector, store, collectorConfig)
+	collector.SetRetentionInterval(cfg.Storage.RetentionInterval)
+	collector.SetTrendAnalyzer(a.trend)
+
+	// 电源状态记录设备名到序列号的对应关系，待机跳过的采样靠它归属到设备
+	powerTracker, err := service.NewPowerTracker(filepath.Join(cfg.Collector.DataDir, "power.json"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize power tracker: %w", err)
+	}
+	collector.SetPowerTracker(powerTracker)
+	if cfg.Collector.SkipStandby {
+		a.deviceService.SetPowerTracker(powerTracker)
+	}
+
+	if cfg.Cluster.Mode == config.ModeAgent {
+		return runAgent(a, host, collector)
+	}
+
+	// 初始化告警引擎，状态保存在数据目录中，重启后保留
+	alertEngine, err := alert.NewEngine(cfg.Alerts.EffectiveRules(), filepath.Join(cfg.Collector.DataDir, "alerts.json"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize alert engine: %w", err)
+	}
+	alertEngine.SetResolveAfter(cfg.Alerts.ResolveAfter)
+	collector.SetAlertEngine(alertEngine)
+
+	// 初始化通知：告警触发或恢复时写入发件箱，由后台发送
+	dispatcher, err := newDispatcher(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize notifications: %w", err)
+	}
+	alertEngine.OnChange(func(a alert.Alert) {
+		dispatcher.Notify(notify.FromAlert(a))
+	})
+	// 收到退出信号时取消，后台任务和 HTTP 服务器随之停止
+	bgCtx, stopBackground := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopBackground()
+	go dispatcher.Run(bgCtx)
+
+	// 初始化自检调度器，依赖采集器的快照发现设备
+	var scheduler *service.SelfTestScheduler
+	if cfg.SelfTest.Enabled {
+		scheduler, err = service.NewSelfTestScheduler(a.detector, collector, newSelfTestConfig(cfg),
+			filepath.Join(cfg.Collector.DataDir, "selftests.json"))
+		if err != nil {
+			return fmt.Errorf("failed to initialize self-test scheduler: %w", err)
+		}
+		go scheduler.Run(bgCtx)
+	}
+
+	// 汇聚端：接收 agent 推送，每台主机的数据保存在 hosts/<host>/ 下
+	var aggregator *service.Aggregator
+	if cfg.Cluster.Mode == config.ModeAggregator {
+		aggregator, err = service.NewAggregator(filepath.Join(cfg.Collector.DataDir, "hosts"), func(dir string) (storage.Storage, error) {
+			return newStorage(cfg, dir)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to initialize aggregator: %w", err)
+		}
+		aggregator.SetAlertEngine(alertEngine)
+		aggregator.SetTrendAnalyzer(a.trend)
+		aggregator.SetEventBus(collector.Events())
+		a.deviceService.SetAggregator(aggregator, host)
+		go aggregator.RunRetention(bgCtx, cfg.Storage.RetentionInterval)
+		log.Printf("Aggregator mode: accepting agent pushes on %s", service.PushPath)
+	}
+
+	// 启动后台采集器
+	go collector.Start()
+
+	// 初始化HTTP处理器
+	a.deviceService.SetReadTimeout(cfg.Collector.DeviceTimeout)
+	if cfg.Collector.Enabled {
+		// API 从采集器填充的快照缓存读取，不再每次请求都调用 smartctl
+		cache := collector.Cache()
+		cache.SetRefreshInterval(cfg.Server.RefreshInterval)
+		a.deviceService.SetSnapshotCache(cache)
+	}
+	h := handler.NewHandler(a.deviceService, alertEngine)
+	handlers := handler.Handlers{
+		Device:       handler.NewDeviceHandler(h, webFiles),
+		Alert:        handler.NewAlertHandler(h),
+		Notification: handler.NewNotificationHandler(h, dispatcher),
+		SelfTest:     handler.NewSelfTestHandler(h, scheduler),
+		Events:       handler.NewEventsHandler(h, collector.Events()),
+	}
+	if aggregator != nil {
+		handlers.Agent = handler.NewAgentHandler(h, aggregator, cfg.Cluster.Token, cfg.Cluster.HostTokens)
+	}
+
+	// 启动服务器，收到退出信号后返回
+	return startServer(bgCtx, cfg.Server.Addr, setupRoutes(handlers, collector), collector)
+}
+
+// runAgent 以 agent 模式运行：采集本机并推送到汇聚端，不提供 HTTP 服务，收到退出信号后返回
+func runAgent(a *app, host string, collector *service.Collector) error {
+	cfg := a.cfg
+	agent, err := service.NewAgent(service.AgentConfig{
+		ServerURL:    cfg.Cluster.AggregatorURL,
+		Token:        cfg.Cluster.Token,
+		Host:         host,
+		PushInterval: cfg.Cluster.PushInterval,
+		BufferSize:   cfg.Cluster.BufferSize,
+	}, filepath.Join(cfg.Collector.DataDir, "agent-buffer.json"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize agent: %w", err)
+	}
+	if n := agent.Pending(); n > 0 {
+		log.Printf("Resuming agent with %d buffered samples", n)
+	}
+	collector.OnSample(agent.Enqueue)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go agent.Run(ctx)
+
+	// 自检在本机执行，结果随采集数据推送
+	if cfg.SelfTest.Enabled {
+		scheduler, err := service.NewSelfTestScheduler(a.detector, collector, newSelfTestConfig(cfg),
+			filepath.Join(cfg.Collector.DataDir, "selftests.json"))
+		if err != nil {
+			return fmt.Errorf("failed to initialize self-test scheduler: %w", err)
+		}
+		go scheduler.Run(ctx)
+	}
+
+	go collector.Start()
+	<-ctx.Done()
+	log.Println("Shutting down agent...")
+	collector.Stop()
+	return nil
+}
+
+// migrateSerialData 把以序列号命名的数据重命名为设备标识，没有旧数据时什么也不做
+func migrateSerialData(store storage.Storage, ident identity.Identity) {
+	if ident.Serial == "" || ident.Serial == "unknown" || ident.Serial == ident.ID {
+		return
+	}
+	if err := store.RenameDevice(ident.Serial, ident.ID); err != nil {
+		log.Printf("Failed to migrate data of %s to %s: %v", ident.Serial, ident.ID, err)
+	}
+}
+
+// clusterHost 返回本机名称，未配置时使用系统主机名
+func clusterHost(cfg *config.Config) (string, error) {
+	host := cfg.Cluster.Host
+	if host == "" {
+		name, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("get hostname: %w", err)
+		}
+		host = name
+	}
+	if cfg.Cluster.Mode != config.ModeStandalone && !service.ValidHostName(host) {
+		return "", fmt.Errorf("invalid host name %q: only letters, digits, '.', '_' and '-' are allowed", host)
+	}
+	return host, nil
+}
+
+// newSelfTestConfig 把配置文件中的自检配置转换为调度器配置，设备覆盖项未设置的周期沿用全局值
+func newSelfTestConfig(cfg *config.Config) service.SelfTestConfig {
+	defaults := service.SelfTestSchedule{
+		ShortInterval: cfg.SelfTest.ShortInterval,
+		LongInterval:  cfg.SelfTest.LongInterval,
+	}
+
+	overrides := make(map[string]service.SelfTestSchedule, len(cfg.SelfTest.Devices))
+	for serial, d := range cfg.SelfTest.Devices {
+		sched := defaults
+		if d.ShortInterval != nil {
+			sched.ShortInterval = *d.ShortInterval
+		}
+		if d.LongInterval != nil {
+			sched.LongInterval = *d.LongInterval
+		}
+		overrides[serial] = sched
+	}
+
+	return service.SelfTestConfig{
+		Schedule:      defaults,
+		Overrides:     overrides,
+		CheckInterval: cfg.SelfTest.CheckInterval,
+		DeviceTimeout: cfg.Collector.DeviceTimeout,
+	}
+}
+
+// setupRoutes 设置路由：API 由 handler.Router 分发，首页和 /metrics 走标准库的 ServeMux
+func setupRoutes(handlers handler.Handlers, collector *service.Collector) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handlers.Device.HandleIndex)
+	mux.Handle("/metrics", metrics.NewExporter(collector))
+	return handler.NewAPI(handlers, mux)
+}
+
+// shutdownTimeout 退出时等待进行中的请求完成的时间
+const shutdownTimeout = 10 * time.Second
+
+// startServer 启动HTTP服务器，ctx 取消后停止采集器并优雅关闭服务器
+func startServer(ctx context.Context, addr string, h http.Handler, collector *service.Collector) error {
+	log.Printf("Server starting on http://localhost%s", addr)
+	log.Printf("Press Ctrl+C to stop")
+
+	// 请求的 context 在关闭时取消，事件流等长连接随之结束，不会拖住 Shutdown
+	reqCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server := &http.Server{
+		Addr:        addr,
+		Handler:     h,
+		BaseContext: func(net.Listener) context.Context { return reqCtx },
+	}
+	server.RegisterOnShutdown(cancelRequests)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		collector.Stop()
+		return err
+	case <-ctx.Done():
+	}
+
+	// 优雅退出
+	log.Println("\nShutting down...")
+	collector.Stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown server: %w", err)
+	}
+	return nil
+}
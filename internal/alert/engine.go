@@ -0,0 +1,383 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// 告警状态
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// resolvedRetention 已恢复告警在列表中保留的时间
+const resolvedRetention = 7 * 24 * time.Hour
+
+// DefaultResolveAfter delta 规则默认的恢复静默窗口
+const DefaultResolveAfter = 24 * time.Hour
+
+// Alert 一条告警（同一规则 + 设备只有一条）
+type Alert struct {
+	ID         string     `json:"id"`
+	Rule       string     `json:"rule"`
+	Severity   string     `json:"severity"`
+	State      string     `json:"state"`
+	Host       string     `json:"host,omitempty"`
+	DeviceID   string     `json:"device_id,omitempty"`
+	Serial     string     `json:"serial"`
+	Device     string     `json:"device"`
+	Model      string     `json:"model"`
+	Metric     string     `json:"metric"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	Message    string     `json:"message"`
+	StartsAt   time.Time  `json:"starts_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// state 持久化的引擎状态，重启后继续计算连续次数和差值
+type state struct {
+	Alerts  map[string]*Alert             `json:"alerts"`
+	Streaks map[string]int                `json:"streaks"`
+	Last    map[string]map[string]float64 `json:"last"`             // 设备标识 -> metric -> 上次的值
+	Models  map[string]string             `json:"models,omitempty"` // 设备标识 -> 上次计算健康度的模型
+}
+
+// Engine 告警规则引擎
+type Engine struct {
+	rules        []Rule
+	path         string
+	resolveAfter time.Duration // delta 规则未设置 ResolveAfter 时使用
+
+	mu       sync.Mutex
+	state    state
+	onChange []func(Alert)
+}
+
+// NewEngine 创建告警引擎，path 为状态文件路径（为空则不持久化）
+func NewEngine(rules []Rule, path string) (*Engine, error) {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	e := &Engine{
+		rules:        rules,
+		path:         path,
+		resolveAfter: DefaultResolveAfter,
+		state: state{
+			Alerts:  make(map[string]*Alert),
+			Streaks: make(map[string]int),
+			Last:    make(map[string]map[string]float64),
+			Models:  make(map[string]string),
+		},
+	}
+
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// SetResolveAfter 设置 delta 规则默认的恢复静默窗口，0 表示条件不满足时立即恢复
+func (e *Engine) SetResolveAfter(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resolveAfter = d
+}
+
+// OnChange 注册告警状态变化回调（触发或恢复时调用）
+func (e *Engine) OnChange(fn func(Alert)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = append(e.onChange, fn)
+}
+
+// Evaluate 对一次采集结果评估所有规则，返回状态发生变化的告警
+func (e *Engine) Evaluate(data *smart.SMARTData) ([]Alert, error) {
+	key := deviceKey(data.Device)
+	if key == "" {
+		return nil, nil
+	}
+
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	e.mu.Lock()
+
+	if data.Device.Host == "" && key != data.Device.Serial {
+		e.migrate(data.Device.Serial, key)
+	}
+	last := e.state.Last[key]
+	if last == nil {
+		last = make(map[string]float64)
+		e.state.Last[key] = last
+	}
+	// 切换健康度模型后分数的基准不同，不与旧模型的分数比较
+	if data.Health != nil {
+		if model, ok := e.state.Models[key]; ok && model != data.Health.Model {
+			delete(last, "health_percent")
+		}
+		e.state.Models[key] = data.Health.Model
+	}
+
+	var changed []Alert
+	for i := range e.rules {
+		rule := &e.rules[i]
+
+		value, ok := MetricValue(data, rule.Metric)
+		if !ok {
+			continue
+		}
+
+		observed := value
+		matched := false
+		if rule.Delta {
+			// 没有上一次采样时无法计算差值
+			if prev, hasPrev := last[rule.Metric]; hasPrev {
+				observed = value - prev
+				matched = rule.match(observed)
+			}
+		} else {
+			matched = rule.match(value)
+		}
+
+		if alert, ok := e.apply(rule, key, data, matched, observed, now); ok {
+			changed = append(changed, alert)
+		}
+	}
+
+	// 所有规则评估完后再更新上次的值，同一指标的多条 delta 规则看到相同基准
+	for i := range e.rules {
+		if value, ok := MetricValue(data, e.rules[i].Metric); ok {
+			last[e.rules[i].Metric] = value
+		}
+	}
+
+	e.prune(now)
+	err := e.save()
+	callbacks := e.onChange
+	e.mu.Unlock()
+
+	for _, alert := range changed {
+		for _, fn := range callbacks {
+			fn(alert)
+		}
+	}
+
+	return changed, err
+}
+
+// migrate 把以序列号保存的旧状态转到设备标识下，调用方持有锁
+func (e *Engine) migrate(serial, key string) {
+	if serial == "" {
+		return
+	}
+	if last, ok := e.state.Last[serial]; ok {
+		if _, exists := e.state.Last[key]; !exists {
+			e.state.Last[key] = last
+		}
+		delete(e.state.Last, serial)
+	}
+	if model, ok := e.state.Models[serial]; ok {
+		if _, exists := e.state.Models[key]; !exists {
+			e.state.Models[key] = model
+		}
+		delete(e.state.Models, serial)
+	}
+	for i := range e.rules {
+		from, to := e.rules[i].Name+"/"+serial, e.rules[i].Name+"/"+key
+		if alert, ok := e.state.Alerts[from]; ok {
+			delete(e.state.Alerts, from)
+			if _, exists := e.state.Alerts[to]; !exists {
+				alert.ID = to
+				alert.DeviceID = key
+				e.state.Alerts[to] = alert
+			}
+		}
+		if streak, ok := e.state.Streaks[from]; ok {
+			delete(e.state.Streaks, from)
+			e.state.Streaks[to] = streak
+		}
+	}
+}
+
+// deviceKey 告警状态中区分设备的键，汇聚端收到的其他主机的设备带主机名前缀
+func deviceKey(device smart.Device) string {
+	key := device.Key()
+	if key != "" && device.Host != "" {
+		key = device.Host + "/" + key
+	}
+	return key
+}
+
+// apply 根据匹配结果更新告警状态，返回是否发生变化
+func (e *Engine) apply(rule *Rule, key string, data *smart.SMARTData, matched bool, value float64, now time.Time) (Alert, bool) {
+	id := rule.Name + "/" + key
+	alert := e.state.Alerts[id]
+
+	if !matched {
+		delete(e.state.Streaks, id)
+		if alert == nil || alert.State != StateFiring {
+			return Alert{}, false
+		}
+		// 触发中的告警每次满足条件都会更新 UpdatedAt，静默窗口内不恢复
+		if quiet := e.quietWindow(rule); quiet > 0 && now.Sub(alert.UpdatedAt) < quiet {
+			return Alert{}, false
+		}
+		alert.State = StateResolved
+		alert.Value = value
+		alert.ResolvedAt = &now
+		alert.UpdatedAt = now
+		return *alert, true
+	}
+
+	e.state.Streaks[id]++
+	required := rule.For
+	if required < 1 {
+		required = 1
+	}
+	if e.state.Streaks[id] < required {
+		return Alert{}, false
+	}
+
+	if alert != nil && alert.State == StateFiring {
+		// 持续触发只更新当前值
+		alert.Value = value
+		alert.UpdatedAt = now
+		return Alert{}, false
+	}
+
+	alert = &Alert{
+		ID:        id,
+		Rule:      rule.Name,
+		Severity:  rule.Severity,
+		State:     StateFiring,
+		Host:      data.Device.Host,
+		DeviceID:  data.Device.ID,
+		Serial:    data.Device.Serial,
+		Device:    data.Device.Name,
+		Model:     data.Device.Model,
+		Metric:    rule.Metric,
+		Value:     value,
+		Threshold: rule.Value,
+		Message:   rule.Message,
+		StartsAt:  now,
+		UpdatedAt: now,
+	}
+	e.state.Alerts[id] = alert
+	return *alert, true
+}
+
+// quietWindow 规则不再满足后恢复前需要等待的时间
+func (e *Engine) quietWindow(rule *Rule) time.Duration {
+	if rule.ResolveAfter > 0 || !rule.Delta {
+		return rule.ResolveAfter
+	}
+	return e.resolveAfter
+}
+
+// prune 删除恢复已久的告警
+func (e *Engine) prune(now time.Time) {
+	for id, alert := range e.state.Alerts {
+		if alert.State == StateResolved && alert.ResolvedAt != nil && now.Sub(*alert.ResolvedAt) > resolvedRetention {
+			delete(e.state.Alerts, id)
+		}
+	}
+}
+
+// List 返回告警列表，state 为空时返回全部；触发中的排在前面
+func (e *Engine) List(stateFilter string) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.state.Alerts))
+	for _, alert := range e.state.Alerts {
+		if stateFilter != "" && alert.State != stateFilter {
+			continue
+		}
+		alerts = append(alerts, *alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].State != alerts[j].State {
+			return alerts[i].State == StateFiring
+		}
+		return alerts[i].StartsAt.After(alerts[j].StartsAt)
+	})
+	return alerts
+}
+
+// Rules 返回当前生效的规则
+func (e *Engine) Rules() []Rule {
+	return append([]Rule(nil), e.rules...)
+}
+
+// load 从状态文件恢复
+func (e *Engine) load() error {
+	if e.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read alert state: %w", err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("parse alert state: %w", err)
+	}
+
+	if st.Alerts != nil {
+		e.state.Alerts = st.Alerts
+	}
+	if st.Streaks != nil {
+		e.state.Streaks = st.Streaks
+	}
+	if st.Last != nil {
+		e.state.Last = st.Last
+	}
+	if st.Models != nil {
+		e.state.Models = st.Models
+	}
+	return nil
+}
+
+// save 写入状态文件（先写临时文件再重命名）
+func (e *Engine) save() error {
+	if e.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(e.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode alert state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write alert state: %w", err)
+	}
+	return os.Rename(tmp, e.path)
+}
@@ -0,0 +1,225 @@
+package alert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// 告警级别
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Rule 声明式告警规则
+//
+// 普通规则比较当前值：Metric Op Value；
+// Delta 规则比较与上一次采样的差值：(当前值 - 上次值) Op Value。
+// For 表示需要连续满足的采样次数。
+// ResolveAfter 表示条件不再满足后保持触发的时间，超过后才恢复；
+// delta 规则未设置时使用引擎的默认值，避免下一次没有变化的采样就恢复。
+type Rule struct {
+	Name         string        `json:"name" yaml:"name"`
+	Metric       string        `json:"metric" yaml:"metric"`
+	Op           string        `json:"op" yaml:"op"`
+	Value        float64       `json:"value" yaml:"value"`
+	Delta        bool          `json:"delta,omitempty" yaml:"delta"`
+	For          int           `json:"for,omitempty" yaml:"for"`
+	ResolveAfter time.Duration `json:"resolve_after,omitempty" yaml:"resolve_after"`
+	Severity     string        `json:"severity" yaml:"severity"`
+	Message      string        `json:"message" yaml:"message"`
+}
+
+// DefaultRules 默认告警规则
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "smart_failed", Metric: "smart_failed", Op: "==", Value: 1, Severity: SeverityCritical, Message: "SMART 自检状态为 FAILED"},
+		{Name: "reallocated_increase", Metric: "reallocated_sectors", Op: ">", Value: 0, Delta: true, Severity: SeverityWarning, Message: "重映射扇区增加"},
+		{Name: "pending_increase", Metric: "pending_sectors", Op: ">", Value: 0, Delta: true, Severity: SeverityWarning, Message: "待映射扇区增加"},
+		{Name: "uncorrectable_increase", Metric: "uncorrectable_errors", Op: ">", Value: 0, Delta: true, Severity: SeverityCritical, Message: "不可纠正错误增加"},
+		{Name: "health_drop", Metric: "health_percent", Op: "<", Value: 0, Delta: true, Severity: SeverityWarning, Message: "健康度下降"},
+		{Name: "temperature_high", Metric: "temperature", Op: ">", Value: 55, For: 3, Severity: SeverityWarning, Message: "温度连续 3 次高于 55°C"},
+		{Name: "temperature_critical", Metric: "thermal_level", Op: ">=", Value: 2, Severity: SeverityCritical, Message: "温度达到所属设备类别的 critical 阈值"},
+		{Name: "nvme_spare_low", Metric: "nvme_spare_margin", Op: "<", Value: 0, Severity: SeverityCritical, Message: "NVMe 剩余备用空间低于阈值"},
+		{Name: "nvme_critical_warning", Metric: "nvme_critical_warning", Op: "!=", Value: 0, Severity: SeverityCritical, Message: "NVMe 报告关键警告"},
+		{Name: "failure_predicted", Metric: "days_remaining", Op: "<", Value: 30, For: 2, Severity: SeverityWarning, Message: "按增长趋势预计 30 天内达到更换阈值"},
+	}
+}
+
+// Validate 检查规则是否可用
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule name required")
+	}
+	if !isKnownMetric(r.Metric) {
+		return fmt.Errorf("rule %s: unknown metric %q", r.Name, r.Metric)
+	}
+	if _, ok := operators[r.Op]; !ok {
+		return fmt.Errorf("rule %s: unknown operator %q", r.Name, r.Op)
+	}
+	if r.Severity != SeverityWarning && r.Severity != SeverityCritical {
+		return fmt.Errorf("rule %s: severity must be %s or %s, got %q", r.Name, SeverityWarning, SeverityCritical, r.Severity)
+	}
+	if r.For < 0 || r.ResolveAfter < 0 {
+		return fmt.Errorf("rule %s: for and resolve_after must not be negative", r.Name)
+	}
+	return nil
+}
+
+// operators 支持的比较运算符
+var operators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// match 判断值是否满足规则条件
+func (r *Rule) match(v float64) bool {
+	op, ok := operators[r.Op]
+	return ok && op(v, r.Value)
+}
+
+// metrics 规则可引用的指标，返回 false 表示该设备没有此指标
+var metrics = map[string]func(d *smart.SMARTData) (float64, bool){
+	"smart_failed": func(d *smart.SMARTData) (float64, bool) {
+		if d.SmartStatus == "FAILED" {
+			return 1, true
+		}
+		return 0, true
+	},
+	"temperature":          func(d *smart.SMARTData) (float64, bool) { return float64(d.Temperature), true },
+	"power_on_hours":       func(d *smart.SMARTData) (float64, bool) { return float64(d.PowerOnHours), true },
+	"power_cycle_count":    func(d *smart.SMARTData) (float64, bool) { return float64(d.PowerCycleCount), true },
+	"reallocated_sectors":  func(d *smart.SMARTData) (float64, bool) { return float64(d.ReallocatedSectors), true },
+	"pending_sectors":      func(d *smart.SMARTData) (float64, bool) { return float64(d.PendingSectors), true },
+	"uncorrectable_errors": func(d *smart.SMARTData) (float64, bool) { return float64(d.UncorrectableErrors), true },
+	"health_percent":       func(d *smart.SMARTData) (float64, bool) { return float64(d.HealthPercent), true },
+	"nvme_critical_warning": func(d *smart.SMARTData) (float64, bool) {
+		if d.NVMe == nil {
+			return 0, false
+		}
+		return float64(d.NVMe.CriticalWarning), true
+	},
+	"nvme_available_spare": func(d *smart.SMARTData) (float64, bool) {
+		if d.NVMe == nil {
+			return 0, false
+		}
+		return float64(d.NVMe.AvailableSpare), true
+	},
+	// 剩余备用空间与厂商阈值之差，小于 0 表示已低于阈值
+	"nvme_spare_margin": func(d *smart.SMARTData) (float64, bool) {
+		if d.NVMe == nil {
+			return 0, false
+		}
+		return float64(d.NVMe.AvailableSpare - d.NVMe.AvailableSpareThreshold), true
+	},
+	"nvme_percentage_used": func(d *smart.SMARTData) (float64, bool) {
+		if d.NVMe == nil {
+			return 0, false
+		}
+		return float64(d.NVMe.PercentageUsed), true
+	},
+	"nvme_media_errors": func(d *smart.SMARTData) (float64, bool) {
+		if d.NVMe == nil {
+			return 0, false
+		}
+		return float64(d.NVMe.MediaErrors), true
+	},
+	// 趋势预测：最先达到阈值的指标的预计天数和置信度，没有指标在增长时不参与评估；
+	// 样本少或历史短的预测置信度低，低于 minTrendConfidence 时 days_remaining 也不参与评估
+	"days_remaining": func(d *smart.SMARTData) (float64, bool) {
+		if d.Trend == nil || d.Trend.DaysRemaining == nil || d.Trend.Confidence < minTrendConfidence {
+			return 0, false
+		}
+		return *d.Trend.DaysRemaining, true
+	},
+	"trend_confidence": func(d *smart.SMARTData) (float64, bool) {
+		if d.Trend == nil || d.Trend.DaysRemaining == nil {
+			return 0, false
+		}
+		return d.Trend.Confidence, true
+	},
+	"reallocated_sectors_rate":  trendRate("reallocated_sectors"),
+	"pending_sectors_rate":      trendRate("pending_sectors"),
+	"uncorrectable_errors_rate": trendRate("uncorrectable_errors"),
+	"nvme_percentage_used_rate": trendRate("nvme_percentage_used"),
+	// 按设备类别判定的温度状态：0 ok，1 warm，2 critical
+	"thermal_level": func(d *smart.SMARTData) (float64, bool) {
+		if d.Thermal == nil || d.Thermal.State == "" {
+			return 0, false
+		}
+		switch d.Thermal.State {
+		case smart.ThermalCritical:
+			return 2, true
+		case smart.ThermalWarm:
+			return 1, true
+		default:
+			return 0, true
+		}
+	},
+}
+
+// minTrendConfidence days_remaining 参与评估需要的最低置信度
+const minTrendConfidence = 0.5
+
+// trendRate 趋势预测中指标每天的增长量
+func trendRate(metric string) func(d *smart.SMARTData) (float64, bool) {
+	return func(d *smart.SMARTData) (float64, bool) {
+		if d.Trend == nil {
+			return 0, false
+		}
+		for _, t := range d.Trend.Metrics {
+			if t.Metric == metric {
+				return t.RatePerDay, true
+			}
+		}
+		return 0, false
+	}
+}
+
+// attrPrefix 引用 ATA 属性原始值的指标前缀，如 attr_187
+const attrPrefix = "attr_"
+
+// MetricValue 从快照中取出指标值
+func MetricValue(d *smart.SMARTData, metric string) (float64, bool) {
+	if d == nil {
+		return 0, false
+	}
+
+	if fn, ok := metrics[metric]; ok {
+		return fn(d)
+	}
+
+	if strings.HasPrefix(metric, attrPrefix) {
+		id, err := strconv.Atoi(strings.TrimPrefix(metric, attrPrefix))
+		if err != nil {
+			return 0, false
+		}
+		for _, attr := range d.Attributes {
+			if attr.ID == id {
+				return float64(attr.RawValue), true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// isKnownMetric 判断指标名是否合法
+func isKnownMetric(metric string) bool {
+	if _, ok := metrics[metric]; ok {
+		return true
+	}
+	if strings.HasPrefix(metric, attrPrefix) {
+		_, err := strconv.Atoi(strings.TrimPrefix(metric, attrPrefix))
+		return err == nil
+	}
+	return false
+}
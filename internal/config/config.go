@@ -1,51 +1,499 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"smart-cat/internal/alert"
+	"smart-cat/internal/notify"
+	"smart-cat/internal/smart"
+	"smart-cat/internal/trend"
 )
 
 // Config 应用配置
 type Config struct {
-	Server ServerConfig `json:"server"`
-	Collector CollectorConfig `json:"collector"`
+	Server        ServerConfig        `json:"server" yaml:"server"`
+	Collector     CollectorConfig     `json:"collector" yaml:"collector"`
+	Storage       StorageConfig       `json:"storage" yaml:"storage"`
+	SMART         SMARTConfig         `json:"smart" yaml:"smart"`
+	Devices       DevicesConfig       `json:"devices" yaml:"devices"`
+	Thermal       smart.ThermalPolicy `json:"thermal" yaml:"thermal"` // 按设备类别的温度阈值
+	Health        HealthConfig        `json:"health" yaml:"health"`
+	Trend         trend.Config        `json:"trend" yaml:"trend"` // 按历史增长率预测剩余天数
+	Alerts        AlertsConfig        `json:"alerts" yaml:"alerts"`
+	Notifications NotificationsConfig `json:"notifications" yaml:"notifications"`
+	SelfTest      SelfTestConfig      `json:"selftest" yaml:"selftest"`
+	Cluster       ClusterConfig       `json:"cluster" yaml:"cluster"`
 }
 
 // ServerConfig HTTP服务器配置
 type ServerConfig struct {
-	Addr string `json:"addr"`
+	Addr            string        `json:"addr" yaml:"addr"`
+	HistoryWindow   time.Duration `json:"history_window" yaml:"history_window"`     // 未指定 from 时历史查询的默认时间窗口
+	RefreshInterval time.Duration `json:"refresh_interval" yaml:"refresh_interval"` // ?refresh=true 实时读取同一设备的最小间隔，间隔内返回缓存
 }
 
 // CollectorConfig 数据采集器配置
 type CollectorConfig struct {
-	Interval time.Duration `json:"interval"`
-	DataDir  string        `json:"data_dir"`
-	Enabled  bool          `json:"enabled"`
+	Interval        time.Duration `json:"interval" yaml:"interval"`
+	DataDir         string        `json:"data_dir" yaml:"data_dir"`
+	Enabled         bool          `json:"enabled" yaml:"enabled"`
+	Workers         int           `json:"workers" yaml:"workers"`                     // 并发采集的设备数
+	DeviceTimeout   time.Duration `json:"device_timeout" yaml:"device_timeout"`       // 单个设备的采集超时
+	SkipStandby     bool          `json:"skip_standby" yaml:"skip_standby"`           // 设备待机时跳过读取（smartctl -n standby）
+	MaxStandbySkips int           `json:"max_standby_skips" yaml:"max_standby_skips"` // 连续跳过多少次后强制读取，0 表示不强制
+}
+
+// 存储后端
+const (
+	BackendCSV    = "csv"    // 每个设备一组 CSV 文件（默认）
+	BackendSQLite = "sqlite" // 数据目录中的 smartcat.db
+)
+
+// StorageConfig 历史数据存储配置
+type StorageConfig struct {
+	Backend             string        `json:"backend" yaml:"backend"`                             // csv/sqlite
+	RetentionDays       int           `json:"retention_days" yaml:"retention_days"`               // 原始采样保留天数，之后汇总为小时数据
+	HourlyRetentionDays int           `json:"hourly_retention_days" yaml:"hourly_retention_days"` // 小时数据保留天数，之后汇总为天数据
+	DailyRetentionDays  int           `json:"daily_retention_days" yaml:"daily_retention_days"`   // 天数据保留天数
+	RetentionInterval   time.Duration `json:"retention_interval" yaml:"retention_interval"`       // 执行保留策略的间隔
+}
+
+// HealthConfig 健康度评分配置
+type HealthConfig struct {
+	Model string `json:"model" yaml:"model"` // legacy/backblaze/ssd_endurance/nvme/auto
+}
+
+// SMARTConfig smartctl 调用配置
+type SMARTConfig struct {
+	USBBridgeTypes []string          `json:"usb_bridge_types" yaml:"usb_bridge_types"` // 依次尝试的 -d 类型，"" 表示自动
+	USBBridgePins  map[string]string `json:"usb_bridge_pins" yaml:"usb_bridge_pins"`   // 设备标识或路径 glob -> 固定的 -d 类型
+	ReplayDir      string            `json:"replay_dir" yaml:"replay_dir"`             // 回放录制的 smartctl 输出
+	RecordDir      string            `json:"record_dir" yaml:"record_dir"`             // 录制 smartctl 输出
+}
+
+// DevicesConfig 设备过滤配置，支持 glob（如 /dev/sd*）
+type DevicesConfig struct {
+	Include []string `json:"include" yaml:"include"` // 为空表示全部包含
+	Exclude []string `json:"exclude" yaml:"exclude"`
+}
+
+// AlertsConfig 告警规则配置
+type AlertsConfig struct {
+	Rules        []alert.Rule  `json:"rules" yaml:"rules"`                 // 为空时使用内置默认规则
+	ResolveAfter time.Duration `json:"resolve_after" yaml:"resolve_after"` // delta 规则不再满足后保持触发的时间
+}
+
+// EffectiveRules 返回生效的告警规则：配置了规则时使用配置，否则使用默认规则
+func (a *AlertsConfig) EffectiveRules() []alert.Rule {
+	if len(a.Rules) == 0 {
+		return alert.DefaultRules()
+	}
+	return append([]alert.Rule(nil), a.Rules...)
+}
+
+// NotificationsConfig 通知配置
+type NotificationsConfig struct {
+	Retry    RetryConfig     `json:"retry" yaml:"retry"` // 默认重试策略，渠道可单独覆盖
+	Channels []ChannelConfig `json:"channels" yaml:"channels"`
+}
+
+// RetryConfig 发送失败后的指数退避重试
+type RetryConfig struct {
+	MaxAttempts    int           `json:"max_attempts" yaml:"max_attempts"`
+	InitialBackoff time.Duration `json:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff" yaml:"max_backoff"`
+}
+
+// 通知渠道类型
+const (
+	ChannelWebhook  = "webhook"
+	ChannelSMTP     = "smtp"
+	ChannelSyslog   = "syslog"
+	ChannelJournald = "journald"
+)
+
+// ChannelConfig 一个通知渠道，Type 对应的子配置生效
+type ChannelConfig struct {
+	Name        string          `json:"name" yaml:"name"`
+	Type        string          `json:"type" yaml:"type"`                   // webhook/smtp/syslog/journald
+	MinSeverity string          `json:"min_severity" yaml:"min_severity"`   // 为空表示全部发送
+	Retry       *RetryConfig    `json:"retry,omitempty" yaml:"retry"`       // 为空使用 notifications.retry
+	Webhook     *WebhookConfig  `json:"webhook,omitempty" yaml:"webhook"`   // type: webhook
+	SMTP        *SMTPConfig     `json:"smtp,omitempty" yaml:"smtp"`         // type: smtp
+	Syslog      *SyslogConfig   `json:"syslog,omitempty" yaml:"syslog"`     // type: syslog
+	Journald    *JournaldConfig `json:"journald,omitempty" yaml:"journald"` // type: journald
+}
+
+// WebhookConfig JSON webhook，Body 为 text/template 模板，为空时发送事件 JSON
+type WebhookConfig struct {
+	URL     string            `json:"url" yaml:"url"`
+	Method  string            `json:"method" yaml:"method"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	Body    string            `json:"body" yaml:"body"`
+}
+
+// SMTPConfig 邮件，Subject/Body 为 text/template 模板
+type SMTPConfig struct {
+	Addr     string   `json:"addr" yaml:"addr"` // host:port
+	From     string   `json:"from" yaml:"from"`
+	To       []string `json:"to" yaml:"to"`
+	Username string   `json:"username" yaml:"username"`
+	Password string   `json:"-" yaml:"password"`
+	Subject  string   `json:"subject" yaml:"subject"`
+	Body     string   `json:"body" yaml:"body"`
+}
+
+// SyslogConfig syslog，network/addr 为空时写本机 syslog
+type SyslogConfig struct {
+	Network string `json:"network" yaml:"network"` // udp/tcp
+	Addr    string `json:"addr" yaml:"addr"`
+	Tag     string `json:"tag" yaml:"tag"`
+}
+
+// JournaldConfig systemd journal 原生协议
+type JournaldConfig struct {
+	Socket     string `json:"socket" yaml:"socket"`
+	Identifier string `json:"identifier" yaml:"identifier"`
+}
+
+// SelfTestConfig 定期自检配置，周期为 0 表示不执行该类型的测试
+type SelfTestConfig struct {
+	Enabled       bool                              `json:"enabled" yaml:"enabled"`
+	ShortInterval time.Duration                     `json:"short_interval" yaml:"short_interval"`
+	LongInterval  time.Duration                     `json:"long_interval" yaml:"long_interval"`
+	CheckInterval time.Duration                     `json:"check_interval" yaml:"check_interval"` // 检查到期和轮询进度的间隔
+	Devices       map[string]SelfTestDeviceOverride `json:"devices" yaml:"devices"`               // 按设备标识或序列号覆盖周期
+}
+
+// SelfTestDeviceOverride 单个设备的自检周期，未设置的项使用全局配置
+type SelfTestDeviceOverride struct {
+	ShortInterval *time.Duration `json:"short_interval,omitempty" yaml:"short_interval"`
+	LongInterval  *time.Duration `json:"long_interval,omitempty" yaml:"long_interval"`
+}
+
+// 运行模式
+const (
+	ModeStandalone = "standalone" // 采集本机并提供界面（默认）
+	ModeAgent      = "agent"      // 只采集本机并推送到汇聚端，不保存历史、不提供界面
+	ModeAggregator = "aggregator" // 接收 agent 推送，同时采集本机并提供界面
+)
+
+// ClusterConfig 多主机监控配置
+type ClusterConfig struct {
+	Mode          string            `json:"mode" yaml:"mode"`
+	Host          string            `json:"host" yaml:"host"`                     // 本机名称，为空时使用系统主机名
+	AggregatorURL string            `json:"aggregator_url" yaml:"aggregator_url"` // agent：汇聚端地址，如 http://nas:10044
+	Token         string            `json:"-" yaml:"token"`                       // agent 推送时携带、汇聚端校验的令牌
+	HostTokens    map[string]string `json:"-" yaml:"host_tokens"`                 // 汇聚端：主机名 -> 该主机专用的令牌
+	PushInterval  time.Duration     `json:"push_interval" yaml:"push_interval"`   // agent：汇聚端不可达时的重试间隔
+	BufferSize    int               `json:"buffer_size" yaml:"buffer_size"`       // agent：本地缓冲最多保存的样本数
 }
 
 // DefaultConfig 默认配置
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Addr: ":10044",
+			Addr:            ":10044",
+			HistoryWindow:   7 * 24 * time.Hour,
+			RefreshInterval: 30 * time.Second,
 		},
 		Collector: CollectorConfig{
-			Interval: time.Hour,
-			DataDir:  "./data",
-			Enabled:  true,
+			Interval:        time.Hour,
+			DataDir:         "./data",
+			Enabled:         true,
+			Workers:         4,
+			DeviceTimeout:   2 * time.Minute,
+			SkipStandby:     true,
+			MaxStandbySkips: 24,
+		},
+		Storage: StorageConfig{
+			Backend:             BackendCSV,
+			RetentionDays:       30,
+			HourlyRetentionDays: 180,
+			DailyRetentionDays:  730,
+			RetentionInterval:   24 * time.Hour,
+		},
+		SMART: SMARTConfig{
+			USBBridgeTypes: append([]string(nil), smart.USBBridgeTypes...),
+		},
+		Thermal: smart.DefaultThermalPolicy(),
+		Health:  HealthConfig{Model: smart.HealthModelLegacy},
+		Trend:   trend.DefaultConfig(),
+		Alerts:  AlertsConfig{ResolveAfter: alert.DefaultResolveAfter},
+		Notifications: NotificationsConfig{
+			Retry: RetryConfig{
+				MaxAttempts:    10,
+				InitialBackoff: 30 * time.Second,
+				MaxBackoff:     time.Hour,
+			},
+		},
+		SelfTest: SelfTestConfig{
+			Enabled:       true,
+			ShortInterval: 24 * time.Hour,
+			LongInterval:  30 * 24 * time.Hour,
+			CheckInterval: 5 * time.Minute,
+		},
+		Cluster: ClusterConfig{
+			Mode:         ModeStandalone,
+			PushInterval: time.Minute,
+			BufferSize:   10000,
 		},
 	}
 }
 
+// Load 在默认配置上叠加配置文件（path 为空时只返回默认配置）
+func Load(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	// 拒绝未知字段，避免拼写错误被静默忽略
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
 // Validate 验证配置
 func (c *Config) Validate() error {
+	var errs []error
+
 	if c.Server.Addr == "" {
-		c.Server.Addr = ":10044"
+		errs = append(errs, errors.New("server.addr must not be empty"))
+	}
+	if c.Server.HistoryWindow <= 0 {
+		errs = append(errs, fmt.Errorf("server.history_window must be positive, got %v", c.Server.HistoryWindow))
+	}
+	if c.Server.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("server.refresh_interval must not be negative, got %v", c.Server.RefreshInterval))
 	}
 	if c.Collector.Interval <= 0 {
-		c.Collector.Interval = time.Hour
+		errs = append(errs, fmt.Errorf("collector.interval must be positive, got %v", c.Collector.Interval))
 	}
 	if c.Collector.DataDir == "" {
-		c.Collector.DataDir = "./data"
+		errs = append(errs, errors.New("collector.data_dir must not be empty"))
+	}
+	if c.Collector.Workers < 1 {
+		errs = append(errs, fmt.Errorf("collector.workers must be at least 1, got %d", c.Collector.Workers))
+	}
+	if c.Collector.DeviceTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("collector.device_timeout must be positive, got %v", c.Collector.DeviceTimeout))
+	}
+	if c.Collector.MaxStandbySkips < 0 {
+		errs = append(errs, fmt.Errorf("collector.max_standby_skips must not be negative, got %d", c.Collector.MaxStandbySkips))
+	}
+	if c.Storage.Backend != BackendCSV && c.Storage.Backend != BackendSQLite {
+		errs = append(errs, fmt.Errorf("storage.backend must be %s or %s, got %q", BackendCSV, BackendSQLite, c.Storage.Backend))
+	}
+	if c.Storage.RetentionDays < 1 {
+		errs = append(errs, fmt.Errorf("storage.retention_days must be at least 1, got %d", c.Storage.RetentionDays))
+	}
+	if c.Storage.HourlyRetentionDays < c.Storage.RetentionDays {
+		errs = append(errs, fmt.Errorf("storage.hourly_retention_days (%d) must not be less than storage.retention_days (%d)", c.Storage.HourlyRetentionDays, c.Storage.RetentionDays))
+	}
+	if c.Storage.DailyRetentionDays < c.Storage.HourlyRetentionDays {
+		errs = append(errs, fmt.Errorf("storage.daily_retention_days (%d) must not be less than storage.hourly_retention_days (%d)", c.Storage.DailyRetentionDays, c.Storage.HourlyRetentionDays))
+	}
+	if c.Storage.RetentionInterval <= 0 {
+		errs = append(errs, fmt.Errorf("storage.retention_interval must be positive, got %v", c.Storage.RetentionInterval))
+	}
+	if len(c.SMART.USBBridgeTypes) == 0 {
+		errs = append(errs, errors.New("smart.usb_bridge_types must not be empty"))
+	}
+	for key, bridgeType := range c.SMART.USBBridgePins {
+		if _, err := filepath.Match(key, ""); key == "" || err != nil {
+			errs = append(errs, fmt.Errorf("smart.usb_bridge_pins: invalid device %q", key))
+		}
+		if bridgeType == "" || strings.ContainsAny(bridgeType, " \t") {
+			errs = append(errs, fmt.Errorf("smart.usb_bridge_pins: invalid type %q for %s", bridgeType, key))
+		}
+	}
+	if c.SMART.ReplayDir != "" && c.SMART.RecordDir != "" {
+		errs = append(errs, errors.New("smart.replay_dir and smart.record_dir are mutually exclusive"))
+	}
+	for _, pattern := range append(append([]string{}, c.Devices.Include...), c.Devices.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("devices: invalid pattern %q: %w", pattern, err))
+		}
+	}
+	errs = append(errs, validateThermal(&c.Thermal)...)
+	if _, err := smart.NewHealthModel(c.Health.Model); err != nil {
+		errs = append(errs, fmt.Errorf("health.model: %w", err))
+	}
+	if err := c.Trend.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("trend: %w", err))
+	}
+	errs = append(errs, c.Alerts.validate()...)
+	errs = append(errs, c.Notifications.validate()...)
+	errs = append(errs, c.SelfTest.validate()...)
+	errs = append(errs, c.Cluster.validate()...)
+
+	return errors.Join(errs...)
+}
+
+// validateThermal 验证温度策略：阈值为正且 warm 低于 critical，设备归入的类别必须存在
+func validateThermal(p *smart.ThermalPolicy) []error {
+	var errs []error
+	for class, limits := range p.Classes {
+		if limits.Warm <= 0 || limits.Critical <= limits.Warm {
+			errs = append(errs, fmt.Errorf("thermal.classes.%s: need 0 < warm < critical, got warm %d critical %d", class, limits.Warm, limits.Critical))
+		}
+	}
+	for device, class := range p.Devices {
+		if _, err := filepath.Match(device, ""); err != nil {
+			errs = append(errs, fmt.Errorf("thermal.devices: invalid pattern %q: %w", device, err))
+		}
+		if _, ok := p.Classes[class]; !ok {
+			errs = append(errs, fmt.Errorf("thermal.devices.%s: unknown class %q", device, class))
+		}
+	}
+	return errs
+}
+
+// validate 验证告警规则配置
+func (a *AlertsConfig) validate() []error {
+	var errs []error
+	if a.ResolveAfter < 0 {
+		errs = append(errs, fmt.Errorf("alerts.resolve_after must not be negative, got %v", a.ResolveAfter))
 	}
-	return nil
-}
\ No newline at end of file
+	names := make(map[string]bool)
+	for i := range a.Rules {
+		rule := &a.Rules[i]
+		if err := rule.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("alerts.rules[%d]: %w", i, err))
+		}
+		if rule.Name != "" && names[rule.Name] {
+			errs = append(errs, fmt.Errorf("alerts.rules[%d]: duplicate rule name %q", i, rule.Name))
+		}
+		names[rule.Name] = true
+	}
+	return errs
+}
+
+// validate 验证通知配置
+func (n *NotificationsConfig) validate() []error {
+	errs := n.Retry.validate("notifications.retry")
+
+	names := make(map[string]bool)
+	for i, ch := range n.Channels {
+		prefix := fmt.Sprintf("notifications.channels[%d]", i)
+		if ch.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name must not be empty", prefix))
+		} else if names[ch.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate channel name %q", prefix, ch.Name))
+		}
+		names[ch.Name] = true
+
+		if !notify.ValidSeverity(ch.MinSeverity) {
+			errs = append(errs, fmt.Errorf("%s.min_severity: unknown severity %q", prefix, ch.MinSeverity))
+		}
+		if ch.Retry != nil {
+			errs = append(errs, ch.Retry.validate(prefix+".retry")...)
+		}
+
+		switch ch.Type {
+		case ChannelWebhook:
+			if ch.Webhook == nil || ch.Webhook.URL == "" {
+				errs = append(errs, fmt.Errorf("%s.webhook.url must not be empty", prefix))
+			}
+		case ChannelSMTP:
+			if ch.SMTP == nil || ch.SMTP.Addr == "" || ch.SMTP.From == "" || len(ch.SMTP.To) == 0 {
+				errs = append(errs, fmt.Errorf("%s.smtp: addr, from and to are required", prefix))
+			}
+		case ChannelSyslog, ChannelJournald:
+		default:
+			errs = append(errs, fmt.Errorf("%s.type: unknown channel type %q", prefix, ch.Type))
+		}
+	}
+
+	return errs
+}
+
+// validate 验证自检配置
+func (s *SelfTestConfig) validate() []error {
+	var errs []error
+	if s.ShortInterval < 0 {
+		errs = append(errs, fmt.Errorf("selftest.short_interval must not be negative, got %v", s.ShortInterval))
+	}
+	if s.LongInterval < 0 {
+		errs = append(errs, fmt.Errorf("selftest.long_interval must not be negative, got %v", s.LongInterval))
+	}
+	if s.CheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("selftest.check_interval must be positive, got %v", s.CheckInterval))
+	}
+	for serial, d := range s.Devices {
+		if d.ShortInterval != nil && *d.ShortInterval < 0 {
+			errs = append(errs, fmt.Errorf("selftest.devices[%s].short_interval must not be negative, got %v", serial, *d.ShortInterval))
+		}
+		if d.LongInterval != nil && *d.LongInterval < 0 {
+			errs = append(errs, fmt.Errorf("selftest.devices[%s].long_interval must not be negative, got %v", serial, *d.LongInterval))
+		}
+	}
+	return errs
+}
+
+// validate 验证多主机监控配置
+func (c *ClusterConfig) validate() []error {
+	var errs []error
+	switch c.Mode {
+	case ModeStandalone:
+	case ModeAgent:
+		if c.AggregatorURL == "" {
+			errs = append(errs, errors.New("cluster.aggregator_url must not be empty in agent mode"))
+		}
+		if c.Token == "" {
+			errs = append(errs, errors.New("cluster.token must not be empty in agent mode"))
+		}
+	case ModeAggregator:
+		if c.Token == "" && len(c.HostTokens) == 0 {
+			errs = append(errs, errors.New("cluster.token or cluster.host_tokens must be set in aggregator mode"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cluster.mode: unknown mode %q", c.Mode))
+	}
+	for host, token := range c.HostTokens {
+		if token == "" {
+			errs = append(errs, fmt.Errorf("cluster.host_tokens.%s must not be empty", host))
+		}
+	}
+	if c.PushInterval <= 0 {
+		errs = append(errs, fmt.Errorf("cluster.push_interval must be positive, got %v", c.PushInterval))
+	}
+	if c.BufferSize < 1 {
+		errs = append(errs, fmt.Errorf("cluster.buffer_size must be at least 1, got %d", c.BufferSize))
+	}
+	return errs
+}
+
+// validate 验证重试策略
+func (r *RetryConfig) validate(prefix string) []error {
+	var errs []error
+	if r.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("%s.max_attempts must be at least 1, got %d", prefix, r.MaxAttempts))
+	}
+	if r.InitialBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("%s.initial_backoff must be positive, got %v", prefix, r.InitialBackoff))
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		errs = append(errs, fmt.Errorf("%s.max_backoff must not be less than initial_backoff", prefix))
+	}
+	return errs
+}
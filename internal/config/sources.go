@@ -0,0 +1,258 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix 环境变量前缀
+const envPrefix = "SMARTCAT_"
+
+// setting 一个可以通过环境变量和命令行参数覆盖的配置项
+type setting struct {
+	flag  string // 命令行参数名；环境变量为 SMARTCAT_ + 大写并把 - 换成 _
+	usage string
+	set   func(c *Config, v string) error
+}
+
+// settings 可覆盖的配置项，环境变量和命令行参数共用同一张表
+var settings = []setting{
+	{"addr", "HTTP 监听地址", func(c *Config, v string) error {
+		c.Server.Addr = v
+		return nil
+	}},
+	{"history-window", "历史查询默认时间窗口，如 168h", func(c *Config, v string) error {
+		return setDuration(&c.Server.HistoryWindow, v)
+	}},
+	{"refresh-interval", "?refresh=true 实时读取同一设备的最小间隔，如 30s", func(c *Config, v string) error {
+		return setDuration(&c.Server.RefreshInterval, v)
+	}},
+	{"interval", "采集间隔，如 30m", func(c *Config, v string) error {
+		return setDuration(&c.Collector.Interval, v)
+	}},
+	{"data-dir", "历史数据目录", func(c *Config, v string) error {
+		c.Collector.DataDir = v
+		return nil
+	}},
+	{"collector-enabled", "是否启用后台采集", func(c *Config, v string) error {
+		return setBool(&c.Collector.Enabled, v)
+	}},
+	{"workers", "并发采集的设备数", func(c *Config, v string) error {
+		return setInt(&c.Collector.Workers, v)
+	}},
+	{"device-timeout", "单个设备的采集超时，如 2m", func(c *Config, v string) error {
+		return setDuration(&c.Collector.DeviceTimeout, v)
+	}},
+	{"skip-standby", "设备待机时跳过读取，不唤醒硬盘", func(c *Config, v string) error {
+		return setBool(&c.Collector.SkipStandby, v)
+	}},
+	{"max-standby-skips", "连续因待机跳过多少次后强制读取一次，0 表示不强制", func(c *Config, v string) error {
+		return setInt(&c.Collector.MaxStandbySkips, v)
+	}},
+	{"retention-days", "原始采样保留天数，之后汇总为小时数据", func(c *Config, v string) error {
+		return setInt(&c.Storage.RetentionDays, v)
+	}},
+	{"hourly-retention-days", "小时数据保留天数，之后汇总为天数据", func(c *Config, v string) error {
+		return setInt(&c.Storage.HourlyRetentionDays, v)
+	}},
+	{"daily-retention-days", "天数据保留天数", func(c *Config, v string) error {
+		return setInt(&c.Storage.DailyRetentionDays, v)
+	}},
+	{"storage-backend", "历史数据存储后端：csv 或 sqlite（数据目录中的 smartcat.db，可用 migrate 导入 CSV）", func(c *Config, v string) error {
+		c.Storage.Backend = v
+		return nil
+	}},
+	{"retention-interval", "执行保留策略的间隔，如 24h", func(c *Config, v string) error {
+		return setDuration(&c.Storage.RetentionInterval, v)
+	}},
+	{"selftest-enabled", "是否定期执行 SMART 自检", func(c *Config, v string) error {
+		return setBool(&c.SelfTest.Enabled, v)
+	}},
+	{"selftest-short-interval", "短自检周期，如 24h，0 表示不执行", func(c *Config, v string) error {
+		return setDuration(&c.SelfTest.ShortInterval, v)
+	}},
+	{"selftest-long-interval", "长自检周期，如 720h，0 表示不执行", func(c *Config, v string) error {
+		return setDuration(&c.SelfTest.LongInterval, v)
+	}},
+	{"mode", "运行模式：standalone、agent 或 aggregator", func(c *Config, v string) error {
+		c.Cluster.Mode = v
+		return nil
+	}},
+	{"host", "本机名称，多主机监控时区分各主机，默认为系统主机名", func(c *Config, v string) error {
+		c.Cluster.Host = v
+		return nil
+	}},
+	{"aggregator-url", "agent 模式下汇聚端的地址，如 http://nas:10044", func(c *Config, v string) error {
+		c.Cluster.AggregatorURL = v
+		return nil
+	}},
+	{"token", "agent 推送和汇聚端校验使用的令牌", func(c *Config, v string) error {
+		c.Cluster.Token = v
+		return nil
+	}},
+	{"push-interval", "agent 在汇聚端不可达时的重试间隔，如 1m", func(c *Config, v string) error {
+		return setDuration(&c.Cluster.PushInterval, v)
+	}},
+	{"health-model", "健康度模型：legacy、backblaze、ssd_endurance、nvme 或 auto（按设备类型选择）", func(c *Config, v string) error {
+		c.Health.Model = v
+		return nil
+	}},
+	{"trend-window", "预测剩余天数时拟合增长率使用的历史窗口，如 720h", func(c *Config, v string) error {
+		return setDuration(&c.Trend.Window, v)
+	}},
+	{"usb-bridge-types", "依次尝试的 USB 桥接类型，分号分隔（类型本身可以带逗号，如 sat,12），空项表示自动", func(c *Config, v string) error {
+		types := strings.Split(v, bridgeSeparator)
+		for i := range types {
+			types[i] = strings.TrimSpace(types[i])
+		}
+		c.SMART.USBBridgeTypes = types
+		return nil
+	}},
+	{"usb-bridge-pins", "固定的 USB 桥接类型，分号分隔的 设备=类型，设备为设备标识或路径 glob，如 sdb=sat,12;wwn-0x5000c500a1b2c3d4=sntjmicron", func(c *Config, v string) error {
+		pins := make(map[string]string)
+		for _, item := range strings.Split(v, bridgeSeparator) {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			device, bridgeType, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("expected device=type, got %q", item)
+			}
+			pins[strings.TrimSpace(device)] = strings.TrimSpace(bridgeType)
+		}
+		c.SMART.USBBridgePins = pins
+		return nil
+	}},
+	{"replay", "回放目录：从录制的 smartctl -j 输出读取数据，不调用真实 smartctl", func(c *Config, v string) error {
+		c.SMART.ReplayDir = v
+		return nil
+	}},
+	{"record", "录制目录：把真实 smartctl 输出保存为可回放的文件", func(c *Config, v string) error {
+		c.SMART.RecordDir = v
+		return nil
+	}},
+	{"include", "只采集匹配的设备，逗号分隔的 glob", func(c *Config, v string) error {
+		c.Devices.Include = splitList(v)
+		return nil
+	}},
+	{"exclude", "跳过匹配的设备，逗号分隔的 glob", func(c *Config, v string) error {
+		c.Devices.Exclude = splitList(v)
+		return nil
+	}},
+}
+
+// envName 返回配置项对应的环境变量名
+func (s setting) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.flag, "-", "_"))
+}
+
+// ApplyEnv 用 SMARTCAT_* 环境变量覆盖配置
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, s := range settings {
+		v, ok := lookup(s.envName())
+		if !ok {
+			continue
+		}
+		if err := s.set(c, v); err != nil {
+			return fmt.Errorf("%s: %w", s.envName(), err)
+		}
+	}
+	return nil
+}
+
+// RegisterFlags 在 FlagSet 上注册 -config 和所有配置项参数
+func RegisterFlags(fs *flag.FlagSet) *string {
+	configPath := fs.String("config", "", "配置文件路径（YAML），也可用 SMARTCAT_CONFIG 指定")
+	for _, s := range settings {
+		fs.String(s.flag, "", s.usage+"（环境变量 "+s.envName()+"）")
+	}
+	return configPath
+}
+
+// ApplyFlags 用命令行中显式设置的参数覆盖配置
+func (c *Config) ApplyFlags(fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		for _, s := range settings {
+			if s.flag == f.Name {
+				if setErr := s.set(c, f.Value.String()); setErr != nil {
+					err = fmt.Errorf("-%s: %w", f.Name, setErr)
+				}
+				return
+			}
+		}
+	})
+	return err
+}
+
+// FromFlags 按 配置文件 → 环境变量 → 命令行参数 的顺序加载并验证配置。
+// fs 必须已经通过 RegisterFlags 注册并完成 Parse
+func FromFlags(fs *flag.FlagSet, configPath string) (*Config, error) {
+	if configPath == "" {
+		configPath = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.ApplyFlags(fs); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
+
+// bridgeSeparator 桥接类型列表的分隔符；-d 类型本身可以带逗号（sat,12），所以不用逗号
+const bridgeSeparator = ";"
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
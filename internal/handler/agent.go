@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"smart-cat/internal/service"
+)
+
+// maxPushBody 单次推送请求体的上限
+const maxPushBody = 64 << 20
+
+// AgentHandler 汇聚端接收 agent 推送的处理器
+type AgentHandler struct {
+	*Handler
+	aggregator *service.Aggregator
+	token      string
+	hostTokens map[string]string
+}
+
+// NewAgentHandler 创建 agent 处理器
+//
+// token 为所有主机共用的令牌，hostTokens 为主机名到该主机专用令牌的映射。
+// 列在 hostTokens 中的主机只能用自己的令牌推送，其他主机使用共用令牌。
+func NewAgentHandler(handler *Handler, aggregator *service.Aggregator, token string, hostTokens map[string]string) *AgentHandler {
+	return &AgentHandler{Handler: handler, aggregator: aggregator, token: token, hostTokens: hostTokens}
+}
+
+// HandlePush 处理 POST /api/v1/agent/push，请求头 Authorization: Bearer <token>
+func (h *AgentHandler) HandlePush(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="smart-cat"`)
+		h.respondError(w, r, newError(http.StatusUnauthorized, CodeUnauthorized, "invalid token"))
+		return
+	}
+
+	var req service.PushRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushBody)).Decode(&req); err != nil {
+		h.respondError(w, r, badRequest("invalid push body: %v", err))
+		return
+	}
+	if !service.ValidHostName(req.Host) {
+		h.respondError(w, r, badRequest("invalid host name"))
+		return
+	}
+	if !h.authorized(req.Host, token) {
+		h.respondError(w, r, newError(http.StatusForbidden, CodeForbidden, "token not allowed for host %s", req.Host))
+		return
+	}
+
+	accepted, err := h.aggregator.Ingest(req.Host, r.RemoteAddr, req.Samples)
+	if err != nil {
+		log.Printf("Failed to ingest push from %s: %v", req.Host, err)
+		h.respondError(w, r, err)
+		return
+	}
+
+	h.respondJSON(w, service.PushResponse{Accepted: accepted})
+}
+
+// HandleHosts 返回推送过数据的主机
+func (h *AgentHandler) HandleHosts(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, h.aggregator.Hosts())
+}
+
+// authenticate 取出 Bearer 令牌，令牌必须是共用令牌或某台主机的令牌，未配置令牌时拒绝所有推送
+func (h *AgentHandler) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	if tokenEqual(token, h.token) {
+		return token, true
+	}
+	for _, t := range h.hostTokens {
+		if tokenEqual(token, t) {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// authorized 检查令牌能否推送该主机的数据
+func (h *AgentHandler) authorized(host, token string) bool {
+	if want, ok := h.hostTokens[host]; ok {
+		return tokenEqual(token, want)
+	}
+	return tokenEqual(token, h.token)
+}
+
+// tokenEqual 以恒定时间比较令牌，空令牌不匹配任何令牌
+func tokenEqual(token, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
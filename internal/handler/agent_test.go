@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"smart-cat/internal/service"
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+)
+
+func TestAgentPushTokens(t *testing.T) {
+	aggregator, err := service.NewAggregator(t.TempDir(), func(dir string) (storage.Storage, error) {
+		return storage.NewCSVStorage(dir)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewAgentHandler(NewHandler(nil, nil), aggregator, "shared", map[string]string{"box1": "box1-token"})
+	rt := NewRouter(http.NotFoundHandler())
+	rt.Handle(Route{Method: http.MethodPost, Path: service.PushPath, Handler: h.HandlePush})
+
+	device := smart.Device{Name: "/dev/sda", Serial: "AAA"}
+	ts := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	push := func(host, token string) (int, string) {
+		body, err := json.Marshal(service.PushRequest{Host: host, Samples: []service.Sample{{
+			Device:    device,
+			Timestamp: ts,
+			State:     smart.PowerStateActive,
+			Data:      &smart.SMARTData{Device: device, Timestamp: ts, SmartStatus: "PASSED"},
+		}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, service.PushPath, bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, req)
+
+		var resp errorBody
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Error.Code
+	}
+
+	tests := []struct {
+		host, token string
+		status      int
+		code        string
+	}{
+		{"box1", "box1-token", http.StatusOK, ""},
+		{"box1", "shared", http.StatusForbidden, CodeForbidden},
+		{"box2", "shared", http.StatusOK, ""},
+		{"box2", "box1-token", http.StatusForbidden, CodeForbidden},
+		{"box2", "wrong", http.StatusUnauthorized, CodeUnauthorized},
+		{"box2", "", http.StatusUnauthorized, CodeUnauthorized},
+	}
+	for _, tt := range tests {
+		status, code := push(tt.host, tt.token)
+		if status != tt.status || code != tt.code {
+			t.Errorf("push %s with %q = %d %q, want %d %q", tt.host, tt.token, status, code, tt.status, tt.code)
+		}
+	}
+
+	if hosts := aggregator.Hosts(); len(hosts) != 2 || hosts[0].Samples != 1 || hosts[1].Samples != 1 {
+		t.Errorf("Hosts = %+v, want one sample from each host", hosts)
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"smart-cat/internal/alert"
+)
+
+// AlertHandler 告警相关处理器
+type AlertHandler struct {
+	*Handler
+}
+
+// NewAlertHandler 创建告警处理器
+func NewAlertHandler(handler *Handler) *AlertHandler {
+	return &AlertHandler{Handler: handler}
+}
+
+// HandleAlerts 获取告警列表，支持 ?state=firing|resolved
+func (h *AlertHandler) HandleAlerts(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state != "" && state != alert.StateFiring && state != alert.StateResolved {
+		h.respondError(w, r, badRequest("invalid state %q", state))
+		return
+	}
+
+	h.respondJSON(w, h.alertEngine.List(state))
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smart-cat/internal/service"
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+)
+
+const clusterToken = "cluster-secret"
+
+// testCluster 进程内的汇聚端，使用真实的 API 路由和 agent 处理器，offline 时所有请求返回 503
+type testCluster struct {
+	aggregator *service.Aggregator
+	server     *httptest.Server
+	offline    atomic.Bool
+}
+
+func newTestCluster(t *testing.T) *testCluster {
+	t.Helper()
+	aggregator, err := service.NewAggregator(t.TempDir(), func(dir string) (storage.Storage, error) {
+		return storage.NewCSVStorage(dir)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 汇聚端本机没有硬盘：扫描结果为空，并排除 /dev 下的所有块设备
+	fixtures := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fixtures, "scan.json"), []byte(`{"devices":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	detector := smart.NewDeviceDetectorWithRunner(smart.NewReplayRunner(fixtures))
+	detector.SetDeviceFilter(nil, []string{"*"})
+	local, err := storage.NewCSVStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceService := service.NewDeviceService(detector, local)
+	deviceService.SetAggregator(aggregator, "nas")
+
+	h := NewHandler(deviceService, nil)
+	api := NewAPI(Handlers{
+		Device: NewDeviceHandler(h, embed.FS{}),
+		Agent:  NewAgentHandler(h, aggregator, clusterToken, nil),
+	}, http.NotFoundHandler())
+
+	c := &testCluster{aggregator: aggregator}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.offline.Load() {
+			http.Error(w, "offline", http.StatusServiceUnavailable)
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func (c *testCluster) agent(t *testing.T, host, token, path string) *service.Agent {
+	t.Helper()
+	agent, err := service.NewAgent(service.AgentConfig{ServerURL: c.server.URL, Token: token, Host: host, BatchSize: 2}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent
+}
+
+func (c *testCluster) host(t *testing.T, name string) service.HostInfo {
+	t.Helper()
+	for _, h := range c.aggregator.Hosts() {
+		if h.Name == name {
+			return h
+		}
+	}
+	t.Fatalf("host %s not found in %+v", name, c.aggregator.Hosts())
+	return service.HostInfo{}
+}
+
+// get 请求 API 并解析 JSON 响应
+func (c *testCluster) get(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	resp, err := http.Get(c.server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+}
+
+// history 查询设备在指定主机上的历史记录
+func (c *testCluster) history(t *testing.T, host, serial string) []smart.HistoryRecord {
+	t.Helper()
+	var records []smart.HistoryRecord
+	c.get(t, fmt.Sprintf("%s/devices/%s/history?host=%s", APIPrefix, url.PathEscape(serial), url.QueryEscape(host)), &records)
+	return records
+}
+
+func activeSample(serial string, ts time.Time, temperature int) service.Sample {
+	device := smart.Device{Name: "/dev/sda", Serial: serial, Model: "TEST DISK", DeviceType: "HDD"}
+	return service.Sample{
+		Device:    device,
+		Timestamp: ts,
+		State:     smart.PowerStateActive,
+		Data:      &smart.SMARTData{Device: device, Timestamp: ts, SmartStatus: "PASSED", Temperature: temperature},
+	}
+}
+
+func flush(t *testing.T, agent *service.Agent) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return agent.Flush(ctx)
+}
+
+func TestAgentsPushToAggregator(t *testing.T) {
+	cluster := newTestCluster(t)
+	dir := t.TempDir()
+	box1 := cluster.agent(t, "box1", clusterToken, filepath.Join(dir, "box1.json"))
+	box2 := cluster.agent(t, "box2", clusterToken, filepath.Join(dir, "box2.json"))
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		box1.Enqueue(activeSample("AAA", start.Add(time.Duration(i)*time.Minute), 30+i))
+		box2.Enqueue(activeSample("BBB", start.Add(time.Duration(i)*time.Minute), 40+i))
+	}
+	for _, agent := range []*service.Agent{box1, box2} {
+		if err := flush(t, agent); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		if n := agent.Pending(); n != 0 {
+			t.Errorf("Pending = %d after flush, want 0", n)
+		}
+	}
+
+	if h := cluster.host(t, "box1"); h.Samples != 3 || h.Devices != 1 {
+		t.Errorf("box1 = %+v, want 3 samples of 1 device", h)
+	}
+	if h := cluster.host(t, "box2"); h.Samples != 3 || h.Devices != 1 {
+		t.Errorf("box2 = %+v, want 3 samples of 1 device", h)
+	}
+
+	// 设备列表带上各设备所在的主机
+	var devices []smart.DeviceInfo
+	cluster.get(t, APIPrefix+"/devices", &devices)
+	if len(devices) != 2 || devices[0].Host != "box1" || devices[0].Serial != "AAA" ||
+		devices[1].Host != "box2" || devices[1].Serial != "BBB" {
+		t.Fatalf("GET /devices = %+v, want AAA on box1 and BBB on box2", devices)
+	}
+	var data smart.SMARTData
+	cluster.get(t, APIPrefix+"/devices/BBB?host=box2", &data)
+	if data.Temperature != 42 {
+		t.Errorf("BBB on box2 temperature = %d, want the latest sample", data.Temperature)
+	}
+
+	// 令牌错误的 agent 推送失败，样本留在缓冲中
+	intruder := cluster.agent(t, "box3", "wrong", filepath.Join(dir, "box3.json"))
+	intruder.Enqueue(activeSample("CCC", start, 50))
+	if err := flush(t, intruder); err == nil {
+		t.Error("Flush with a wrong token succeeded")
+	}
+	if n := intruder.Pending(); n != 1 {
+		t.Errorf("Pending = %d after a rejected push, want 1", n)
+	}
+
+	// 汇聚端不可达时样本留在缓冲中，重启 agent 后仍在
+	cluster.offline.Store(true)
+	box1.Enqueue(activeSample("AAA", start.Add(3*time.Minute), 33))
+	box1.Enqueue(activeSample("AAA", start.Add(4*time.Minute), 34))
+	if err := flush(t, box1); err == nil {
+		t.Fatal("Flush succeeded while the aggregator is offline")
+	}
+	if n := box1.Pending(); n != 2 {
+		t.Fatalf("Pending = %d while offline, want 2", n)
+	}
+	box1 = cluster.agent(t, "box1", clusterToken, filepath.Join(dir, "box1.json"))
+	if n := box1.Pending(); n != 2 {
+		t.Fatalf("Pending = %d after restart, want 2", n)
+	}
+
+	cluster.offline.Store(false)
+	if err := flush(t, box1); err != nil {
+		t.Fatalf("Flush after reconnect: %v", err)
+	}
+	if h := cluster.host(t, "box1"); h.Samples != 5 {
+		t.Errorf("box1 samples = %d after reconnect, want 5", h.Samples)
+	}
+
+	// 重复推送的样本被忽略
+	box1.Enqueue(activeSample("AAA", start.Add(4*time.Minute), 34))
+	if err := flush(t, box1); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if h := cluster.host(t, "box1"); h.Samples != 5 {
+		t.Errorf("box1 samples = %d after a duplicate push, want 5", h.Samples)
+	}
+
+	// 历史记录按主机分开
+	if history := cluster.history(t, "box1", "AAA"); len(history) != 5 || history[4].Temperature != 34 {
+		t.Errorf("AAA history on box1 = %+v, want 5 records", history)
+	}
+	if history := cluster.history(t, "box2", "BBB"); len(history) != 3 {
+		t.Errorf("BBB history on box2 has %d records, want 3", len(history))
+	}
+	if history := cluster.history(t, "box1", "BBB"); len(history) != 0 {
+		t.Errorf("box2 samples stored under box1: %+v", history)
+	}
+}
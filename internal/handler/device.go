@@ -3,6 +3,7 @@ package handler
 import (
 	"embed"
 	"net/http"
+	"strconv"
 )
 
 // DeviceHandler 设备相关处理器
@@ -36,59 +37,94 @@ func (h *DeviceHandler) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// HandleDevices 获取设备列表
+// HandleDevices 获取设备列表，默认从快照缓存返回，?refresh=true 时重新列出并实时读取
 func (h *DeviceHandler) HandleDevices(w http.ResponseWriter, r *http.Request) {
-	devices, err := h.deviceService.GetAllDevices()
+	refresh, err := parseRefresh(r)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, err.Error())
+		h.respondError(w, r, err)
+		return
+	}
+
+	devices, err := h.deviceService.GetAllDevices(r.Context(), refresh)
+	if err != nil {
+		h.respondError(w, r, err)
 		return
 	}
 
 	h.respondJSON(w, devices)
 }
 
-// HandleSmart 获取指定设备的实时 SMART 数据
+// HandleSmart 获取指定设备的 SMART 数据，默认从快照缓存返回，?refresh=true 时实时读取；
+// ?host= 指定其他主机时返回 agent 最近一次推送的数据
 func (h *DeviceHandler) HandleSmart(w http.ResponseWriter, r *http.Request) {
-	deviceName := parseDevicePath(r)
-	if deviceName == "" {
-		h.respondError(w, http.StatusBadRequest, "device name required")
+	refresh, err := parseRefresh(r)
+	if err != nil {
+		h.respondError(w, r, err)
 		return
 	}
 
-	data, err := h.deviceService.GetSMARTData(deviceName)
+	data, err := h.deviceService.GetHostSMARTData(r.Context(), r.URL.Query().Get("host"), PathParam(r, "id"), refresh)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, err.Error())
+		h.respondError(w, r, err)
 		return
 	}
 
 	h.respondJSON(w, data)
 }
 
-// HandleHistory 获取历史数据
+// HandleHistory 获取历史数据，?host= 指定设备所在主机
 func (h *DeviceHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
-	serial := parseSerialPath(r)
-	if serial == "" {
-		h.respondError(w, http.StatusBadRequest, "serial number required")
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+
+	records, err := h.deviceService.GetHostHistory(r.URL.Query().Get("host"), PathParam(r, "id"), from, to)
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+
+	h.respondJSON(w, records)
+}
+
+// HandleAttributeHistory 获取单个 SMART 属性的历史数据
+func (h *DeviceHandler) HandleAttributeHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(PathParam(r, "attr"))
+	if err != nil || id <= 0 || id > 255 {
+		h.respondError(w, r, badRequest("invalid attribute id"))
 		return
 	}
 
 	from, to, err := parseTimeRange(r)
 	if err != nil {
-		if fromStr := r.URL.Query().Get("from"); fromStr != "" {
-			h.respondError(w, http.StatusBadRequest, "invalid from time format")
-			return
-		}
-		if toStr := r.URL.Query().Get("to"); toStr != "" {
-			h.respondError(w, http.StatusBadRequest, "invalid to time format")
-			return
-		}
+		h.respondError(w, r, err)
+		return
 	}
 
-	records, err := h.deviceService.GetHistory(serial, from, to)
+	records, err := h.deviceService.GetHostAttributeHistory(r.URL.Query().Get("host"), PathParam(r, "id"), id, from, to)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, err.Error())
+		h.respondError(w, r, err)
 		return
 	}
 
 	h.respondJSON(w, records)
-}
\ No newline at end of file
+}
+
+// HandleTemperature 获取设备的温度曲线：SCT 温度历史和保存的采样合并，每个点带温度状态
+func (h *DeviceHandler) HandleTemperature(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+
+	history, err := h.deviceService.GetTemperatureHistory(r.URL.Query().Get("host"), PathParam(r, "id"), from, to)
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+
+	h.respondJSON(w, history)
+}
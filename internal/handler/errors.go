@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"smart-cat/internal/service"
+	"smart-cat/internal/smart"
+)
+
+// 错误码，与 HTTP 状态码一起返回，客户端按错误码区分同一状态码下的不同原因
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeDeviceNotFound   = "device_not_found"
+	CodeHostNotFound     = "host_not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeBusy             = "busy"
+	CodeInternal         = "internal"
+	CodeUnavailable      = "unavailable"
+	CodeSmartctlMissing  = "smartctl_unavailable"
+	CodeTimeout          = "timeout"
+)
+
+// APIError 带状态码和错误码的 API 错误
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error 实现 error 接口
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// newError 创建 API 错误
+func newError(status int, code, format string, args ...interface{}) *APIError {
+	return &APIError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// badRequest 创建 400 错误
+func badRequest(format string, args ...interface{}) *APIError {
+	return newError(http.StatusBadRequest, CodeBadRequest, format, args...)
+}
+
+// apiError 把服务层的错误转换为 API 错误
+func apiError(err error) *APIError {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, smart.ErrDeviceNotFound), errors.Is(err, smart.ErrFixtureNotFound):
+		return newError(http.StatusNotFound, CodeDeviceNotFound, "%v", err)
+	case errors.Is(err, service.ErrUnknownHost):
+		return newError(http.StatusNotFound, CodeHostNotFound, "%v", err)
+	case errors.Is(err, smart.ErrDeviceBusy), errors.Is(err, service.ErrSelfTestBusy):
+		return newError(http.StatusConflict, CodeBusy, "%v", err)
+	case errors.Is(err, smart.ErrSmartctlNotFound):
+		return newError(http.StatusServiceUnavailable, CodeSmartctlMissing, "%v", err)
+	case errors.Is(err, smart.ErrStandby), errors.Is(err, service.ErrRefreshLimited):
+		return newError(http.StatusServiceUnavailable, CodeUnavailable, "%v", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return newError(http.StatusGatewayTimeout, CodeTimeout, "%v", err)
+	default:
+		return newError(http.StatusInternalServerError, CodeInternal, "%v", err)
+	}
+}
+
+// errorBody /api/v1 的错误响应体
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+// errorDetail 错误详情，request_id 与响应头 X-Request-ID 相同，便于对照服务端日志
+type errorDetail struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeError 返回错误响应：/api/v1 返回带错误码的结构，旧路径保持 {"error": "..."} 的格式
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := apiError(err)
+	rc := routeContextFrom(r)
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %d %s", rc.requestID, r.Method, r.URL.Path, e.Status, e.Message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	if rc.legacy {
+		json.NewEncoder(w).Encode(map[string]string{"error": e.Message})
+		return
+	}
+	json.NewEncoder(w).Encode(errorBody{Error: errorDetail{
+		Code:      e.Code,
+		Message:   e.Message,
+		RequestID: rc.requestID,
+	}})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-cat/internal/service"
+)
+
+// eventsHeartbeat 没有事件时发送注释行的间隔，避免反向代理因空闲断开连接
+const eventsHeartbeat = 30 * time.Second
+
+// EventsHandler 事件流处理器
+type EventsHandler struct {
+	*Handler
+	bus *service.EventBus
+}
+
+// NewEventsHandler 创建事件流处理器
+func NewEventsHandler(handler *Handler, bus *service.EventBus) *EventsHandler {
+	return &EventsHandler{Handler: handler, bus: bus}
+}
+
+// HandleEvents 处理 GET /api/v1/events，以 Server-Sent Events 推送事件
+//
+// 断线重连时浏览器的 EventSource 会自动带上 Last-Event-ID，从缓冲中续传之后的事件；
+// 要求的事件已不在缓冲中时先发送一条 resync 事件，客户端应重新拉取完整状态。
+// ?types= 以逗号分隔只订阅部分事件类型。
+func (h *EventsHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.respondError(w, r, newError(http.StatusInternalServerError, CodeInternal, "streaming not supported"))
+		return
+	}
+
+	lastID, err := parseLastEventID(r)
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+	var types map[string]bool
+	if v := r.URL.Query().Get("types"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	sub, backlog, complete := h.bus.Subscribe(lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx 不缓冲
+	w.WriteHeader(http.StatusOK)
+
+	send := func(ev service.Event) error {
+		if types != nil && !types[ev.Type] && ev.Type != service.EventResync {
+			return nil
+		}
+		return writeEvent(w, ev)
+	}
+
+	if !complete {
+		if err := writeEvent(w, service.Event{Type: service.EventResync, Time: time.Now()}); err != nil {
+			return
+		}
+	}
+	for _, ev := range backlog {
+		if err := send(ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				// 处理太慢被断开，客户端重连后从 Last-Event-ID 续传
+				return
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// parseLastEventID 读取续传位置：请求头 Last-Event-ID，或 ?last_event_id=（首次连接时 EventSource 无法设置请求头）
+func parseLastEventID(r *http.Request) (uint64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, badRequest("invalid Last-Event-ID %q", v)
+	}
+	return id, nil
+}
+
+// writeEvent 按 SSE 格式写入一条事件，没有 ID 的事件（resync）不更新客户端的 Last-Event-ID
+func writeEvent(w http.ResponseWriter, ev service.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if ev.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
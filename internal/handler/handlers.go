@@ -3,50 +3,42 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
+	"smart-cat/internal/alert"
 	"smart-cat/internal/service"
 )
 
 // Handler HTTP处理器集合
 type Handler struct {
 	deviceService *service.DeviceService
+	alertEngine   *alert.Engine
 }
 
 // NewHandler 创建处理器
-func NewHandler(deviceService *service.DeviceService) *Handler {
+func NewHandler(deviceService *service.DeviceService, alertEngine *alert.Engine) *Handler {
 	return &Handler{
 		deviceService: deviceService,
+		alertEngine:   alertEngine,
 	}
 }
 
 // respondJSON 返回 JSON 响应
 func (h *Handler) respondJSON(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(data)
-}
-
-// respondError 返回错误响应
-func (h *Handler) respondError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": message,
-	})
+	writeJSON(w, http.StatusOK, data)
 }
 
-// parseDevicePath 从URL路径解析设备名称
-func parseDevicePath(r *http.Request) string {
-	path := strings.TrimPrefix(r.URL.Path, "/api/smart/")
-	// URL decode
-	path = strings.ReplaceAll(path, "%2F", "/")
-	return path
+// respondError 返回错误响应，状态码和错误码由错误类型决定（见 apiError）
+func (h *Handler) respondError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err)
 }
 
-// parseSerialPath 从URL路径解析序列号
-func parseSerialPath(r *http.Request) string {
-	return strings.TrimPrefix(r.URL.Path, "/api/history/")
+// writeJSON 以指定状态码返回 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
 }
 
 // parseTimeRange 解析时间范围参数
@@ -57,16 +49,29 @@ func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
 	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
 		from, err = time.Parse(time.RFC3339, fromStr)
 		if err != nil {
-			return time.Time{}, time.Time{}, err
+			return time.Time{}, time.Time{}, badRequest("invalid from time format")
 		}
 	}
 
 	if toStr := r.URL.Query().Get("to"); toStr != "" {
 		to, err = time.Parse(time.RFC3339, toStr)
 		if err != nil {
-			return time.Time{}, time.Time{}, err
+			return time.Time{}, time.Time{}, badRequest("invalid to time format")
 		}
 	}
 
 	return from, to, nil
-}
\ No newline at end of file
+}
+
+// parseRefresh 解析 ?refresh=，为 true 时绕过快照缓存实时读取
+func parseRefresh(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("refresh")
+	if v == "" {
+		return false, nil
+	}
+	refresh, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, badRequest("invalid refresh %q", v)
+	}
+	return refresh, nil
+}
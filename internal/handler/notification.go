@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+
+	"smart-cat/internal/notify"
+)
+
+// NotificationHandler 通知相关处理器
+type NotificationHandler struct {
+	*Handler
+	dispatcher *notify.Dispatcher
+}
+
+// NewNotificationHandler 创建通知处理器
+func NewNotificationHandler(handler *Handler, dispatcher *notify.Dispatcher) *NotificationHandler {
+	return &NotificationHandler{Handler: handler, dispatcher: dispatcher}
+}
+
+// channelView 渠道信息（不含凭据）
+type channelView struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	MinSeverity string `json:"min_severity,omitempty"`
+}
+
+// notificationsView 通知渠道和发件箱
+type notificationsView struct {
+	Channels []channelView     `json:"channels"`
+	Pending  []notify.Delivery `json:"pending"`
+}
+
+// HandleNotifications 列出通知渠道和发件箱中待发送的通知
+func (h *NotificationHandler) HandleNotifications(w http.ResponseWriter, r *http.Request) {
+	channels := []channelView{}
+	for _, ch := range h.dispatcher.Channels() {
+		channels = append(channels, channelView{Name: ch.Name, Type: ch.Type, MinSeverity: ch.MinSeverity})
+	}
+
+	h.respondJSON(w, notificationsView{
+		Channels: channels,
+		Pending:  h.dispatcher.Pending(),
+	})
+}
+
+// HandleTest 立即向渠道发送测试通知，支持 ?channel=name 只测试一个渠道；
+// 有渠道失败时返回 502，响应体中是每个渠道的结果
+func (h *NotificationHandler) HandleTest(w http.ResponseWriter, r *http.Request) {
+	results, err := h.dispatcher.Test(r.Context(), r.URL.Query().Get("channel"))
+	if err != nil {
+		h.respondError(w, r, newError(http.StatusNotFound, CodeNotFound, "%v", err))
+		return
+	}
+	if results == nil {
+		results = []notify.TestResult{}
+	}
+
+	status := http.StatusOK
+	for _, result := range results {
+		if !result.OK {
+			status = http.StatusBadGateway
+		}
+	}
+
+	writeJSON(w, status, results)
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPI 根据已注册的路由生成 OpenAPI 3.0 文档，请求体和响应体的 schema 由 Go 类型的 json 标签反射得到
+func (rt *Router) OpenAPI() map[string]interface{} {
+	gen := &schemaGen{schemas: make(map[string]interface{})}
+	errorSchema := gen.schema(reflect.TypeOf(errorBody{}))
+
+	paths := make(map[string]map[string]interface{})
+	for _, route := range rt.routes {
+		path := strings.ReplaceAll(route.Path, "...}", "}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = gen.operation(route, errorSchema)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "smart-cat API",
+			"version":     "v1",
+			"description": "每个响应都带 X-Request-ID 头，错误响应体中的 request_id 与之相同。旧路径（/api/ 下非 /api/v1 的路径）是兼容别名，已弃用。",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": gen.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// HandleOpenAPI 返回 OpenAPI 文档
+func (rt *Router) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, rt.OpenAPI())
+}
+
+// operation 生成一条路由的 OpenAPI operation
+func (g *schemaGen) operation(route *Route, errorSchema map[string]interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary":     route.Summary,
+		"operationId": operationID(route),
+	}
+	if route.Deprecated {
+		op["deprecated"] = true
+		op["description"] = "已弃用，请使用 " + route.Successor
+	}
+	if route.Auth {
+		op["security"] = []map[string][]string{{"bearer": {}}}
+	}
+
+	// 路径参数按路由路径中出现的顺序列出，说明取自 Params
+	descriptions := make(map[string]Param)
+	for _, p := range route.Params {
+		descriptions[p.In+":"+p.Name] = p
+	}
+	var params []map[string]interface{}
+	for _, s := range route.segments {
+		name, ok := strings.CutPrefix(s, "{")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "}"), "...")
+		p := descriptions["path:"+name]
+		p.Name, p.In, p.Required = name, "path", true
+		params = append(params, parameter(p))
+	}
+	for _, p := range route.Params {
+		if p.In == "query" {
+			params = append(params, parameter(p))
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if route.Request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(g.schema(reflect.TypeOf(route.Request))),
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if route.Response != nil {
+		contentType := route.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		success["content"] = map[string]interface{}{
+			contentType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(route.Response))},
+		}
+	}
+	responses := map[string]interface{}{strconv.Itoa(status): success}
+	for _, code := range route.Errors {
+		responses[strconv.Itoa(code)] = map[string]interface{}{
+			"description": http.StatusText(code),
+			"content":     jsonContent(errorSchema),
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// operationID 由方法和路径生成唯一的 operationId
+func operationID(route *Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.Method))
+	for _, s := range route.segments {
+		s = strings.Trim(s, "{}.")
+		for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == '_' || r == '-' }) {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// parameter 生成 OpenAPI parameter
+func parameter(p Param) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	param := map[string]interface{}{
+		"name":     p.Name,
+		"in":       p.In,
+		"required": p.Required,
+		"schema":   schema,
+	}
+	if p.Description != "" {
+		param["description"] = p.Description
+	}
+	return param
+}
+
+// jsonContent 生成 application/json 的 content
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// schemaGen 把 Go 类型转换为 JSON schema，命名的结构体放入 components/schemas 并以 $ref 引用
+type schemaGen struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// schema 返回类型的 schema
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "纳秒"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := g.schemas[name]; !ok {
+			// 先占位，结构体引用自身时不会无限递归
+			g.schemas[name] = nil
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object 按 json 标签生成结构体的 object schema，匿名嵌入的结构体字段展开到外层
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	g.fields(t, properties, &required)
+	sort.Strings(required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fields 收集结构体的字段
+func (g *schemaGen) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, properties, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
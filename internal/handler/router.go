@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIPrefix 当前版本 API 的路径前缀
+const APIPrefix = "/api/v1"
+
+// Param 路由的路径参数或查询参数，用于生成 OpenAPI 文档
+type Param struct {
+	Name        string
+	In          string // path/query
+	Description string
+	Required    bool
+	Enum        []string
+}
+
+// Route 一条路由
+//
+// Path 中的 {name} 匹配一个路径段，{name...} 只能出现在末尾，匹配剩余的全部路径；
+// 每个路径段先按 URL 编码解码再匹配，设备路径 /dev/sda 可以编码为 %2Fdev%2Fsda 放在一个路径段中。
+type Route struct {
+	Method      string
+	Path        string
+	Summary     string
+	Params      []Param     // 路径参数的说明和查询参数
+	Request     interface{} // 请求体类型的零值，用于生成 OpenAPI 文档
+	Response    interface{} // 响应体类型的零值，用于生成 OpenAPI 文档
+	Status      int         // 成功时的状态码，默认 200
+	ContentType string      // 成功时的响应类型，默认 application/json
+	Errors      []int       // 可能返回的错误状态码
+	Auth        bool        // 需要 Authorization: Bearer 令牌
+	Handler     http.HandlerFunc
+
+	Deprecated bool   // 旧路径的兼容别名
+	Successor  string // 别名对应的 /api/v1 路径
+
+	segments []string
+}
+
+// Router API 路由：按方法和路径参数分发，路径存在但方法不对时返回 405，
+// 每个请求分配一个请求 ID（X-Request-ID），不属于 /api/ 的请求交给 fallback
+type Router struct {
+	routes   []*Route
+	fallback http.Handler
+}
+
+// NewRouter 创建路由，fallback 处理首页、/metrics 等非 API 路径
+func NewRouter(fallback http.Handler) *Router {
+	return &Router{fallback: fallback}
+}
+
+// Handle 注册路由
+func (rt *Router) Handle(route Route) {
+	route.segments = splitPath(route.Path)
+	rt.routes = append(rt.routes, &route)
+}
+
+// Alias 把旧路径注册为已注册路由 method target 的兼容别名，两者的路径参数名必须相同
+//
+// 别名的响应头带 Deprecation 和指向新路径的 Link，错误响应保持旧的 {"error": "..."} 格式。
+func (rt *Router) Alias(method, path, target string) {
+	for _, r := range rt.routes {
+		if r.Method == method && r.Path == target {
+			alias := *r
+			alias.Path = path
+			alias.Deprecated = true
+			alias.Successor = target
+			rt.Handle(alias)
+			return
+		}
+	}
+	panic("alias target not registered: " + method + " " + target)
+}
+
+// Routes 返回所有已注册的路由
+func (rt *Router) Routes() []Route {
+	routes := make([]Route, 0, len(rt.routes))
+	for _, r := range rt.routes {
+		routes = append(routes, *r)
+	}
+	return routes
+}
+
+// ServeHTTP 实现 http.Handler
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := &routeContext{requestID: requestID(r)}
+	w.Header().Set("X-Request-ID", rc.requestID)
+	r = r.WithContext(context.WithValue(r.Context(), routeContextKey{}, rc))
+
+	segments := splitPath(r.URL.EscapedPath())
+	var allowed []string
+	for _, route := range rt.routes {
+		params, ok := matchPath(route.segments, segments)
+		if !ok {
+			continue
+		}
+		if route.Method != r.Method {
+			allowed = append(allowed, route.Method)
+			continue
+		}
+
+		rc.params = params
+		if route.Deprecated {
+			rc.legacy = true
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+expandPath(route.Successor, params)+`>; rel="successor-version"`)
+		}
+		route.Handler(w, r)
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, newError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method %s not allowed", r.Method))
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") || rt.fallback == nil {
+		writeError(w, r, newError(http.StatusNotFound, CodeNotFound, "no route for %s", r.URL.Path))
+		return
+	}
+	rt.fallback.ServeHTTP(w, r)
+}
+
+// routeContextKey 请求 context 中路由信息的键
+type routeContextKey struct{}
+
+// routeContext 路由匹配的结果
+type routeContext struct {
+	requestID string
+	params    map[string]string
+	legacy    bool // 通过旧路径访问
+}
+
+// routeContextFrom 返回请求的路由信息，不经过 Router 的请求返回空值
+func routeContextFrom(r *http.Request) *routeContext {
+	if rc, ok := r.Context().Value(routeContextKey{}).(*routeContext); ok {
+		return rc
+	}
+	return &routeContext{legacy: true}
+}
+
+// PathParam 返回路径参数（已解码）
+func PathParam(r *http.Request, name string) string {
+	return routeContextFrom(r).params[name]
+}
+
+// RequestID 返回请求 ID
+func RequestID(r *http.Request) string {
+	return routeContextFrom(r).requestID
+}
+
+// requestID 沿用客户端或反向代理传入的 X-Request-ID，没有或不合法时生成一个
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); validRequestID(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID 请求 ID 会写入日志和响应头，只接受较短的字母、数字和 . _ -
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// splitPath 把路径拆分为路径段，保留空段
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// matchPath 用路由的路径段匹配请求的路径段（未解码），返回解码后的路径参数
+func matchPath(pattern, segments []string) (map[string]string, bool) {
+	var params map[string]string
+	for i, p := range pattern {
+		name, isParam := strings.CutPrefix(p, "{")
+		if !isParam {
+			if i >= len(segments) || segments[i] != p {
+				return nil, false
+			}
+			continue
+		}
+		name = strings.TrimSuffix(name, "}")
+
+		var value string
+		if rest, ok := strings.CutSuffix(name, "..."); ok {
+			if i >= len(segments) {
+				return nil, false
+			}
+			name = rest
+			parts := make([]string, 0, len(segments)-i)
+			for _, s := range segments[i:] {
+				part, err := url.PathUnescape(s)
+				if err != nil {
+					return nil, false
+				}
+				parts = append(parts, part)
+			}
+			value = strings.Join(parts, "/")
+			segments = segments[:i+1]
+		} else {
+			if i >= len(segments) {
+				return nil, false
+			}
+			v, err := url.PathUnescape(segments[i])
+			if err != nil {
+				return nil, false
+			}
+			value = v
+		}
+		if value == "" {
+			return nil, false
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = value
+	}
+	if len(segments) != len(pattern) {
+		return nil, false
+	}
+	return params, true
+}
+
+// expandPath 用路径参数填充路由路径
+func expandPath(path string, params map[string]string) string {
+	segments := splitPath(path)
+	for i, s := range segments {
+		name, ok := strings.CutPrefix(s, "{")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "}"), "...")
+		segments[i] = url.PathEscape(params[name])
+	}
+	return "/" + strings.Join(segments, "/")
+}
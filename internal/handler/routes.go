@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"net/http"
+
+	"smart-cat/internal/alert"
+	"smart-cat/internal/notify"
+	"smart-cat/internal/service"
+	"smart-cat/internal/smart"
+)
+
+// Handlers 注册到 API 路由的处理器，Agent 为 nil 时不注册汇聚端的路由
+type Handlers struct {
+	Device       *DeviceHandler
+	Alert        *AlertHandler
+	Notification *NotificationHandler
+	SelfTest     *SelfTestHandler
+	Events       *EventsHandler
+	Agent        *AgentHandler
+}
+
+// 路由中重复使用的参数
+var (
+	paramID   = Param{Name: "id", In: "path", Description: "设备标识，也接受序列号或 URL 编码的设备路径（%2Fdev%2Fsda）"}
+	paramHost = Param{Name: "host", In: "query", Description: "设备所在主机，汇聚模式下使用，默认本机"}
+	paramFrom = Param{Name: "from", In: "query", Description: "起始时间（RFC3339），默认为历史查询窗口的起点"}
+	paramTo   = Param{Name: "to", In: "query", Description: "结束时间（RFC3339），默认为当前时间"}
+
+	paramRefresh = Param{Name: "refresh", In: "query", Description: "为 true 时绕过快照缓存实时读取，同一设备在 refresh_interval 内只实时读取一次"}
+)
+
+// NewAPI 创建 API 路由：/api/v1 下的资源路由，以及旧路径的兼容别名；其他路径交给 fallback
+func NewAPI(hs Handlers, fallback http.Handler) *Router {
+	rt := NewRouter(fallback)
+
+	rt.Handle(Route{
+		Method:   http.MethodGet,
+		Path:     APIPrefix + "/devices",
+		Summary:  "列出设备，默认从快照缓存返回",
+		Params:   []Param{paramRefresh},
+		Response: []smart.DeviceInfo{},
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+		Handler:  hs.Device.HandleDevices,
+	})
+	rt.Handle(Route{
+		Method:   http.MethodGet,
+		Path:     APIPrefix + "/devices/{id}",
+		Summary:  "设备的 SMART 数据，默认从快照缓存返回，其他主机的设备返回 agent 最近一次推送的数据",
+		Params:   []Param{paramID, paramHost, paramRefresh},
+		Response: service.Snapshot{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		Handler: hs.Device.HandleSmart,
+	})
+	rt.Handle(Route{
+		Method:   http.MethodGet,
+		Path:     APIPrefix + "/devices/{id}/history",
+		Summary:  "设备的历史记录",
+		Params:   []Param{paramID, paramHost, paramFrom, paramTo},
+		Response: []smart.HistoryRecord{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		Handler:  hs.Device.HandleHistory,
+	})
+	rt.Handle(Route{
+		Method:  http.MethodGet,
+		Path:    APIPrefix + "/devices/{id}/attributes/{attr}/history",
+		Summary: "单个 SMART 属性的历史记录",
+		Params: []Param{paramID, {Name: "attr", In: "path", Description: "ATA 属性 ID（1-255）"},
+			paramHost, paramFrom, paramTo},
+		Response: []smart.AttributeRecord{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		Handler:  hs.Device.HandleAttributeHistory,
+	})
+	rt.Handle(Route{
+		Method:   http.MethodGet,
+		Path:     APIPrefix + "/devices/{id}/temperature",
+		Summary:  "设备的温度曲线：硬盘记录的 SCT 温度历史与保存的采样合并，每个点按设备类别的阈值判定 ok/warm/critical",
+		Params:   []Param{paramID, paramHost, paramFrom, paramTo},
+		Response: service.TemperatureHistory{},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+		Handler:  hs.Device.HandleTemperature,
+	})
+	rt.Handle(Route{
+		Method:   http.MethodGet,
+		Path:     APIPrefix + "/devices/{id}/selftests",
+		Summary:  "设备的自检计划、运行中的测试和自检日志",
+		Params:   []Param{paramID},
+		Response: service.SelfTestInfo{},
+		Errors:   []int{http.StatusNotFound, http.StatusServiceUnavailable},
+		Handler:  hs.SelfTest.HandleDevice,
+	})
+	rt.Handle(Route{
+		Method:  http.MethodPost,
+		Path:    APIPrefix + "/devices/{id}/selftests",
+		Summary: "立即启动一次自检",
+		Params: []Param{paramID, {Name: "type", In: "query", Description: "测试类型，默认 short",
+			Enum: []string{smart.SelfTestShort, smart.SelfTestLong}}},
+		Response: service.SelfTestInfo{},
+		Status:   http.StatusAccepted,
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict,
+			http.StatusInternalServerError, http.StatusServiceUnavailable},
+		Handler: hs.SelfTest.HandleStart,
+	})
+	rt.Handle(Route{
+		Method:  http.MethodGet,
+		Path:    APIPrefix + "/alerts",
+		Summary: "告警列表",
+		Params: []Param{{Name: "state", In: "query", Description: "只返回指定状态的告警",
+			Enum: []string{alert.StateFiring, alert.StateResolved}}},
+		Response: []alert.Alert{},
+		Errors:   []int{http.StatusBadRequest},
+		Handler:  hs.Alert.HandleAlerts,
+	})
+	rt.Handle(Route{
+		Method:   http.MethodGet,
+		Path:     APIPrefix + "/notifications",
+		Summary:  "通知渠道和发件箱中待发送的通知",
+		Response: notificationsView{},
+		Handler:  hs.Notification.HandleNotifications,
+	})
+	rt.Handle(Route{
+		Method:   http.MethodPost,
+		Path:     APIPrefix + "/notifications/test",
+		Summary:  "立即向渠道发送测试通知，有渠道失败时返回 502，响应体同样是每个渠道的结果",
+		Params:   []Param{{Name: "channel", In: "query", Description: "只测试指定渠道"}},
+		Response: []notify.TestResult{},
+		Errors:   []int{http.StatusNotFound},
+		Handler:  hs.Notification.HandleTest,
+	})
+	rt.Handle(Route{
+		Method:  http.MethodGet,
+		Path:    APIPrefix + "/events",
+		Summary: "事件流（Server-Sent Events），断线重连时用 Last-Event-ID 续传",
+		Params: []Param{
+			{Name: "types", In: "query", Description: "以逗号分隔，只订阅这些事件类型"},
+			{Name: "last_event_id", In: "query", Description: "续传位置，与请求头 Last-Event-ID 相同"},
+		},
+		Response:    service.Event{},
+		ContentType: "text/event-stream",
+		Errors:      []int{http.StatusBadRequest},
+		Handler:     hs.Events.HandleEvents,
+	})
+	if hs.Agent != nil {
+		rt.Handle(Route{
+			Method:   http.MethodGet,
+			Path:     APIPrefix + "/hosts",
+			Summary:  "推送过数据的 agent 主机",
+			Response: []service.HostInfo{},
+			Handler:  hs.Agent.HandleHosts,
+		})
+		rt.Handle(Route{
+			Method:   http.MethodPost,
+			Path:     service.PushPath,
+			Summary:  "agent 推送采集样本",
+			Request:  service.PushRequest{},
+			Response: service.PushResponse{},
+			Auth:     true,
+			Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError},
+			Handler:  hs.Agent.HandlePush,
+		})
+	}
+	rt.Handle(Route{
+		Method:  http.MethodGet,
+		Path:    APIPrefix + "/openapi.json",
+		Summary: "本文档",
+		Handler: rt.HandleOpenAPI,
+	})
+
+	// 旧路径，保留给已有的脚本和旧版本的 agent
+	rt.Alias(http.MethodGet, "/api/devices", APIPrefix+"/devices")
+	rt.Alias(http.MethodGet, "/api/smart/{id...}", APIPrefix+"/devices/{id}")
+	rt.Alias(http.MethodGet, "/api/history/{id}", APIPrefix+"/devices/{id}/history")
+	rt.Alias(http.MethodGet, "/api/history/{id}/attributes/{attr}", APIPrefix+"/devices/{id}/attributes/{attr}/history")
+	rt.Alias(http.MethodGet, "/api/devices/{id}/selftests", APIPrefix+"/devices/{id}/selftests")
+	rt.Alias(http.MethodGet, "/api/alerts", APIPrefix+"/alerts")
+	rt.Alias(http.MethodGet, "/api/notifications", APIPrefix+"/notifications")
+	rt.Alias(http.MethodPost, "/api/notifications/test", APIPrefix+"/notifications/test")
+	if hs.Agent != nil {
+		rt.Alias(http.MethodGet, "/api/hosts", APIPrefix+"/hosts")
+		rt.Alias(http.MethodPost, "/api/agent/push", service.PushPath)
+	}
+
+	return rt
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+
+	"smart-cat/internal/service"
+	"smart-cat/internal/smart"
+)
+
+// SelfTestHandler 自检相关处理器
+type SelfTestHandler struct {
+	*Handler
+	scheduler *service.SelfTestScheduler // 为 nil 表示未启用自检调度
+}
+
+// NewSelfTestHandler 创建自检处理器
+func NewSelfTestHandler(handler *Handler, scheduler *service.SelfTestScheduler) *SelfTestHandler {
+	return &SelfTestHandler{Handler: handler, scheduler: scheduler}
+}
+
+// errDisabled 未启用自检调度
+var errDisabled = newError(http.StatusServiceUnavailable, CodeUnavailable, "self-test scheduling is disabled")
+
+// HandleDevice 处理 GET /api/v1/devices/{id}/selftests，返回自检周期、下一次时间、
+// 运行中测试的进度、调度器启动过的测试和设备自检日志
+func (h *SelfTestHandler) HandleDevice(w http.ResponseWriter, r *http.Request) {
+	if h.scheduler == nil {
+		h.respondError(w, r, errDisabled)
+		return
+	}
+
+	id := PathParam(r, "id")
+	info, ok := h.scheduler.Get(id)
+	if !ok {
+		h.respondError(w, r, newError(http.StatusNotFound, CodeDeviceNotFound, "no self-test data for %s", id))
+		return
+	}
+	h.respondJSON(w, info)
+}
+
+// HandleStart 处理 POST /api/v1/devices/{id}/selftests?type=short|long，立即启动一次测试；
+// 设备或同一硬盘柜中已有测试在运行时返回 409
+func (h *SelfTestHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	if h.scheduler == nil {
+		h.respondError(w, r, errDisabled)
+		return
+	}
+
+	testType := r.URL.Query().Get("type")
+	if testType == "" {
+		testType = smart.SelfTestShort
+	}
+	if testType != smart.SelfTestShort && testType != smart.SelfTestLong {
+		h.respondError(w, r, badRequest("invalid self-test type %q", testType))
+		return
+	}
+
+	info, err := h.scheduler.Start(r.Context(), PathParam(r, "id"), testType)
+	if err != nil {
+		h.respondError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, info)
+}
@@ -0,0 +1,454 @@
+package identity
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-cat/internal/smart"
+	"smart-cat/pkg/osutils"
+)
+
+// 标识来源，按优先级从高到低
+const (
+	SourceWWN         = "wwn"         // World Wide Name（ATA/SAS）
+	SourceByID        = "by-id"       // /dev/disk/by-id 中的 ata-/nvme-/scsi- 链接
+	SourceEUI64       = "eui64"       // NVMe 命名空间 EUI-64
+	SourceNGUID       = "nguid"       // NVMe 命名空间 NGUID
+	SourceSerial      = "serial"      // 型号 + 序列号
+	SourceBridge      = "bridge"      // /dev/disk/by-id 中的 usb- 链接，标识的是桥接芯片而不是硬盘
+	SourceFingerprint = "fingerprint" // 型号、固件、容量和接口位置的哈希
+)
+
+// saveInterval 只有 LastSeen 变化时最多每隔这么久写一次文件
+const saveInterval = time.Hour
+
+// Identity 一个已识别的设备
+type Identity struct {
+	ID         string    `json:"id"`
+	Source     string    `json:"source"` // 生成 ID 时使用的标识来源
+	Keys       []string  `json:"keys"`   // 见过的所有标识，如 wwn:0x5000c500a1b2c3d4、serial:型号/序列号
+	Model      string    `json:"model"`
+	Serial     string    `json:"serial"`
+	Device     string    `json:"device"`                // 最近一次出现的设备路径
+	BridgeType string    `json:"bridge_type,omitempty"` // 最近一次读取成功的 -d 类型，auto 表示不带 -d
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// candidate 从设备信息中得到的一个标识
+type candidate struct {
+	source string
+	key    string // 注册表中的键
+	id     string // 以它为准时生成的 ID，与 /dev/disk/by-id 的命名一致
+}
+
+// Resolver 设备标识解析器，实现 smart.IdentityResolver
+//
+// 每次读到设备时收集它的全部标识（WWN、by-id、EUI64/NGUID、型号+序列号），
+// 任一标识已经登记过就沿用原来的 ID，并把新出现的标识补充进去；都没有登记过时
+// 以优先级最高的标识生成新 ID。这样即使后来多了更好的标识（比如容器里挂载了
+// /dev/disk），同一块硬盘的 ID 也不会变。
+//
+// 没有任何可靠标识时只按指纹匹配；桥接芯片的 usb- 链接可能被不同硬盘共用，只记录不匹配。
+type Resolver struct {
+	path   string
+	byID   func(device string) []string
+	byPath func(device string) string
+
+	mu         sync.Mutex
+	identities map[string]*Identity // ID -> 设备
+	keys       map[string]string    // 标识 -> ID
+	savedAt    time.Time
+	onCreate   []func(Identity)
+}
+
+// NewResolver 创建解析器，path 为注册表文件路径（为空则不持久化）
+func NewResolver(path string) (*Resolver, error) {
+	r := &Resolver{
+		path:       path,
+		byID:       osutils.DiskByID,
+		byPath:     osutils.DiskByPath,
+		identities: make(map[string]*Identity),
+		keys:       make(map[string]string),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OnCreate 注册新设备登记时的回调（用于迁移以序列号命名的旧数据）
+func (r *Resolver) OnCreate(fn func(Identity)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onCreate = append(r.onCreate, fn)
+}
+
+// Resolve 实现 smart.IdentityResolver
+func (r *Resolver) Resolve(device *smart.Device) {
+	cands, bridges := r.candidates(device)
+	now := time.Now()
+
+	r.mu.Lock()
+	var ident *Identity
+	for _, c := range cands {
+		if id, ok := r.keys[c.key]; ok {
+			ident = r.identities[id]
+			break
+		}
+	}
+
+	created := ident == nil
+	changed := created
+	if created {
+		ident = &Identity{
+			ID:        r.uniqueID(cands[0].id),
+			Source:    cands[0].source,
+			FirstSeen: now,
+		}
+		r.identities[ident.ID] = ident
+	}
+
+	for _, c := range cands {
+		if _, taken := r.keys[c.key]; !taken {
+			r.keys[c.key] = ident.ID
+			ident.Keys = append(ident.Keys, c.key)
+			changed = true
+		}
+	}
+	// 桥接链接标识的是硬盘柜的位置，不用来匹配设备，只记录最近一次插在这里的设备（LookupBridge 使用）
+	for _, c := range bridges {
+		if r.keys[c.key] != ident.ID {
+			r.moveKey(c.key, ident)
+			changed = true
+		}
+	}
+	if device.Model != "" && device.Model != ident.Model {
+		ident.Model = device.Model
+		changed = true
+	}
+	if validSerial(device.Serial) && device.Serial != ident.Serial {
+		ident.Serial = device.Serial
+		changed = true
+	}
+	if device.Name != ident.Device {
+		ident.Device = device.Name
+		changed = true
+	}
+	ident.LastSeen = now
+	device.ID = ident.ID
+
+	var err error
+	if changed || now.Sub(r.savedAt) >= saveInterval {
+		err = r.save()
+		r.savedAt = now
+	}
+	result := *ident
+	callbacks := r.onCreate
+	r.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save device identities: %v", err)
+	}
+	if created {
+		log.Printf("New device identity %s (%s) for %s", result.ID, result.Source, device.Name)
+		for _, fn := range callbacks {
+			fn(result)
+		}
+	}
+}
+
+// Lookup 按 ID、序列号或设备路径查找设备
+func (r *Resolver) Lookup(key string) (Identity, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ident, ok := r.identities[key]; ok {
+		return *ident, true
+	}
+
+	// 序列号和设备路径可能对应多个设备，取最近出现的
+	var found *Identity
+	for _, ident := range r.identities {
+		if ident.Serial != key && ident.Device != key && ident.Device != "/dev/"+key {
+			continue
+		}
+		if found == nil || ident.LastSeen.After(found.LastSeen) {
+			found = ident
+		}
+	}
+	if found == nil {
+		return Identity{}, false
+	}
+	return *found, true
+}
+
+// LookupBridge 实现 smart.BridgeMemory：根据设备路径的 by-id 链接找到设备，
+// 没有链接（macOS、未挂载 /dev/disk 的容器）时取最近一次出现在这个路径的设备
+func (r *Resolver) LookupBridge(devicePath string) (id, bridgeType string, ok bool) {
+	links := r.byID(devicePath)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ident *Identity
+	for _, link := range links {
+		for _, key := range linkKeys(link) {
+			if id, found := r.keys[key]; found {
+				ident = r.identities[id]
+				break
+			}
+		}
+		if ident != nil {
+			break
+		}
+	}
+	if ident == nil {
+		for _, candidate := range r.identities {
+			if candidate.Device != devicePath {
+				continue
+			}
+			if ident == nil || candidate.LastSeen.After(ident.LastSeen) {
+				ident = candidate
+			}
+		}
+	}
+	if ident == nil {
+		return "", "", false
+	}
+	return ident.ID, ident.BridgeType, ident.BridgeType != ""
+}
+
+// RememberBridge 实现 smart.BridgeMemory，类型变化时写入注册表
+func (r *Resolver) RememberBridge(id, bridgeType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ident, ok := r.identities[id]
+	if !ok || ident.BridgeType == bridgeType {
+		return
+	}
+	if ident.BridgeType != "" {
+		log.Printf("Device %s now reads with -d %s (was %s)", id, bridgeType, ident.BridgeType)
+	}
+	ident.BridgeType = bridgeType
+	if err := r.save(); err != nil {
+		log.Printf("Failed to save device identities: %v", err)
+	}
+	r.savedAt = time.Now()
+}
+
+// linkKeys 返回 by-id 链接对应的注册表键，wwn-/nvme-eui. 链接登记为 WWN 和 EUI64/NGUID
+func linkKeys(link string) []string {
+	if wwn, ok := strings.CutPrefix(link, "wwn-"); ok {
+		return []string{"wwn:" + wwn}
+	}
+	if eui, ok := strings.CutPrefix(link, "nvme-eui."); ok {
+		return []string{"eui64:" + eui, "nguid:" + eui}
+	}
+	return []string{"by-id:" + link}
+}
+
+// List 返回所有登记的设备
+func (r *Resolver) List() []Identity {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]Identity, 0, len(r.identities))
+	for _, ident := range r.identities {
+		list = append(list, *ident)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// moveKey 把标识转给 ident，从原来的设备上删除，调用方持有锁
+func (r *Resolver) moveKey(key string, ident *Identity) {
+	if prev, ok := r.identities[r.keys[key]]; ok {
+		for i, k := range prev.Keys {
+			if k == key {
+				prev.Keys = append(prev.Keys[:i], prev.Keys[i+1:]...)
+				break
+			}
+		}
+	}
+	r.keys[key] = ident.ID
+	ident.Keys = append(ident.Keys, key)
+}
+
+// candidates 按优先级列出用于匹配的标识，以及不参与匹配的桥接链接
+//
+// 有可靠标识时只用可靠标识；都没有时只用指纹匹配。桥接芯片的 usb- 链接跟着硬盘柜的位置走，
+// 两块没有序列号的硬盘在硬盘柜中交换位置后会互相匹配到对方，所以不参与匹配。
+func (r *Resolver) candidates(device *smart.Device) (cands, bridges []candidate) {
+	var strong, weak []candidate
+
+	if device.WWN != "" {
+		strong = append(strong, candidate{SourceWWN, "wwn:" + device.WWN, "wwn-" + device.WWN})
+	}
+	for _, link := range rankByID(r.byID(device.Name)) {
+		c := candidate{SourceByID, "by-id:" + link, link}
+		if strings.HasPrefix(link, "usb-") {
+			c.source = SourceBridge
+			weak = append(weak, c)
+		} else {
+			strong = append(strong, c)
+		}
+	}
+	if device.EUI64 != "" {
+		strong = append(strong, candidate{SourceEUI64, "eui64:" + device.EUI64, "nvme-eui." + device.EUI64})
+	}
+	if device.NGUID != "" {
+		strong = append(strong, candidate{SourceNGUID, "nguid:" + device.NGUID, "nvme-eui." + device.NGUID})
+	}
+	if validSerial(device.Serial) {
+		strong = append(strong, candidate{SourceSerial, "serial:" + device.Model + "/" + device.Serial, sanitize(device.Model + "_" + device.Serial)})
+	}
+
+	if len(strong) > 0 {
+		return strong, nil
+	}
+
+	fp := fingerprint(device, r.byPath(device.Name))
+	return []candidate{{SourceFingerprint, "fp:" + fp, "fp-" + fp}}, weak
+}
+
+// rankByID 过滤并排序 by-id 链接：wwn-/nvme-eui. 与 WWN/EUI64 重复，分区链接不是设备本身
+func rankByID(links []string) []string {
+	prefixes := []string{"ata-", "nvme-", "scsi-", "usb-"}
+	rank := func(link string) int {
+		for i, p := range prefixes {
+			if strings.HasPrefix(link, p) {
+				return i
+			}
+		}
+		return len(prefixes)
+	}
+
+	var kept []string
+	for _, link := range links {
+		if strings.HasPrefix(link, "wwn-") || strings.HasPrefix(link, "nvme-eui.") || strings.Contains(link, "-part") {
+			continue
+		}
+		kept = append(kept, link)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return rank(kept[i]) < rank(kept[j])
+	})
+	return kept
+}
+
+// fingerprint 没有任何标识时的兜底：同型号同固件同容量的硬盘只能靠接口位置区分
+func fingerprint(device *smart.Device, byPath string) string {
+	location := byPath
+	if location == "" {
+		location = device.Name
+	}
+	sum := sha1.Sum([]byte(strings.Join([]string{
+		device.Model,
+		device.Firmware,
+		strconv.FormatInt(device.CapacityGB, 10),
+		device.DeviceType,
+		location,
+	}, "|")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// validSerial 部分桥接芯片返回空序列号，读取失败的设备记为 unknown
+func validSerial(serial string) bool {
+	return serial != "" && serial != "unknown"
+}
+
+// sanitize 把 ID 中不适合作为文件名和 URL 路径的字符替换为 _
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(s))
+}
+
+// uniqueID 生成不与已有设备冲突的 ID，调用方持有锁
+func (r *Resolver) uniqueID(id string) string {
+	if _, exists := r.identities[id]; !exists {
+		return id
+	}
+	for i := 2; ; i++ {
+		next := fmt.Sprintf("%s-%d", id, i)
+		if _, exists := r.identities[next]; !exists {
+			return next
+		}
+	}
+}
+
+// load 从注册表文件恢复
+func (r *Resolver) load() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read device identities: %w", err)
+	}
+
+	var list []*Identity
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse device identities: %w", err)
+	}
+	for _, ident := range list {
+		r.identities[ident.ID] = ident
+		for _, key := range ident.Keys {
+			r.keys[key] = ident.ID
+		}
+	}
+	return nil
+}
+
+// save 写入注册表文件（先写临时文件再重命名），调用方持有锁
+func (r *Resolver) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	list := make([]*Identity, 0, len(r.identities))
+	for _, ident := range r.identities {
+		list = append(list, ident)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode device identities: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write device identities: %w", err)
+	}
+	return os.Rename(tmp, r.path)
+}
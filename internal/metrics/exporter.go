@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"smart-cat/internal/service"
+	"smart-cat/internal/smart"
+)
+
+// Exporter Prometheus /metrics 导出器
+//
+// 只读取采集器缓存的最近一次快照，抓取时不会调用 smartctl。
+type Exporter struct {
+	collector *service.Collector
+}
+
+// NewExporter 创建导出器
+func NewExporter(collector *service.Collector) *Exporter {
+	return &Exporter{collector: collector}
+}
+
+// deviceGauge 每个设备一个样本的指标
+type deviceGauge struct {
+	name  string
+	help  string
+	value func(d *smart.SMARTData) (float64, bool)
+}
+
+// nvmeGauge 构造只对 NVMe 设备有值的指标
+func nvmeGauge(name, help string, value func(h *smart.NVMeHealth) float64) deviceGauge {
+	return deviceGauge{name: name, help: help, value: func(d *smart.SMARTData) (float64, bool) {
+		if d.NVMe == nil {
+			return 0, false
+		}
+		return value(d.NVMe), true
+	}}
+}
+
+// deviceGauges 设备级指标定义
+var deviceGauges = []deviceGauge{
+	{"smartcat_device_temperature_celsius", "Current drive temperature.", func(d *smart.SMARTData) (float64, bool) { return float64(d.Temperature), true }},
+	{"smartcat_device_power_on_hours", "Power-on hours.", func(d *smart.SMARTData) (float64, bool) { return float64(d.PowerOnHours), true }},
+	{"smartcat_device_power_cycle_count", "Power cycle count.", func(d *smart.SMARTData) (float64, bool) { return float64(d.PowerCycleCount), true }},
+	{"smartcat_device_reallocated_sectors", "Reallocated sectors (SCSI: grown defects).", func(d *smart.SMARTData) (float64, bool) { return float64(d.ReallocatedSectors), true }},
+	{"smartcat_device_pending_sectors", "Current pending sectors.", func(d *smart.SMARTData) (float64, bool) { return float64(d.PendingSectors), true }},
+	{"smartcat_device_uncorrectable_errors", "Uncorrectable errors.", func(d *smart.SMARTData) (float64, bool) { return float64(d.UncorrectableErrors), true }},
+	{"smartcat_device_health_percent", "Computed health percentage.", func(d *smart.SMARTData) (float64, bool) { return float64(d.HealthPercent), true }},
+	{"smartcat_device_smart_passed", "1 if the SMART overall-health self-assessment passed.", func(d *smart.SMARTData) (float64, bool) {
+		if d.SmartStatus == "PASSED" {
+			return 1, true
+		}
+		return 0, true
+	}},
+	{"smartcat_device_snapshot_timestamp_seconds", "Unix time of the cached snapshot.", func(d *smart.SMARTData) (float64, bool) {
+		return float64(d.Timestamp.Unix()), !d.Timestamp.IsZero()
+	}},
+	nvmeGauge("smartcat_nvme_critical_warning", "NVMe critical warning bitmap.", func(h *smart.NVMeHealth) float64 { return float64(h.CriticalWarning) }),
+	nvmeGauge("smartcat_nvme_available_spare_percent", "NVMe available spare.", func(h *smart.NVMeHealth) float64 { return float64(h.AvailableSpare) }),
+	nvmeGauge("smartcat_nvme_available_spare_threshold_percent", "NVMe available spare threshold.", func(h *smart.NVMeHealth) float64 { return float64(h.AvailableSpareThreshold) }),
+	nvmeGauge("smartcat_nvme_percentage_used", "NVMe percentage of rated endurance used.", func(h *smart.NVMeHealth) float64 { return float64(h.PercentageUsed) }),
+	nvmeGauge("smartcat_nvme_data_read_bytes", "NVMe bytes read.", func(h *smart.NVMeHealth) float64 { return float64(h.BytesRead()) }),
+	nvmeGauge("smartcat_nvme_data_written_bytes", "NVMe bytes written.", func(h *smart.NVMeHealth) float64 { return float64(h.BytesWritten()) }),
+	nvmeGauge("smartcat_nvme_unsafe_shutdowns", "NVMe unsafe shutdowns.", func(h *smart.NVMeHealth) float64 { return float64(h.UnsafeShutdowns) }),
+	nvmeGauge("smartcat_nvme_media_errors", "NVMe media and data integrity errors.", func(h *smart.NVMeHealth) float64 { return float64(h.MediaErrors) }),
+	nvmeGauge("smartcat_nvme_error_log_entries", "NVMe error information log entries.", func(h *smart.NVMeHealth) float64 { return float64(h.ErrorLogEntries) }),
+}
+
+// ServeHTTP 输出 Prometheus 文本格式
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshots := e.collector.Snapshots()
+	stats := e.collector.Stats()
+	statuses := e.collector.Statuses()
+
+	var b bytes.Buffer
+
+	for _, g := range deviceGauges {
+		writeHeader(&b, g.name, g.help, "gauge")
+		for _, d := range snapshots {
+			if v, ok := g.value(d); ok {
+				writeSample(&b, g.name, deviceLabels(d), v)
+			}
+		}
+	}
+
+	// 完整 ATA 属性表
+	writeHeader(&b, "smartcat_ata_attribute_raw", "Raw value of each ATA SMART attribute.", "gauge")
+	for _, d := range snapshots {
+		for _, attr := range d.Attributes {
+			writeSample(&b, "smartcat_ata_attribute_raw", attributeLabels(d, attr), float64(attr.RawValue))
+		}
+	}
+	writeHeader(&b, "smartcat_ata_attribute_value", "Normalized value of each ATA SMART attribute.", "gauge")
+	for _, d := range snapshots {
+		for _, attr := range d.Attributes {
+			writeSample(&b, "smartcat_ata_attribute_value", attributeLabels(d, attr), float64(attr.Value))
+		}
+	}
+	writeHeader(&b, "smartcat_ata_attribute_threshold", "Failure threshold of each ATA SMART attribute.", "gauge")
+	for _, d := range snapshots {
+		for _, attr := range d.Attributes {
+			writeSample(&b, "smartcat_ata_attribute_threshold", attributeLabels(d, attr), float64(attr.Threshold))
+		}
+	}
+
+	// 采集器指标
+	writeHeader(&b, "smartcat_collector_runs_total", "Completed collection runs.", "counter")
+	writeSample(&b, "smartcat_collector_runs_total", nil, float64(stats.Runs))
+
+	writeHeader(&b, "smartcat_collector_last_run_timestamp_seconds", "Unix time the last collection run finished.", "gauge")
+	if !stats.LastRun.IsZero() {
+		writeSample(&b, "smartcat_collector_last_run_timestamp_seconds", nil, float64(stats.LastRun.Unix()))
+	}
+
+	writeHeader(&b, "smartcat_collector_last_success_timestamp_seconds", "Unix time of the last run in which every device was collected.", "gauge")
+	if !stats.LastSuccess.IsZero() {
+		writeSample(&b, "smartcat_collector_last_success_timestamp_seconds", nil, float64(stats.LastSuccess.Unix()))
+	}
+
+	writeHeader(&b, "smartcat_collector_last_duration_seconds", "Duration of the last collection run.", "gauge")
+	writeSample(&b, "smartcat_collector_last_duration_seconds", nil, stats.LastDuration.Seconds())
+
+	writeHeader(&b, "smartcat_collector_device_errors_total", "Failed collections per device.", "counter")
+	devices := make([]string, 0, len(stats.DeviceErrors))
+	for device := range stats.DeviceErrors {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		writeSample(&b, "smartcat_collector_device_errors_total", []label{{"device", device}}, float64(stats.DeviceErrors[device]))
+	}
+
+	writeHeader(&b, "smartcat_collector_device_up", "1 if the last collection of the device succeeded or was skipped because the drive was in standby.", "gauge")
+	for _, status := range statuses {
+		up := 0.0
+		if status.Status == service.StatusOK || status.Status == service.StatusStandby {
+			up = 1
+		}
+		writeSample(&b, "smartcat_collector_device_up", []label{{"device", status.Device}}, up)
+	}
+
+	writeHeader(&b, "smartcat_collector_device_standby", "1 if the last collection of the device was skipped because the drive was in standby.", "gauge")
+	for _, status := range statuses {
+		standby := 0.0
+		if status.Status == service.StatusStandby {
+			standby = 1
+		}
+		writeSample(&b, "smartcat_collector_device_standby", []label{{"device", status.Device}}, standby)
+	}
+
+	writeHeader(&b, "smartcat_collector_device_duration_seconds", "Duration of the last collection of the device.", "gauge")
+	for _, status := range statuses {
+		writeSample(&b, "smartcat_collector_device_duration_seconds", []label{{"device", status.Device}}, status.Duration.Seconds())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// label 指标标签
+type label struct {
+	name  string
+	value string
+}
+
+// deviceLabels 设备标签
+func deviceLabels(d *smart.SMARTData) []label {
+	return []label{
+		{"device_id", d.Device.Key()},
+		{"serial", d.Device.Serial},
+		{"model", d.Device.Model},
+		{"device", d.Device.Name},
+		{"device_type", d.Device.DeviceType},
+	}
+}
+
+// attributeLabels 设备标签加属性 ID 和名称
+func attributeLabels(d *smart.SMARTData, attr smart.SMARTAttribute) []label {
+	return append(deviceLabels(d),
+		label{"id", strconv.Itoa(attr.ID)},
+		label{"name", attr.Name},
+	)
+}
+
+// writeHeader 写入 HELP 和 TYPE 行
+func writeHeader(b *bytes.Buffer, name, help, typ string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, typ)
+}
+
+// writeSample 写入一个样本
+func writeSample(b *bytes.Buffer, name string, labels []label, value float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l.name)
+			b.WriteString(`="`)
+			b.WriteString(labelEscaper.Replace(l.value))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	b.WriteByte('\n')
+}
+
+// labelEscaper 按文本格式规范转义标签值
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,380 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 发送失败后的重试策略：指数退避，从 InitialBackoff 开始每次翻倍，不超过 MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy 默认重试策略：最多 10 次，30 秒起，最长 1 小时
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 30 * time.Second,
+		MaxBackoff:     time.Hour,
+	}
+}
+
+// backoff 第 attempts 次失败后的等待时间
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Channel 一个通知渠道
+type Channel struct {
+	Name        string
+	Type        string
+	MinSeverity string // 低于此级别的告警不发送，空表示全部发送
+	Retry       RetryPolicy
+	Notifier    Notifier
+}
+
+// accepts 判断渠道是否接收该事件
+func (c *Channel) accepts(ev Event) bool {
+	return severityRank[ev.Severity] >= severityRank[c.MinSeverity]
+}
+
+// Delivery 发件箱中待发送给某个渠道的一条通知
+type Delivery struct {
+	ID          string    `json:"id"`
+	Channel     string    `json:"channel"`
+	Event       Event     `json:"event"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TestResult 一个渠道的测试发送结果
+type TestResult struct {
+	Channel  string        `json:"channel"`
+	Type     string        `json:"type"`
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// sendTimeout 单次发送的超时
+const sendTimeout = 30 * time.Second
+
+// Dispatcher 通知分发器
+//
+// 事件按渠道拆分为独立的投递写入发件箱（持久化到 path），由 Run 在后台发送，
+// 每个渠道按自己的重试策略退避；进程重启后未发送的投递会继续发送。
+type Dispatcher struct {
+	channels []*Channel
+	path     string
+
+	mu     sync.Mutex
+	outbox []*Delivery
+	wake   chan struct{}
+}
+
+// NewDispatcher 创建分发器，path 为发件箱文件路径（为空则不持久化）
+func NewDispatcher(channels []Channel, path string) (*Dispatcher, error) {
+	d := &Dispatcher{
+		path: path,
+		wake: make(chan struct{}, 1),
+	}
+	names := make(map[string]bool, len(channels))
+	for i := range channels {
+		ch := channels[i]
+		if ch.Name == "" {
+			return nil, fmt.Errorf("notification channel name required")
+		}
+		if names[ch.Name] {
+			return nil, fmt.Errorf("duplicate notification channel %q", ch.Name)
+		}
+		names[ch.Name] = true
+		if ch.Retry.MaxAttempts < 1 {
+			ch.Retry = DefaultRetryPolicy()
+		}
+		d.channels = append(d.channels, &ch)
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Channels 返回已配置的渠道
+func (d *Dispatcher) Channels() []Channel {
+	channels := make([]Channel, 0, len(d.channels))
+	for _, ch := range d.channels {
+		channels = append(channels, *ch)
+	}
+	return channels
+}
+
+// Notify 把事件写入发件箱，稍后由 Run 发送
+func (d *Dispatcher) Notify(ev Event) {
+	now := time.Now()
+
+	d.mu.Lock()
+	added := false
+	for _, ch := range d.channels {
+		if !ch.accepts(ev) {
+			continue
+		}
+		d.outbox = append(d.outbox, &Delivery{
+			ID:          ch.Name + "/" + ev.ID,
+			Channel:     ch.Name,
+			Event:       ev,
+			NextAttempt: now,
+			CreatedAt:   now,
+		})
+		added = true
+	}
+	var err error
+	if added {
+		err = d.save()
+	}
+	d.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save notification outbox: %v", err)
+	}
+	if added {
+		d.signal()
+	}
+}
+
+// Pending 返回发件箱中尚未发送成功的投递
+func (d *Dispatcher) Pending() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending := make([]Delivery, 0, len(d.outbox))
+	for _, dl := range d.outbox {
+		pending = append(pending, *dl)
+	}
+	return pending
+}
+
+// Test 立即向渠道发送测试消息（不经过发件箱，不重试），channel 为空时测试全部渠道
+func (d *Dispatcher) Test(ctx context.Context, channel string) ([]TestResult, error) {
+	var results []TestResult
+	ev := TestEvent()
+	for _, ch := range d.channels {
+		if channel != "" && ch.Name != channel {
+			continue
+		}
+
+		start := time.Now()
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := ch.Notifier.Send(sendCtx, ev)
+		cancel()
+
+		result := TestResult{Channel: ch.Name, Type: ch.Type, OK: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	if channel != "" && len(results) == 0 {
+		return nil, fmt.Errorf("unknown notification channel %q", channel)
+	}
+	return results, nil
+}
+
+// Run 发送发件箱中到期的投递，直到 ctx 结束
+func (d *Dispatcher) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-d.wake:
+		}
+
+		d.deliverDue(ctx)
+
+		timer.Stop()
+		select {
+		case <-timer.C:
+		default:
+		}
+		if next, ok := d.nextAttempt(); ok {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// signal 唤醒 Run
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextAttempt 返回最早的下一次发送时间
+func (d *Dispatcher) nextAttempt() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var next time.Time
+	for _, dl := range d.outbox {
+		if next.IsZero() || dl.NextAttempt.Before(next) {
+			next = dl.NextAttempt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// deliverDue 依次发送所有到期的投递
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	now := time.Now()
+
+	d.mu.Lock()
+	var due []Delivery
+	for _, dl := range d.outbox {
+		if !dl.NextAttempt.After(now) {
+			due = append(due, *dl)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+
+	for _, dl := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		ch := d.channel(dl.Channel)
+		if ch == nil {
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := ch.Notifier.Send(sendCtx, dl.Event)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			// 进程退出中断的发送不计入失败次数
+			return
+		}
+		d.finish(ch, dl.ID, err)
+	}
+}
+
+// finish 记录一次发送结果：成功或放弃时移出发件箱，否则按退避时间重排
+func (d *Dispatcher) finish(ch *Channel, id string, sendErr error) {
+	d.mu.Lock()
+	for i, dl := range d.outbox {
+		if dl.ID != id {
+			continue
+		}
+
+		switch {
+		case sendErr == nil:
+			d.outbox = append(d.outbox[:i], d.outbox[i+1:]...)
+		default:
+			dl.Attempts++
+			dl.LastError = sendErr.Error()
+			if IsPermanent(sendErr) || dl.Attempts >= ch.Retry.MaxAttempts {
+				log.Printf("Giving up notification %s after %d attempts: %v", dl.ID, dl.Attempts, sendErr)
+				d.outbox = append(d.outbox[:i], d.outbox[i+1:]...)
+			} else {
+				dl.NextAttempt = time.Now().Add(ch.Retry.backoff(dl.Attempts))
+				log.Printf("Notification %s failed (attempt %d), retrying at %s: %v",
+					dl.ID, dl.Attempts, dl.NextAttempt.Format(time.RFC3339), sendErr)
+			}
+		}
+		break
+	}
+	err := d.save()
+	d.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save notification outbox: %v", err)
+	}
+}
+
+// channel 按名称查找渠道
+func (d *Dispatcher) channel(name string) *Channel {
+	for _, ch := range d.channels {
+		if ch.Name == name {
+			return ch
+		}
+	}
+	return nil
+}
+
+// load 从发件箱文件恢复，丢弃已不存在的渠道的投递
+func (d *Dispatcher) load() error {
+	if d.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read notification outbox: %w", err)
+	}
+
+	var outbox []*Delivery
+	if err := json.Unmarshal(data, &outbox); err != nil {
+		return fmt.Errorf("parse notification outbox: %w", err)
+	}
+
+	for _, dl := range outbox {
+		if d.channel(dl.Channel) == nil {
+			log.Printf("Dropping notification %s: channel %q is no longer configured", dl.ID, dl.Channel)
+			continue
+		}
+		d.outbox = append(d.outbox, dl)
+	}
+	return nil
+}
+
+// save 写入发件箱文件（先写临时文件再重命名），调用方持有锁
+func (d *Dispatcher) save() error {
+	if d.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(d.outbox, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode notification outbox: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return fmt.Errorf("create outbox dir: %w", err)
+	}
+
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write notification outbox: %w", err)
+	}
+	return os.Rename(tmp, d.path)
+}
@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"smart-cat/internal/alert"
+)
+
+// defaultJournalSocket systemd-journald 原生协议套接字
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// Journald 通过原生协议写入 systemd journal，附带 SMARTCAT_* 结构化字段，
+// 可以用 journalctl SMARTCAT_SERIAL=xxx 过滤
+type Journald struct {
+	socket     string
+	identifier string
+}
+
+// NewJournald 创建 journald 渠道，socket 为空时使用默认套接字
+func NewJournald(socket, identifier string) (*Journald, error) {
+	if socket == "" {
+		socket = defaultJournalSocket
+	}
+	if identifier == "" {
+		identifier = "smart-cat"
+	}
+	return &Journald{socket: socket, identifier: identifier}, nil
+}
+
+// Send 实现 Notifier 接口
+func (j *Journald) Send(ctx context.Context, ev Event) error {
+	fields := [][2]string{
+		{"MESSAGE", strings.TrimSpace(ev.Title + ": " + ev.Message)},
+		{"PRIORITY", strconv.Itoa(journalPriority(ev))},
+		{"SYSLOG_IDENTIFIER", j.identifier},
+		{"SMARTCAT_KIND", ev.Kind},
+		{"SMARTCAT_SEVERITY", ev.Severity},
+		{"SMARTCAT_STATE", ev.State},
+		{"SMARTCAT_RULE", ev.Rule},
+		{"SMARTCAT_HOST", ev.Host},
+		{"SMARTCAT_SERIAL", ev.Serial},
+		{"SMARTCAT_DEVICE", ev.Device},
+		{"SMARTCAT_MODEL", ev.Model},
+	}
+
+	var buf bytes.Buffer
+	for _, f := range fields {
+		if f[1] == "" {
+			continue
+		}
+		writeJournalField(&buf, f[0], f[1])
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unixgram", j.socket)
+	if err != nil {
+		return fmt.Errorf("journald: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("journald: %w", err)
+	}
+	return nil
+}
+
+// writeJournalField 按原生协议写一个字段：含换行的值使用 "KEY\n<64 位小端长度><值>\n"
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(key + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(key + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+// journalPriority syslog 优先级：crit=2，warning=4，notice=5
+func journalPriority(ev Event) int {
+	if ev.State != alert.StateFiring {
+		return 5
+	}
+	switch ev.Severity {
+	case alert.SeverityCritical:
+		return 2
+	case alert.SeverityWarning:
+		return 4
+	default:
+		return 5
+	}
+}
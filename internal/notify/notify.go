@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"smart-cat/internal/alert"
+)
+
+// 事件类型
+const (
+	KindAlert = "alert" // 告警触发或恢复
+	KindTest  = "test"  // POST /api/notifications/test 发出的测试消息
+)
+
+// SeverityInfo 测试消息等非告警事件的级别
+const SeverityInfo = "info"
+
+// Event 一条待发送的通知
+type Event struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Severity  string    `json:"severity"`
+	State     string    `json:"state,omitempty"`
+	Rule      string    `json:"rule,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Serial    string    `json:"serial,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Metric    string    `json:"metric,omitempty"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Time      time.Time `json:"time"`
+}
+
+// Notifier 通知渠道后端
+type Notifier interface {
+	// Send 发送一条通知；返回 Permanent 包装的错误时不再重试
+	Send(ctx context.Context, ev Event) error
+}
+
+// FromAlert 把告警状态变化转换为通知事件
+func FromAlert(a alert.Alert) Event {
+	at := a.UpdatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	device := a.Device
+	if a.Host != "" {
+		device = a.Host + ":" + a.Device
+	}
+
+	return Event{
+		ID:        fmt.Sprintf("%s@%d", a.ID, at.UnixNano()),
+		Kind:      KindAlert,
+		Title:     fmt.Sprintf("[%s] %s %s (%s)", strings.ToUpper(a.State), a.Rule, a.Serial, device),
+		Message:   a.Message,
+		Severity:  a.Severity,
+		State:     a.State,
+		Rule:      a.Rule,
+		Host:      a.Host,
+		Serial:    a.Serial,
+		Device:    a.Device,
+		Model:     a.Model,
+		Metric:    a.Metric,
+		Value:     a.Value,
+		Threshold: a.Threshold,
+		Time:      at,
+	}
+}
+
+// TestEvent 构造测试消息
+func TestEvent() Event {
+	now := time.Now()
+	return Event{
+		ID:       fmt.Sprintf("test@%d", now.UnixNano()),
+		Kind:     KindTest,
+		Title:    "[TEST] smart-cat notification",
+		Message:  "这是一条测试通知，收到说明渠道配置正确",
+		Severity: SeverityInfo,
+		Time:     now,
+	}
+}
+
+// severityRank 级别排序，用于渠道的最低级别过滤
+var severityRank = map[string]int{
+	SeverityInfo:           0,
+	alert.SeverityWarning:  1,
+	alert.SeverityCritical: 2,
+}
+
+// ValidSeverity 判断级别名是否合法（空表示不过滤）
+func ValidSeverity(severity string) bool {
+	if severity == "" {
+		return true
+	}
+	_, ok := severityRank[severity]
+	return ok
+}
+
+// permanentError 不应重试的错误（如 webhook 返回 4xx）
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记错误不可重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent 判断错误是否不可重试
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
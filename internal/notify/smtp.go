@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultSubject 默认邮件主题模板
+const defaultSubject = `[smart-cat] {{.Title}}`
+
+// defaultMailBody 默认邮件正文模板
+const defaultMailBody = `{{.Message}}
+{{if eq .Kind "alert"}}
+状态:   {{.State}}
+级别:   {{.Severity}}
+规则:   {{.Rule}}
+{{if .Host}}主机:   {{.Host}}
+{{end}}设备:   {{.Device}}
+型号:   {{.Model}}
+序列号: {{.Serial}}
+指标:   {{.Metric}} = {{.Value}}（阈值 {{.Threshold}}）
+{{end}}
+时间:   {{.Time.Format "2006-01-02 15:04:05 MST"}}
+`
+
+// SMTPConfig SMTP 渠道参数
+type SMTPConfig struct {
+	Addr     string // host:port
+	From     string
+	To       []string
+	Username string // 为空时不认证
+	Password string
+	Subject  string // 主题模板，为空使用默认
+	Body     string // 正文模板，为空使用默认
+}
+
+// SMTP 邮件渠道
+//
+// 服务器支持 STARTTLS 时自动启用；PLAIN 认证要求 TLS 或连接到 localhost。
+type SMTP struct {
+	cfg     SMTPConfig
+	subject *template.Template
+	body    *template.Template
+}
+
+// NewSMTP 创建邮件渠道
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	if cfg.Addr == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("smtp addr, from and to required")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return nil, fmt.Errorf("smtp addr: %w", err)
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = defaultSubject
+	}
+	if cfg.Body == "" {
+		cfg.Body = defaultMailBody
+	}
+
+	subject, err := template.New("subject").Funcs(templateFuncs).Parse(cfg.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("parse smtp subject template: %w", err)
+	}
+	body, err := template.New("body").Funcs(templateFuncs).Parse(cfg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse smtp body template: %w", err)
+	}
+
+	return &SMTP{cfg: cfg, subject: subject, body: body}, nil
+}
+
+// Send 实现 Notifier 接口
+func (s *SMTP) Send(ctx context.Context, ev Event) error {
+	msg, err := s.message(ev)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp dial: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.cfg.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)); err != nil {
+			return Permanent(fmt.Errorf("smtp auth: %w", err))
+		}
+	}
+
+	if err := c.Mail(s.cfg.From); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	for _, to := range s.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp rcpt %s: %w", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+
+	return c.Quit()
+}
+
+// message 渲染完整的邮件（头部 + 正文）
+func (s *SMTP) message(ev Event) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := s.subject.Execute(&subject, ev); err != nil {
+		return nil, fmt.Errorf("render smtp subject: %w", err)
+	}
+	if err := s.body.Execute(&body, ev); err != nil {
+		return nil, fmt.Errorf("render smtp body: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mail 假 SMTP 服务器收到的一封邮件
+type mail struct {
+	auth string // AUTH PLAIN 解码后的凭据，未认证时为空
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP 进程内的 SMTP 服务器，只实现发信需要的命令，不支持 STARTTLS
+type fakeSMTP struct {
+	ln       net.Listener
+	password string // 非空时要求 AUTH PLAIN 使用该密码
+	reject   string // 拒绝的收件人
+
+	mu    sync.Mutex
+	mails []mail
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTP) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeSMTP) received() []mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mail(nil), s.mails...)
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(format string, args ...any) { tp.PrintfLine(format, args...) }
+
+	reply("220 fake ESMTP")
+	var m mail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			parts := strings.Split(string(decoded), "\x00")
+			if len(parts) != 3 || parts[2] != s.password {
+				reply("535 authentication failed")
+				continue
+			}
+			m.auth = parts[1]
+			reply("235 ok")
+		case "MAIL":
+			if s.password != "" && m.auth == "" {
+				reply("530 authentication required")
+				continue
+			}
+			m.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			reply("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if to == s.reject {
+				reply("550 no such user")
+				continue
+			}
+			m.to = append(m.to, to)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, m)
+			s.mu.Unlock()
+			m = mail{auth: m.auth}
+			reply("250 queued")
+		case "RSET":
+			m = mail{auth: m.auth}
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 %s not implemented", cmd)
+		}
+	}
+}
+
+func alertEvent() Event {
+	return Event{
+		Kind:      "alert",
+		Title:     "温度过高 /dev/sda",
+		Message:   "温度连续 3 次高于 55°C",
+		Severity:  "warning",
+		State:     "firing",
+		Rule:      "temperature_high",
+		Device:    "/dev/sda",
+		Model:     "WDC WD40EFRX-68N32N0",
+		Serial:    "WD-WCC7K1234567",
+		Metric:    "temperature",
+		Value:     58,
+		Threshold: 55,
+		Time:      time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC),
+	}
+}
+
+func sendWithin(t *testing.T, n Notifier, ev Event) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return n.Send(ctx, ev)
+}
+
+func TestSMTPSend(t *testing.T) {
+	server := newFakeSMTP(t)
+	sink, err := NewSMTP(SMTPConfig{
+		Addr: server.addr(),
+		From: "smart-cat@example.com",
+		To:   []string{"ops@example.com", "oncall@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sendWithin(t, sink, alertEvent()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	mails := server.received()
+	if len(mails) != 1 {
+		t.Fatalf("received %d mails, want 1", len(mails))
+	}
+	m := mails[0]
+	if m.auth != "" {
+		t.Errorf("authenticated as %q without a username", m.auth)
+	}
+	if m.from != "smart-cat@example.com" || strings.Join(m.to, ",") != "ops@example.com,oncall@example.com" {
+		t.Errorf("envelope = %s -> %v", m.from, m.to)
+	}
+
+	header, body, ok := strings.Cut(m.data, "\n\n")
+	if !ok {
+		t.Fatalf("no header/body separator in %q", m.data)
+	}
+	for _, want := range []string{
+		"From: smart-cat@example.com",
+		"To: ops@example.com, oncall@example.com",
+		"Content-Type: text/plain; charset=utf-8",
+		"Subject: =?utf-8?q?",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("header missing %q:\n%s", want, header)
+		}
+	}
+	for _, want := range []string{"温度连续 3 次高于 55°C", "规则:   temperature_high", "指标:   temperature = 58（阈值 55）", "2026-10-17 02:00:00 UTC"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSMTPAuth(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.password = "secret"
+	cfg := SMTPConfig{
+		Addr:     server.addr(),
+		From:     "smart-cat@example.com",
+		To:       []string{"ops@example.com"},
+		Username: "smart-cat",
+		Password: "secret",
+		Subject:  "{{.Severity}}: {{.Title}}",
+	}
+
+	sink, err := NewSMTP(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendWithin(t, sink, alertEvent()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if mails := server.received(); len(mails) != 1 || mails[0].auth != "smart-cat" {
+		t.Fatalf("mails = %+v, want one authenticated as smart-cat", mails)
+	}
+
+	// 认证失败重试也没用
+	cfg.Password = "wrong"
+	sink, err = NewSMTP(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sendWithin(t, sink, alertEvent())
+	if err == nil || !IsPermanent(err) {
+		t.Errorf("wrong password: err = %v, want a permanent error", err)
+	}
+}
+
+func TestSMTPErrors(t *testing.T) {
+	server := newFakeSMTP(t)
+	server.reject = "nobody@example.com"
+	sink, err := NewSMTP(SMTPConfig{
+		Addr: server.addr(),
+		From: "smart-cat@example.com",
+		To:   []string{"ops@example.com", "nobody@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 收件人被拒绝是可重试的错误，不会发出邮件
+	err = sendWithin(t, sink, alertEvent())
+	if err == nil || IsPermanent(err) || !strings.Contains(err.Error(), "nobody@example.com") {
+		t.Errorf("rejected recipient: err = %v", err)
+	}
+	if mails := server.received(); len(mails) != 0 {
+		t.Errorf("received %d mails, want 0", len(mails))
+	}
+
+	// 模板执行失败不重试
+	bad, err := NewSMTP(SMTPConfig{Addr: server.addr(), From: "a@example.com", To: []string{"b@example.com"}, Subject: "{{.Missing}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendWithin(t, bad, alertEvent()); !IsPermanent(err) {
+		t.Errorf("bad template: err = %v, want a permanent error", err)
+	}
+
+	// 连接不上
+	server.ln.Close()
+	if err := sendWithin(t, sink, alertEvent()); err == nil || IsPermanent(err) {
+		t.Errorf("closed server: err = %v, want a retryable error", err)
+	}
+
+	if _, err := NewSMTP(SMTPConfig{Addr: "localhost", From: "a@example.com", To: []string{"b@example.com"}}); err == nil {
+		t.Error("addr without port: expected an error")
+	}
+}
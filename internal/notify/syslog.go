@@ -0,0 +1,64 @@
+//go:build !windows && !plan9
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/syslog"
+
+	"smart-cat/internal/alert"
+)
+
+// Syslog 本地或远程 syslog 渠道（systemd 系统上写入 /dev/log 的消息也会进入 journald）
+type Syslog struct {
+	network string
+	addr    string
+	tag     string
+}
+
+// NewSyslog 创建 syslog 渠道，network 和 addr 都为空时使用本机 syslog
+func NewSyslog(network, addr, tag string) (*Syslog, error) {
+	if tag == "" {
+		tag = "smart-cat"
+	}
+	return &Syslog{network: network, addr: addr, tag: tag}, nil
+}
+
+// Send 实现 Notifier 接口，每次发送重新连接，避免 syslog 重启后连接失效
+func (s *Syslog) Send(ctx context.Context, ev Event) error {
+	w, err := syslog.Dial(s.network, s.addr, syslogPriority(ev)|syslog.LOG_DAEMON, s.tag)
+	if err != nil {
+		return fmt.Errorf("syslog: %w", err)
+	}
+	defer w.Close()
+
+	msg := ev.Title
+	if ev.Message != "" {
+		msg += ": " + ev.Message
+	}
+
+	switch syslogPriority(ev) {
+	case syslog.LOG_CRIT:
+		return w.Crit(msg)
+	case syslog.LOG_WARNING:
+		return w.Warning(msg)
+	default:
+		return w.Notice(msg)
+	}
+}
+
+// syslogPriority 触发中的告警按级别映射，恢复和测试消息为 notice
+func syslogPriority(ev Event) syslog.Priority {
+	if ev.State != alert.StateFiring {
+		return syslog.LOG_NOTICE
+	}
+	switch ev.Severity {
+	case alert.SeverityCritical:
+		return syslog.LOG_CRIT
+	case alert.SeverityWarning:
+		return syslog.LOG_WARNING
+	default:
+		return syslog.LOG_NOTICE
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows || plan9
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// Syslog 在此平台不可用
+type Syslog struct{}
+
+// NewSyslog 在此平台返回错误
+func NewSyslog(network, addr, tag string) (*Syslog, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
+
+// Send 实现 Notifier 接口
+func (s *Syslog) Send(ctx context.Context, ev Event) error {
+	return Permanent(fmt.Errorf("syslog is not supported on %s", runtime.GOOS))
+}
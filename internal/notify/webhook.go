@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+)
+
+// Webhook 通用 JSON webhook
+//
+// 请求体由 text/template 渲染，模板的数据为 Event；未配置模板时发送 Event 的 JSON。
+// 模板中可以用 {{json .Message}} 输出转义后的 JSON 字符串。
+type Webhook struct {
+	url     string
+	method  string
+	headers map[string]string
+	body    *template.Template
+	client  *http.Client
+}
+
+// templateFuncs 模板可用的函数
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewWebhook 创建 webhook 渠道，method 为空时使用 POST
+func NewWebhook(url, method string, headers map[string]string, bodyTemplate string) (*Webhook, error) {
+	if url == "" {
+		return nil, fmt.Errorf("webhook url required")
+	}
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	w := &Webhook{
+		url:     url,
+		method:  method,
+		headers: headers,
+		client:  &http.Client{},
+	}
+
+	if bodyTemplate != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Parse(bodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parse webhook body template: %w", err)
+		}
+		w.body = tmpl
+	}
+
+	return w, nil
+}
+
+// Send 实现 Notifier 接口，2xx 视为成功，4xx（除 408/429）不再重试
+func (w *Webhook) Send(ctx context.Context, ev Event) error {
+	var body bytes.Buffer
+	if w.body != nil {
+		if err := w.body.Execute(&body, ev); err != nil {
+			return Permanent(fmt.Errorf("render webhook body: %w", err))
+		}
+	} else if err := json.NewEncoder(&body).Encode(ev); err != nil {
+		return Permanent(fmt.Errorf("encode webhook body: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.method, w.url, &body)
+	if err != nil {
+		return Permanent(fmt.Errorf("webhook request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "smart-cat")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("webhook: %s returned %s", w.url, resp.Status)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
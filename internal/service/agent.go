@@ -0,0 +1,368 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// PushPath 汇聚端接收 agent 推送的路径（旧版本 agent 使用的 /api/agent/push 仍然可用）
+const PushPath = "/api/v1/agent/push"
+
+// Sample 一次采集的结果：读到数据（active，带 Data）或因待机跳过（standby，只有最近一次的设备信息）
+type Sample struct {
+	Device    smart.Device     `json:"device"`
+	Timestamp time.Time        `json:"timestamp"`
+	State     string           `json:"state"` // active/standby
+	Data      *smart.SMARTData `json:"data,omitempty"`
+}
+
+// PushRequest agent 推送的请求体
+type PushRequest struct {
+	Host    string   `json:"host"`
+	Samples []Sample `json:"samples"`
+}
+
+// PushResponse 汇聚端的响应
+type PushResponse struct {
+	Accepted int `json:"accepted"` // 保存的样本数，重复推送的样本不计入
+}
+
+// AgentConfig agent 推送配置
+type AgentConfig struct {
+	ServerURL    string        // 汇聚端地址，如 http://nas:10044
+	Token        string        // Authorization: Bearer 令牌
+	Host         string        // 本机名称
+	PushInterval time.Duration // 推送失败后的重试间隔
+	BufferSize   int           // 本地缓冲最多保存的样本数，超出时丢弃最旧的
+	BatchSize    int           // 每次请求最多推送的样本数
+}
+
+// DefaultAgentConfig 默认 agent 配置
+func DefaultAgentConfig() AgentConfig {
+	return AgentConfig{
+		PushInterval: time.Minute,
+		BufferSize:   10000,
+		BatchSize:    100,
+	}
+}
+
+// pushTimeout 单次推送的超时
+const pushTimeout = 30 * time.Second
+
+// Agent 把采集结果推送到汇聚端
+//
+// 样本先写入本地缓冲（持久化到 path，每行一个样本，入队时只追加一行），由 Run 在后台按顺序分批推送，成功后移出缓冲；
+// 汇聚端不可达时样本保留在缓冲中，每隔 PushInterval 重试，进程重启后继续推送。
+// 汇聚端按设备和时间去重，重试时重复推送的样本不会重复保存。
+type Agent struct {
+	config AgentConfig
+	path   string
+	client *http.Client
+
+	mu     sync.Mutex
+	buffer []Sample
+	head   int64 // 已移出缓冲（推送成功或因缓冲满丢弃）的样本总数，用于定位推送期间变化的缓冲
+	stale  int   // 缓冲文件中已移出缓冲、尚未压缩掉的行数
+	online bool  // 最近一次推送是否成功，只在状态变化时记录日志
+	wake   chan struct{}
+}
+
+// NewAgent 创建 agent，path 为缓冲文件路径（为空则不持久化）
+func NewAgent(config AgentConfig, path string) (*Agent, error) {
+	if config.ServerURL == "" {
+		return nil, fmt.Errorf("aggregator url required")
+	}
+	if config.Host == "" {
+		return nil, fmt.Errorf("agent host name required")
+	}
+	defaults := DefaultAgentConfig()
+	if config.PushInterval <= 0 {
+		config.PushInterval = defaults.PushInterval
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+
+	a := &Agent{
+		config: config,
+		path:   path,
+		client: &http.Client{Timeout: pushTimeout},
+		online: true,
+		wake:   make(chan struct{}, 1),
+	}
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetHTTPClient 设置推送使用的 HTTP 客户端
+func (a *Agent) SetHTTPClient(client *http.Client) {
+	a.client = client
+}
+
+// Enqueue 把样本写入缓冲，稍后由 Run 推送
+func (a *Agent) Enqueue(sample Sample) {
+	a.mu.Lock()
+	a.buffer = append(a.buffer, sample)
+	if over := len(a.buffer) - a.config.BufferSize; over > 0 {
+		a.buffer = append([]Sample(nil), a.buffer[over:]...)
+		a.head += int64(over)
+		a.stale += over
+		log.Printf("Agent buffer full, dropped %d oldest samples", over)
+	}
+	err := a.append(sample)
+	if err == nil {
+		err = a.compact()
+	}
+	a.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save agent buffer: %v", err)
+	}
+	a.signal()
+}
+
+// Pending 返回缓冲中尚未推送的样本数
+func (a *Agent) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.buffer)
+}
+
+// Run 推送缓冲中的样本，直到 ctx 结束
+func (a *Agent) Run(ctx context.Context) {
+	log.Printf("Starting agent %s, pushing to %s", a.config.Host, a.config.ServerURL)
+
+	ticker := time.NewTicker(a.config.PushInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Flush(ctx); err != nil && ctx.Err() == nil {
+			a.setOnline(false, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.wake:
+		}
+	}
+}
+
+// Flush 按顺序推送缓冲中的全部样本，遇到失败时停止并返回错误
+func (a *Agent) Flush(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+		n := len(a.buffer)
+		if n > a.config.BatchSize {
+			n = a.config.BatchSize
+		}
+		batch := append([]Sample(nil), a.buffer[:n]...)
+		start := a.head
+		a.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := a.push(ctx, batch); err != nil {
+			return err
+		}
+		a.setOnline(true, nil)
+
+		// 推送期间缓冲可能追加新样本或丢弃最旧的样本，只移除仍在缓冲中的已推送部分
+		a.mu.Lock()
+		if done := start + int64(n) - a.head; done > 0 {
+			a.buffer = append([]Sample(nil), a.buffer[done:]...)
+			a.head += done
+			a.stale += int(done)
+		}
+		err := a.compact()
+		a.mu.Unlock()
+		if err != nil {
+			log.Printf("Failed to save agent buffer: %v", err)
+		}
+	}
+}
+
+// push 发送一批样本，2xx 视为成功
+func (a *Agent) push(ctx context.Context, samples []Sample) error {
+	body, err := json.Marshal(PushRequest{Host: a.config.Host, Samples: samples})
+	if err != nil {
+		return fmt.Errorf("encode push: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+
+	url := strings.TrimRight(a.config.ServerURL, "/") + PushPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.config.Token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push to %s: %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// setOnline 记录汇聚端可达状态的变化
+func (a *Agent) setOnline(online bool, err error) {
+	a.mu.Lock()
+	changed := a.online != online
+	a.online = online
+	pending := len(a.buffer)
+	a.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if online {
+		log.Printf("Aggregator %s reachable again", a.config.ServerURL)
+	} else {
+		log.Printf("Aggregator unreachable, buffering %d samples locally: %v", pending, err)
+	}
+}
+
+// signal 唤醒 Run
+func (a *Agent) signal() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// load 从缓冲文件恢复
+//
+// 缓冲文件每行一个样本，也兼容旧版本写入的 JSON 数组；追加到一半被中断留下的半行和
+// 无法解析的行被跳过。恢复后重写一次缓冲文件，之后的追加总是从完整的一行开始。
+func (a *Agent) load() error {
+	if a.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read agent buffer: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &a.buffer); err != nil {
+			return fmt.Errorf("parse agent buffer: %w", err)
+		}
+	} else {
+		skipped := 0
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var sample Sample
+			if err := json.Unmarshal(line, &sample); err != nil {
+				skipped++
+				continue
+			}
+			a.buffer = append(a.buffer, sample)
+		}
+		if skipped > 0 {
+			log.Printf("Skipped %d malformed lines in agent buffer %s", skipped, a.path)
+		}
+	}
+	return a.save()
+}
+
+// append 把一个样本追加到缓冲文件末尾，调用方持有锁
+func (a *Agent) append(sample Sample) error {
+	if a.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("encode sample: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return fmt.Errorf("create buffer dir: %w", err)
+	}
+
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open agent buffer: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("append to agent buffer: %w", err)
+	}
+	return f.Close()
+}
+
+// compact 缓冲清空或已移出的行不少于缓冲中的样本时重写缓冲文件，调用方持有锁
+//
+// 未压缩的行在重启后会再推送一次，由汇聚端去重。
+func (a *Agent) compact() error {
+	if a.stale == 0 || (len(a.buffer) > 0 && a.stale < len(a.buffer)) {
+		return nil
+	}
+	return a.save()
+}
+
+// save 写入缓冲文件（先写临时文件再重命名），调用方持有锁
+func (a *Agent) save() error {
+	if a.path == "" {
+		return nil
+	}
+
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	for i := range a.buffer {
+		if err := enc.Encode(&a.buffer[i]); err != nil {
+			return fmt.Errorf("encode agent buffer: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return fmt.Errorf("create buffer dir: %w", err)
+	}
+
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0644); err != nil {
+		return fmt.Errorf("write agent buffer: %w", err)
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return fmt.Errorf("replace agent buffer: %w", err)
+	}
+	a.stale = 0
+	return nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+func activeSample(serial string, ts time.Time, temperature int) Sample {
+	device := smart.Device{Name: "/dev/sda", Serial: serial, Model: "TEST DISK", DeviceType: "HDD"}
+	return Sample{
+		Device:    device,
+		Timestamp: ts,
+		State:     smart.PowerStateActive,
+		Data:      &smart.SMARTData{Device: device, Timestamp: ts, SmartStatus: "PASSED", Temperature: temperature},
+	}
+}
+
+func TestAgentBufferFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.json")
+	lines := func() int {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Count(data, []byte("\n"))
+	}
+
+	agent, err := NewAgent(AgentConfig{ServerURL: "http://127.0.0.1:1", Host: "box1", BufferSize: 2}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	agent.Enqueue(activeSample("AAA", start, 30))
+	agent.Enqueue(activeSample("AAA", start.Add(time.Minute), 31))
+	if n := lines(); n != 2 {
+		t.Fatalf("buffer file has %d lines, want 2", n)
+	}
+
+	// 丢弃的样本先留在文件中，已移出的行不少于缓冲中的样本时压缩
+	agent.Enqueue(activeSample("AAA", start.Add(2*time.Minute), 32))
+	if n := lines(); n != 3 {
+		t.Errorf("buffer file has %d lines after dropping one sample, want 3", n)
+	}
+	agent.Enqueue(activeSample("AAA", start.Add(3*time.Minute), 33))
+	if n := lines(); n != 2 {
+		t.Errorf("buffer file has %d lines after compaction, want 2", n)
+	}
+
+	// 中断留下的半行被跳过
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"device":{"serial":"AAA"},"timest`)
+	f.Close()
+	agent, err = NewAgent(AgentConfig{ServerURL: "http://127.0.0.1:1", Host: "box1", BufferSize: 2}, path)
+	if err != nil {
+		t.Fatalf("load with a partial line: %v", err)
+	}
+	if n := agent.Pending(); n != 2 {
+		t.Errorf("Pending = %d after loading a partial line, want 2", n)
+	}
+	if n := lines(); n != 2 {
+		t.Errorf("buffer file has %d lines after load, want 2", n)
+	}
+
+	// 旧版本写入的 JSON 数组
+	legacy, err := json.Marshal([]Sample{activeSample("AAA", start, 30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	agent, err = NewAgent(AgentConfig{ServerURL: "http://127.0.0.1:1", Host: "box1"}, path)
+	if err != nil {
+		t.Fatalf("load legacy buffer: %v", err)
+	}
+	if n := agent.Pending(); n != 1 {
+		t.Errorf("Pending = %d after loading a legacy buffer, want 1", n)
+	}
+	if n := lines(); n != 1 {
+		t.Errorf("legacy buffer rewritten with %d lines, want 1", n)
+	}
+}
@@ -0,0 +1,421 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"smart-cat/internal/alert"
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+	"smart-cat/internal/trend"
+)
+
+// HostInfo 一个推送数据的 agent
+type HostInfo struct {
+	Name     string    `json:"name"`
+	Addr     string    `json:"addr"`      // 最近一次推送的来源地址
+	LastPush time.Time `json:"last_push"` // 最近一次推送的时间
+	Samples  int64     `json:"samples"`   // 累计保存的样本数
+	Devices  int       `json:"devices"`
+}
+
+// remoteDevice agent 推送的设备的最新状态
+type remoteDevice struct {
+	Data      *smart.SMARTData `json:"data"`  // 最近一次读到的数据
+	State     string           `json:"state"` // 最近一次采集时的电源状态
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// remoteHost 一个 agent 的状态，持久化到 <dir>/<host>/state.json
+type remoteHost struct {
+	Info    HostInfo                 `json:"info"`
+	Devices map[string]*remoteDevice `json:"devices"` // 设备标识 -> 最新状态
+
+	storage storage.Storage
+	ingest  sync.Mutex // 串行处理同一台主机的推送
+}
+
+// Aggregator 汇聚端：接收 agent 推送的样本，每台主机一个独立的存储
+//
+// 主机的历史数据保存在 <dir>/<host>/ 下，格式与本机数据目录相同；每台主机各设备的
+// 最新快照也持久化在同一目录，重启后在 agent 下一次推送之前仍能列出设备。
+// agent 重试时可能重复推送，早于或等于该设备最新样本时间的样本会被忽略。
+type Aggregator struct {
+	dir        string
+	newStorage func(dir string) (storage.Storage, error)
+	alerts     *alert.Engine
+	trend      *trend.Analyzer
+	events     *EventBus
+
+	mu    sync.Mutex
+	hosts map[string]*remoteHost
+}
+
+// NewAggregator 创建汇聚端，dir 为各主机数据的根目录，newStorage 为一台主机创建存储
+func NewAggregator(dir string, newStorage func(dir string) (storage.Storage, error)) (*Aggregator, error) {
+	a := &Aggregator{
+		dir:        dir,
+		newStorage: newStorage,
+		hosts:      make(map[string]*remoteHost),
+	}
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetAlertEngine 设置告警引擎，收到 agent 的数据后评估规则
+func (a *Aggregator) SetAlertEngine(engine *alert.Engine) {
+	a.alerts = engine
+}
+
+// SetTrendAnalyzer 设置趋势分析器，按主机的历史预测 agent 推送的设备的剩余天数
+func (a *Aggregator) SetTrendAnalyzer(analyzer *trend.Analyzer) {
+	a.trend = analyzer
+}
+
+// SetEventBus 设置事件总线，agent 推送的新设备和新数据也作为事件发布
+func (a *Aggregator) SetEventBus(bus *EventBus) {
+	a.events = bus
+}
+
+// Ingest 保存一台主机推送的样本，返回实际保存的样本数
+//
+// 保存失败时返回错误，agent 会重试整批样本，已保存的部分因去重不会重复写入。
+func (a *Aggregator) Ingest(host, addr string, samples []Sample) (int, error) {
+	if !ValidHostName(host) {
+		return 0, fmt.Errorf("invalid host name %q", host)
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp.Before(samples[j].Timestamp)
+	})
+
+	a.mu.Lock()
+	h, err := a.host(host)
+	a.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	// 同一台主机的推送按顺序处理；h.Devices 只在这里修改，读取不需要 a.mu，
+	// 修改时持有 a.mu，存储写入和趋势分析不持有 a.mu，不会阻塞其他主机和查询
+	h.ingest.Lock()
+	defer h.ingest.Unlock()
+
+	accepted := 0
+	var changed []*smart.SMARTData
+	var added []smart.Device
+	var ingestErr error
+	for _, s := range samples {
+		key := s.Device.Key()
+		if key == "" {
+			continue
+		}
+		dev := h.Devices[key]
+		if dev != nil && !s.Timestamp.After(dev.UpdatedAt) {
+			continue
+		}
+
+		switch s.State {
+		case smart.PowerStateActive:
+			if s.Data == nil {
+				continue
+			}
+			data := *s.Data
+			data.Device.Host = host
+			if err := h.storage.SaveRecord(key, &data); err != nil {
+				ingestErr = fmt.Errorf("save record for %s/%s: %w", host, key, err)
+			} else {
+				if err := h.storage.SaveAttributes(key, data.Timestamp, data.Attributes); err != nil {
+					log.Printf("Failed to save attributes for %s/%s: %v", host, key, err)
+				}
+				if err := h.storage.SavePowerState(key, s.Timestamp, smart.PowerStateActive); err != nil {
+					log.Printf("Failed to save power state for %s/%s: %v", host, key, err)
+				}
+				if a.trend != nil {
+					if err := a.trend.Apply(h.storage, key, &data); err != nil {
+						log.Printf("Failed to analyze trend for %s/%s: %v", host, key, err)
+					}
+				}
+				dev = &remoteDevice{Data: &data}
+				changed = append(changed, &data)
+			}
+		case smart.PowerStateStandby:
+			if err := h.storage.SavePowerState(key, s.Timestamp, smart.PowerStateStandby); err != nil {
+				ingestErr = fmt.Errorf("save power state for %s/%s: %w", host, key, err)
+			} else if dev == nil {
+				// 汇聚端还没有这个设备的数据，只记录设备信息
+				device := s.Device
+				device.Host = host
+				dev = &remoteDevice{Data: &smart.SMARTData{Device: device}}
+			}
+		default:
+			continue
+		}
+		if ingestErr != nil {
+			break
+		}
+
+		a.mu.Lock()
+		if _, ok := h.Devices[key]; !ok {
+			added = append(added, dev.Data.Device)
+		}
+		dev.State = s.State
+		dev.UpdatedAt = s.Timestamp
+		h.Devices[key] = dev
+		a.mu.Unlock()
+		accepted++
+	}
+
+	a.mu.Lock()
+	h.Info.Addr = addr
+	h.Info.LastPush = time.Now()
+	h.Info.Samples += int64(accepted)
+	h.Info.Devices = len(h.Devices)
+	state, err := json.Marshal(h)
+	a.mu.Unlock()
+	if err != nil {
+		err = fmt.Errorf("encode host state: %w", err)
+	} else {
+		err = a.save(host, state)
+	}
+	if err != nil {
+		log.Printf("Failed to save state of host %s: %v", host, err)
+	}
+
+	if a.events != nil {
+		for _, device := range added {
+			a.events.Publish(EventDeviceAdded, device)
+		}
+		for _, data := range changed {
+			a.events.Publish(EventSnapshotUpdated, data)
+		}
+	}
+	if a.alerts != nil {
+		for _, data := range changed {
+			if _, err := a.alerts.Evaluate(data); err != nil {
+				log.Printf("Failed to evaluate alerts for %s/%s: %v", host, data.Device.Key(), err)
+			}
+		}
+	}
+
+	return accepted, ingestErr
+}
+
+// Hosts 返回所有推送过数据的主机
+func (a *Aggregator) Hosts() []HostInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	hosts := make([]HostInfo, 0, len(a.hosts))
+	for _, h := range a.hosts {
+		hosts = append(hosts, h.Info)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Name < hosts[j].Name
+	})
+	return hosts
+}
+
+// Devices 返回所有主机的设备，asleepSince 为统计待机占比的起始时间
+func (a *Aggregator) Devices(asleepSince time.Time) []smart.DeviceInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var infos []smart.DeviceInfo
+	for _, h := range a.hosts {
+		for key, dev := range h.Devices {
+			updated := dev.UpdatedAt
+			info := smart.DeviceInfo{
+				Device:     dev.Data.Device,
+				HasHistory: true,
+				PowerState: dev.State,
+				LastSeen:   &updated,
+				Trend:      dev.Data.Trend,
+			}
+			if stats, err := h.storage.GetPowerStats(key, asleepSince, time.Time{}); err == nil && stats.Samples > 0 {
+				info.AsleepPercent = &stats.AsleepPercent
+			}
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Host != infos[j].Host {
+			return infos[i].Host < infos[j].Host
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Snapshot 返回主机上设备最近一次推送的数据，key 可以是设备标识、序列号或设备路径
+func (a *Aggregator) Snapshot(host, key string) (*smart.SMARTData, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	h, ok := a.hosts[host]
+	if !ok {
+		return nil, false
+	}
+	if dev, ok := h.Devices[key]; ok && !dev.Data.Timestamp.IsZero() {
+		return dev.Data, true
+	}
+	for _, dev := range h.Devices {
+		d := dev.Data.Device
+		if (d.Serial == key || d.Name == key || d.Name == "/dev/"+key) && !dev.Data.Timestamp.IsZero() {
+			return dev.Data, true
+		}
+	}
+	return nil, false
+}
+
+// Storage 返回主机的存储
+func (a *Aggregator) Storage(host string) (storage.Storage, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	h, ok := a.hosts[host]
+	if !ok {
+		return nil, false
+	}
+	return h.storage, true
+}
+
+// ApplyRetention 对所有主机的存储执行保留策略
+func (a *Aggregator) ApplyRetention() error {
+	a.mu.Lock()
+	stores := make(map[string]storage.Storage, len(a.hosts))
+	for name, h := range a.hosts {
+		stores[name] = h.storage
+	}
+	a.mu.Unlock()
+
+	var errs []error
+	for name, store := range stores {
+		if err := store.ApplyRetention(); err != nil {
+			errs = append(errs, fmt.Errorf("host %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunRetention 每隔 interval 对所有主机的存储执行一次保留策略，直到 ctx 结束
+func (a *Aggregator) RunRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			if err := a.ApplyRetention(); err != nil {
+				log.Printf("Failed to apply retention to agent hosts: %v", err)
+				continue
+			}
+			log.Printf("Retention applied to agent hosts in %v", time.Since(start))
+		}
+	}
+}
+
+// host 返回主机的状态，第一次推送时创建存储，调用方持有锁
+func (a *Aggregator) host(name string) (*remoteHost, error) {
+	if h, ok := a.hosts[name]; ok {
+		return h, nil
+	}
+
+	store, err := a.newStorage(filepath.Join(a.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("create storage for host %s: %w", name, err)
+	}
+	h := &remoteHost{
+		Info:    HostInfo{Name: name},
+		Devices: make(map[string]*remoteDevice),
+		storage: store,
+	}
+	a.hosts[name] = h
+	log.Printf("New agent host %s", name)
+	return h, nil
+}
+
+// ValidHostName 主机名用作目录名，只允许字母、数字和 . _ -
+func ValidHostName(name string) bool {
+	if name == "" || name == "." || name == ".." || len(name) > 253 {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// stateFile 主机状态文件路径
+func (a *Aggregator) stateFile(host string) string {
+	return filepath.Join(a.dir, host, "state.json")
+}
+
+// load 恢复所有主机的状态
+func (a *Aggregator) load() error {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read hosts dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !ValidHostName(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(a.stateFile(entry.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("read state of host %s: %w", entry.Name(), err)
+		}
+
+		h := &remoteHost{}
+		if err := json.Unmarshal(data, h); err != nil {
+			return fmt.Errorf("parse state of host %s: %w", entry.Name(), err)
+		}
+		if h.Devices == nil {
+			h.Devices = make(map[string]*remoteDevice)
+		}
+		if h.storage, err = a.newStorage(filepath.Join(a.dir, entry.Name())); err != nil {
+			return fmt.Errorf("create storage for host %s: %w", entry.Name(), err)
+		}
+		h.Info.Name = entry.Name()
+		a.hosts[entry.Name()] = h
+	}
+	return nil
+}
+
+// save 写入编码后的主机状态（先写临时文件再重命名），调用方持有该主机的 ingest 锁
+func (a *Aggregator) save(host string, data []byte) error {
+	path := a.stateFile(host)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create host dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write host state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// 快照来源
+const (
+	SourceCache = "cache" // 采集器或之前的实时读取写入的缓存
+	SourceLive  = "live"  // 本次请求实时读取
+	SourceAgent = "agent" // agent 最近一次推送的数据
+)
+
+// CacheEntry 一个设备最近一次读取的结果
+type CacheEntry struct {
+	Device    smart.Device     // 列出设备时的信息
+	Data      *smart.SMARTData // 最近一次成功读到的数据，待机或读取失败时保留之前的数据
+	State     string           // 最近一次读取时的电源状态，读取失败时为空
+	Err       error            // 最近一次读取的错误
+	CheckedAt time.Time        // 最近一次尝试读取的时间
+}
+
+// Snapshot API 返回的设备数据，附带数据的来源和新鲜度
+type Snapshot struct {
+	*smart.SMARTData
+	Source     string  `json:"source"`                // cache/live/agent
+	PowerState string  `json:"power_state,omitempty"` // 最近一次读取时的电源状态
+	AgeSeconds float64 `json:"age_seconds"`           // 数据的采集时间距现在的秒数
+}
+
+// newSnapshot 创建快照视图
+func newSnapshot(data *smart.SMARTData, source, state string) *Snapshot {
+	return &Snapshot{
+		SMARTData:  data,
+		Source:     source,
+		PowerState: state,
+		AgeSeconds: age(data.Timestamp),
+	}
+}
+
+// age 距现在的秒数，保留一位小数
+func age(t time.Time) float64 {
+	return float64(time.Since(t).Round(100*time.Millisecond)) / float64(time.Second)
+}
+
+// DefaultRefreshTimeout 一次实时读取或重新列出设备的默认超时
+const DefaultRefreshTimeout = 5 * time.Minute
+
+// SnapshotCache 设备快照缓存：采集器每次列出设备和读取数据后写入，API 从中读取而不调用 smartctl
+//
+// 显式刷新时实时读取一次并写回缓存；同一设备的并发刷新合并为一次读取，
+// 距上一次实时读取不到 refreshInterval 时直接返回缓存。
+type SnapshotCache struct {
+	refreshInterval time.Duration
+	refreshTimeout  time.Duration
+
+	mu       sync.Mutex
+	devices  []smart.Device // 最近一次列出的设备
+	listedAt time.Time      // 为零表示还没有列出过设备
+	entries  map[string]*CacheEntry
+	lastLive map[string]time.Time // 每个设备最近一次实时读取的时间
+	lastList time.Time            // 最近一次实时列出设备的时间
+
+	flights flightGroup
+}
+
+// NewSnapshotCache 创建快照缓存，refreshInterval 为同一设备两次实时读取的最小间隔
+func NewSnapshotCache(refreshInterval time.Duration) *SnapshotCache {
+	return &SnapshotCache{
+		refreshInterval: refreshInterval,
+		refreshTimeout:  DefaultRefreshTimeout,
+		entries:         make(map[string]*CacheEntry),
+		lastLive:        make(map[string]time.Time),
+	}
+}
+
+// SetRefreshInterval 设置同一设备两次实时读取的最小间隔
+func (c *SnapshotCache) SetRefreshInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshInterval = interval
+}
+
+// SetRefreshTimeout 设置一次实时读取或重新列出设备的超时，smartctl 卡住时等待的请求在超时后返回
+func (c *SnapshotCache) SetRefreshTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshTimeout = timeout
+}
+
+// SetDevices 记录最近一次列出的设备，已移除设备的缓存一并删除
+func (c *SnapshotCache) SetDevices(devices []smart.Device) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	present := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		present[device.Name] = true
+		if e, ok := c.entries[device.Name]; ok {
+			e.Device = device
+		}
+	}
+	for name := range c.entries {
+		if !present[name] {
+			delete(c.entries, name)
+			delete(c.lastLive, name)
+		}
+	}
+	c.devices = append([]smart.Device(nil), devices...)
+	c.listedAt = time.Now()
+}
+
+// Put 写入一次成功的读取
+func (c *SnapshotCache) Put(name string, data *smart.SMARTData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entry(name)
+	e.Data = data
+	e.State = smart.PowerStateActive
+	e.Err = nil
+	e.CheckedAt = data.Timestamp
+}
+
+// PutStandby 记录一次因待机跳过的读取，保留之前读到的数据
+func (c *SnapshotCache) PutStandby(name string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entry(name)
+	e.State = smart.PowerStateStandby
+	e.Err = nil
+	e.CheckedAt = at
+}
+
+// PutError 记录一次失败的读取，保留之前读到的数据
+func (c *SnapshotCache) PutError(name string, err error, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.entry(name)
+	e.State = ""
+	e.Err = err
+	e.CheckedAt = at
+}
+
+// entry 返回设备的缓存项，没有时创建，调用方持有锁
+func (c *SnapshotCache) entry(name string) *CacheEntry {
+	e, ok := c.entries[name]
+	if !ok {
+		e = &CacheEntry{Device: smart.Device{Name: name}}
+		for _, d := range c.devices {
+			if d.Name == name {
+				e.Device = d
+			}
+		}
+		c.entries[name] = e
+	}
+	return e
+}
+
+// Get 按设备路径、设备标识或序列号返回缓存项，已列出但还没有读取过的设备返回只有设备信息的项
+func (c *SnapshotCache) Get(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e := c.lookup(key); e != nil {
+		return *e, true
+	}
+	for _, d := range c.devices {
+		if d.Name == key || d.Name == "/dev/"+key || (d.ID != "" && d.ID == key) || (d.Serial != "" && d.Serial == key) {
+			return CacheEntry{Device: d}, true
+		}
+	}
+	return CacheEntry{}, false
+}
+
+// lookup 查找缓存项，调用方持有锁
+func (c *SnapshotCache) lookup(key string) *CacheEntry {
+	if e, ok := c.entries[key]; ok {
+		return e
+	}
+	if !strings.HasPrefix(key, "/dev/") {
+		if e, ok := c.entries["/dev/"+key]; ok {
+			return e
+		}
+	}
+	for _, e := range c.entries {
+		if e.Data != nil && (e.Data.Device.ID == key || e.Data.Device.Serial == key) {
+			return e
+		}
+	}
+	return nil
+}
+
+// List 按最近一次列出的顺序返回所有设备的缓存项，ok 为 false 表示还没有列出过设备
+func (c *SnapshotCache) List() (entries []CacheEntry, listedAt time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.listedAt.IsZero() {
+		return nil, time.Time{}, false
+	}
+	entries = make([]CacheEntry, 0, len(c.devices))
+	for _, device := range c.devices {
+		if e, ok := c.entries[device.Name]; ok {
+			entries = append(entries, *e)
+		} else {
+			entries = append(entries, CacheEntry{Device: device})
+		}
+	}
+	return entries, c.listedAt, true
+}
+
+// Snapshots 返回每个设备最近一次成功读到的数据，按设备路径排序（只读，调用方不要修改）
+func (c *SnapshotCache) Snapshots() []*smart.SMARTData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshots := make([]*smart.SMARTData, 0, len(c.entries))
+	for _, e := range c.entries {
+		if e.Data != nil {
+			snapshots = append(snapshots, e.Data)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Device.Name < snapshots[j].Device.Name
+	})
+	return snapshots
+}
+
+// ErrRefreshLimited 距上一次实时读取不到刷新间隔，缓存中也没有可以返回的数据
+var ErrRefreshLimited = errors.New("refreshed too recently")
+
+// Refresh 实时读取设备并写回缓存，返回读取结果
+//
+// 距上一次实时读取不到刷新间隔时不再读取：有数据时返回缓存（来源为 cache），否则返回缓存的错误，
+// 之后只见过待机的设备返回包装的 smart.ErrStandby，其他情况返回 ErrRefreshLimited，不会反复唤醒硬盘。
+// 同一设备的并发刷新只调用一次 read，调用方的 ctx 结束时不再等待，但读取本身继续完成并写入缓存，
+// 供随后的请求使用。
+func (c *SnapshotCache) Refresh(ctx context.Context, name string, read func(ctx context.Context) (*smart.SMARTData, error)) (*Snapshot, error) {
+	c.mu.Lock()
+	if last, ok := c.lastLive[name]; ok && time.Since(last) < c.refreshInterval {
+		var entry CacheEntry
+		if e, ok := c.entries[name]; ok {
+			entry = *e
+		}
+		wait := c.refreshInterval - time.Since(last)
+		c.mu.Unlock()
+		switch {
+		case entry.Data != nil:
+			return newSnapshot(entry.Data, SourceCache, entry.State), nil
+		case entry.Err != nil:
+			return nil, entry.Err
+		case entry.State == smart.PowerStateStandby:
+			return nil, fmt.Errorf("%s: %w, next refresh in %v", name, smart.ErrStandby, wait.Round(time.Second))
+		default:
+			return nil, fmt.Errorf("%s: %w, next refresh in %v", name, ErrRefreshLimited, wait.Round(time.Second))
+		}
+	}
+	timeout := c.refreshTimeout
+	c.mu.Unlock()
+
+	v, err := c.flights.Do(ctx, name, func() (interface{}, error) {
+		// 读取不随第一个调用方的请求取消，但总有超时，smartctl 卡住时不会让等待的请求一直挂起
+		readCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		data, err := read(readCtx)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		now := time.Now()
+		c.lastLive[name] = now
+		e := c.entry(name)
+		if err != nil {
+			e.State = ""
+			e.Err = err
+			e.CheckedAt = now
+			return nil, err
+		}
+		if data.Timestamp.IsZero() {
+			data.Timestamp = now
+		}
+		e.Data = data
+		e.State = smart.PowerStateActive
+		e.Err = nil
+		e.CheckedAt = data.Timestamp
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshot(v.(*smart.SMARTData), SourceLive, smart.PowerStateActive), nil
+}
+
+// RefreshList 实时重新列出设备，list 负责列出并写回缓存；距上一次不到刷新间隔时直接返回，
+// 并发调用合并为一次
+func (c *SnapshotCache) RefreshList(ctx context.Context, list func(ctx context.Context) error) error {
+	c.mu.Lock()
+	recent := !c.lastList.IsZero() && time.Since(c.lastList) < c.refreshInterval
+	timeout := c.refreshTimeout
+	c.mu.Unlock()
+	if recent {
+		return nil
+	}
+
+	// 设备路径不会为空，用空键表示列出设备
+	_, err := c.flights.Do(ctx, "", func() (interface{}, error) {
+		listCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		err := list(listCtx)
+		c.mu.Lock()
+		c.lastList = time.Now()
+		c.mu.Unlock()
+		return nil, err
+	})
+	return err
+}
+
+// flightGroup 合并对同一个键的并发调用，后来的调用方等待第一个调用的结果
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall 一次进行中的调用
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// Do 执行 fn，同一个键已有调用在进行时等待它的结果；ctx 结束时返回 ctx 的错误，fn 继续在后台完成
+func (g *flightGroup) Do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go func() {
+			call.val, call.err = fn()
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
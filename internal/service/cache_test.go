@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+func TestRefreshLimitsStandbyDevice(t *testing.T) {
+	cache := NewSnapshotCache(time.Minute)
+	reads := 0
+	read := func(err error) func(ctx context.Context) (*smart.SMARTData, error) {
+		return func(ctx context.Context) (*smart.SMARTData, error) {
+			reads++
+			return nil, err
+		}
+	}
+	ctx := context.Background()
+
+	// 第一次刷新失败，之后采集器只看到设备在待机
+	if _, err := cache.Refresh(ctx, "/dev/sda", read(smart.ErrDeviceBusy)); !errors.Is(err, smart.ErrDeviceBusy) {
+		t.Fatalf("first Refresh = %v, want ErrDeviceBusy", err)
+	}
+	cache.PutStandby("/dev/sda", time.Now())
+
+	// 刷新间隔内不再读取（不唤醒硬盘），返回待机错误
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Refresh(ctx, "/dev/sda", read(nil)); !errors.Is(err, smart.ErrStandby) {
+			t.Errorf("Refresh of a standby device = %v, want ErrStandby", err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("read called %d times, want 1", reads)
+	}
+
+	// 之前读到过数据时返回缓存，电源状态为待机
+	cache.Put("/dev/sda", &smart.SMARTData{Timestamp: time.Now(), Temperature: 35})
+	cache.PutStandby("/dev/sda", time.Now())
+	snap, err := cache.Refresh(ctx, "/dev/sda", read(nil))
+	if err != nil {
+		t.Fatalf("Refresh with cached data: %v", err)
+	}
+	if snap.Source != SourceCache || snap.PowerState != smart.PowerStateStandby || snap.Temperature != 35 {
+		t.Errorf("Refresh = %+v, want the cached snapshot in standby", snap)
+	}
+	if reads != 1 {
+		t.Errorf("read called %d times, want 1", reads)
+	}
+}
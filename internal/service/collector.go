@@ -1,29 +1,91 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"log"
+	"sort"
+	"sync"
 	"time"
 
+	"smart-cat/internal/alert"
 	"smart-cat/internal/smart"
 	"smart-cat/internal/storage"
+	"smart-cat/internal/trend"
 )
 
+// 设备采集状态
+const (
+	StatusOK       = "ok"       // 采集并保存成功
+	StatusError    = "error"    // smartctl 或存储失败
+	StatusTimeout  = "timeout"  // 超过单设备超时被终止
+	StatusCanceled = "canceled" // 采集器停止时被中断
+	StatusStandby  = "standby"  // 设备待机，为避免唤醒跳过读取
+)
+
+// DeviceStatus 单个设备最近一次采集的结果
+type DeviceStatus struct {
+	Device    string        `json:"device"`
+	ID        string        `json:"id,omitempty"`
+	Serial    string        `json:"serial,omitempty"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// CollectorStats 采集器运行统计
+type CollectorStats struct {
+	Runs          int64            `json:"runs"`           // 完成的采集轮数
+	LastRun       time.Time        `json:"last_run"`       // 最近一轮完成时间
+	LastSuccess   time.Time        `json:"last_success"`   // 最近一轮全部设备成功的完成时间
+	LastDuration  time.Duration    `json:"last_duration"`  // 最近一轮耗时
+	DeviceErrors  map[string]int64 `json:"device_errors"`  // 每个设备累计失败次数
+	LastRetention time.Time        `json:"last_retention"` // 最近一次成功执行保留策略的时间
+}
+
 // Collector 数据采集服务
+//
+// storage 为 nil 时只采集不保存（agent 模式），数据通过 OnSample 回调交给推送端。
+// 采集开始和结束、设备出现和消失、读到新数据以及告警状态变化都发布到 Events 返回的事件总线。
 type Collector struct {
 	detector *smart.DeviceDetector
 	storage  storage.Storage
 	config   *smart.CollectorConfig
+	alerts   *alert.Engine
+	trend    *trend.Analyzer
+	power    *PowerTracker
+	onSample []func(Sample)
+	events   *EventBus
+	cache    *SnapshotCache
 	ticker   *time.Ticker
-	stopChan chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	retentionInterval time.Duration // 为 0 时不执行保留策略
+
+	mu       sync.Mutex
+	statuses map[string]DeviceStatus
+	devices  map[string]smart.Device // 上一轮列出的设备，用于发现新增和移除
+	stats    CollectorStats
 }
 
 // NewCollector 创建数据采集服务
 func NewCollector(detector *smart.DeviceDetector, storage storage.Storage, config *smart.CollectorConfig) *Collector {
+	ctx, cancel := context.WithCancel(context.Background())
+	power, _ := NewPowerTracker("") // 不持久化时不会出错
 	return &Collector{
 		detector: detector,
 		storage:  storage,
 		config:   config,
-		stopChan: make(chan struct{}),
+		power:    power,
+		events:   NewEventBus(DefaultEventBufferSize),
+		cache:    NewSnapshotCache(0),
+		ctx:      ctx,
+		cancel:   cancel,
+		statuses: make(map[string]DeviceStatus),
+		devices:  make(map[string]smart.Device),
+		stats:    CollectorStats{DeviceErrors: make(map[string]int64)},
 	}
 }
 
@@ -40,57 +102,359 @@ func (c *Collector) Start() {
 	defer c.ticker.Stop()
 
 	// 启动时立即采集一次
-	c.collectAll()
+	c.collectAll(c.ctx)
+	c.applyRetention()
 
 	for {
 		select {
 		case <-c.ticker.C:
-			c.collectAll()
-		case <-c.stopChan:
+			c.collectAll(c.ctx)
+			c.applyRetention()
+		case <-c.ctx.Done():
 			log.Println("Collector stopped")
 			return
 		}
 	}
 }
 
-// Stop 停止采集器
+// Stop 停止采集器，并中断正在执行的 smartctl
 func (c *Collector) Stop() {
 	if c.ticker != nil {
 		c.ticker.Stop()
 	}
-	close(c.stopChan)
+	c.cancel()
+}
+
+// SetRetentionInterval 设置执行存储保留策略的间隔，在采集之后检查是否到期
+func (c *Collector) SetRetentionInterval(interval time.Duration) {
+	c.retentionInterval = interval
+}
+
+// applyRetention 距上次执行超过间隔时执行存储保留策略
+func (c *Collector) applyRetention() {
+	if c.storage == nil || c.retentionInterval <= 0 || c.ctx.Err() != nil {
+		return
+	}
+
+	c.mu.Lock()
+	due := time.Since(c.stats.LastRetention) >= c.retentionInterval
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+
+	start := time.Now()
+	if err := c.storage.ApplyRetention(); err != nil {
+		log.Printf("Failed to apply retention: %v", err)
+		return
+	}
+	log.Printf("Retention applied in %v", time.Since(start))
+
+	c.mu.Lock()
+	c.stats.LastRetention = time.Now()
+	c.mu.Unlock()
+}
+
+// Statuses 返回每个设备最近一次的采集结果
+func (c *Collector) Statuses() []DeviceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := make([]DeviceStatus, 0, len(c.statuses))
+	for _, status := range c.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Device < statuses[j].Device
+	})
+	return statuses
+}
+
+// Snapshots 返回每个设备最近一次成功采集的快照（只读，调用方不要修改）
+func (c *Collector) Snapshots() []*smart.SMARTData {
+	return c.cache.Snapshots()
+}
+
+// Cache 返回采集器写入的快照缓存
+func (c *Collector) Cache() *SnapshotCache {
+	return c.cache
+}
+
+// Stats 返回采集器运行统计
+func (c *Collector) Stats() CollectorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.DeviceErrors = make(map[string]int64, len(c.stats.DeviceErrors))
+	for device, count := range c.stats.DeviceErrors {
+		stats.DeviceErrors[device] = count
+	}
+	return stats
 }
 
-// collectAll 采集所有设备的 SMART 数据
-func (c *Collector) collectAll() {
+// collectAll 并发采集所有设备的 SMART 数据
+func (c *Collector) collectAll(ctx context.Context) {
 	log.Println("Starting SMART data collection...")
+	start := time.Now()
+	c.events.Publish(EventCollectionStarted, nil)
 
-	devices, err := c.detector.ListDevices()
+	devices, err := c.detector.ListDevices(ctx)
 	if err != nil {
 		log.Printf("Failed to list devices: %v", err)
+		c.events.Publish(EventCollectionFinished, CollectionSummary{
+			StartedAt: start,
+			Duration:  time.Since(start),
+			Error:     err.Error(),
+		})
 		return
 	}
+	c.trackDevices(devices)
+	c.cache.SetDevices(devices)
+
+	workers := c.config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	// 信号量限制同时运行的 smartctl 数量
+	sem := make(chan struct{}, workers)
+	results := make([]DeviceStatus, len(devices))
+
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device smart.Device) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = c.collectDevice(ctx, device)
+		}(i, device)
+	}
+	wg.Wait()
 
 	successCount := 0
+	c.mu.Lock()
+	// 已移除的设备不再保留状态和错误计数
+	for name := range c.statuses {
+		if _, ok := c.devices[name]; !ok {
+			delete(c.statuses, name)
+		}
+	}
+	for name := range c.stats.DeviceErrors {
+		if _, ok := c.devices[name]; !ok {
+			delete(c.stats.DeviceErrors, name)
+		}
+	}
+	for _, status := range results {
+		c.statuses[status.Device] = status
+		if status.Status == StatusOK || status.Status == StatusStandby {
+			successCount++
+		} else {
+			c.stats.DeviceErrors[status.Device]++
+		}
+	}
+	c.stats.Runs++
+	c.stats.LastRun = time.Now()
+	c.stats.LastDuration = c.stats.LastRun.Sub(start)
+	if successCount == len(devices) {
+		c.stats.LastSuccess = c.stats.LastRun
+	}
+	c.mu.Unlock()
+
+	log.Printf("Collection completed. Successfully collected %d/%d devices", successCount, len(devices))
+	c.events.Publish(EventCollectionFinished, CollectionSummary{
+		StartedAt: start,
+		Duration:  time.Since(start),
+		Devices:   len(devices),
+		Succeeded: successCount,
+	})
+}
+
+// trackDevices 与上一轮列出的设备比较，发布设备新增和移除事件
+func (c *Collector) trackDevices(devices []smart.Device) {
+	c.mu.Lock()
+	previous := c.devices
+	c.devices = make(map[string]smart.Device, len(devices))
+	for _, device := range devices {
+		c.devices[device.Name] = device
+	}
+	c.mu.Unlock()
+
 	for _, device := range devices {
-		data, err := c.detector.GetSMARTData(device.Name)
-		if err != nil {
-			log.Printf("Failed to get SMART data for %s: %v", device.Name, err)
-			continue
+		if _, ok := previous[device.Name]; !ok {
+			c.events.Publish(EventDeviceAdded, device)
+		}
+	}
+	for name, device := range previous {
+		if _, ok := c.devices[name]; !ok {
+			c.events.Publish(EventDeviceRemoved, device)
+		}
+	}
+}
+
+// collectDevice 在单设备超时内采集并保存一个设备
+func (c *Collector) collectDevice(ctx context.Context, device smart.Device) DeviceStatus {
+	if c.config.DeviceTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.DeviceTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	status := DeviceStatus{Device: device.Name, Timestamp: start}
+
+	var data *smart.SMARTData
+	var err error
+	if c.skipStandby(device.Name) {
+		data, err = c.detector.GetSMARTDataIfActive(ctx, device.Name)
+	} else {
+		data, err = c.detector.GetSMARTData(ctx, device.Name)
+	}
+	status.Duration = time.Since(start)
+	if errors.Is(err, smart.ErrStandby) {
+		return c.recordStandby(device, status)
+	}
+	if err != nil {
+		log.Printf("Failed to get SMART data for %s: %v", device.Name, err)
+		if c.ctx.Err() == nil {
+			c.cache.PutError(device.Name, err, start)
 		}
+		status.Status = statusFromError(err)
+		status.Error = err.Error()
+		return status
+	}
 
-		// 设置采集时间
-		data.Timestamp = time.Now()
+	// 设置采集时间
+	data.Timestamp = time.Now()
+	status.ID = data.Device.ID
+	status.Serial = data.Device.Serial
+	key := data.Device.Key()
 
-		if err := c.storage.SaveRecord(data.Device.Serial, data); err != nil {
+	if c.storage != nil {
+		if err := c.storage.SaveRecord(key, data); err != nil {
 			log.Printf("Failed to save record for %s: %v", device.Name, err)
-		} else {
-			log.Printf("Collected data for %s (S/N: %s)", device.Name, data.Device.Serial)
-			successCount++
+			status.Status = StatusError
+			status.Error = err.Error()
+			return status
+		}
+
+		if err := c.storage.SaveAttributes(key, data.Timestamp, data.Attributes); err != nil {
+			// 属性表是附加数据，失败不影响汇总记录
+			log.Printf("Failed to save attributes for %s: %v", device.Name, err)
+		}
+		if err := c.storage.SavePowerState(key, data.Timestamp, smart.PowerStateActive); err != nil {
+			log.Printf("Failed to save power state for %s: %v", device.Name, err)
+		}
+	}
+	if c.trend != nil && c.storage != nil {
+		// 趋势在告警规则评估之前写入快照，规则可以引用预测的剩余天数
+		if err := c.trend.Apply(c.storage, key, data); err != nil {
+			log.Printf("Failed to analyze trend for %s: %v", device.Name, err)
 		}
 	}
+	c.power.Active(data.Device, data.Timestamp)
+	c.emit(Sample{Device: data.Device, Timestamp: data.Timestamp, State: smart.PowerStateActive, Data: data})
 
-	log.Printf("Collection completed. Successfully collected %d/%d devices", successCount, len(devices))
+	if c.alerts != nil {
+		if _, err := c.alerts.Evaluate(data); err != nil {
+			log.Printf("Failed to evaluate alerts for %s: %v", device.Name, err)
+		}
+	}
+
+	c.cache.Put(device.Name, data)
+	c.events.Publish(EventSnapshotUpdated, data)
+
+	log.Printf("Collected data for %s (ID: %s, S/N: %s)", device.Name, key, data.Device.Serial)
+	status.Status = StatusOK
+	return status
+}
+
+// skipStandby 判断本次采集是否在设备待机时跳过：连续跳过达到上限后强制读取一次
+func (c *Collector) skipStandby(device string) bool {
+	if !c.config.SkipStandby {
+		return false
+	}
+	if c.config.MaxStandbySkips <= 0 {
+		return true
+	}
+	p, _ := c.power.Get(device)
+	return p.Skips < c.config.MaxStandbySkips
+}
+
+// recordStandby 记录一次因待机跳过的采集，沿用最近一次读到的设备标识保存待机采样
+func (c *Collector) recordStandby(device smart.Device, status DeviceStatus) DeviceStatus {
+	now := time.Now()
+	p := c.power.Standby(device.Name, now)
+	c.cache.PutStandby(device.Name, now)
+
+	status.Status = StatusStandby
+	status.Error = "skipped: standby"
+	status.ID = p.Device.ID
+	status.Serial = p.Device.Serial
+	key := p.Device.Key()
+	if key == "" {
+		// 从未读到过这个设备，无法归属
+		log.Printf("Skipped %s: standby (%d consecutive)", device.Name, p.Skips)
+		return status
+	}
+
+	if c.storage != nil {
+		if err := c.storage.SavePowerState(key, now, smart.PowerStateStandby); err != nil {
+			log.Printf("Failed to save power state for %s: %v", device.Name, err)
+		}
+	}
+	c.emit(Sample{Device: p.Device, Timestamp: now, State: smart.PowerStateStandby})
+	log.Printf("Skipped %s (ID: %s): standby (%d consecutive)", device.Name, key, p.Skips)
+	return status
+}
+
+// statusFromError 根据错误类型确定采集状态
+func statusFromError(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return StatusTimeout
+	case errors.Is(err, context.Canceled):
+		return StatusCanceled
+	default:
+		return StatusError
+	}
+}
+
+// SetPowerTracker 设置电源状态记录（默认只保存在内存中）
+func (c *Collector) SetPowerTracker(tracker *PowerTracker) {
+	c.power = tracker
+}
+
+// OnSample 注册采集回调：每次读到设备数据或因待机跳过时调用（agent 模式用于推送）
+func (c *Collector) OnSample(fn func(Sample)) {
+	c.onSample = append(c.onSample, fn)
+}
+
+// emit 调用采集回调
+func (c *Collector) emit(sample Sample) {
+	for _, fn := range c.onSample {
+		fn(sample)
+	}
+}
+
+// SetAlertEngine 设置告警引擎，每次采集成功后评估规则，告警状态变化发布到事件总线
+func (c *Collector) SetAlertEngine(engine *alert.Engine) {
+	c.alerts = engine
+	engine.OnChange(func(a alert.Alert) {
+		c.events.Publish(EventAlertChanged, a)
+	})
+}
+
+// SetTrendAnalyzer 设置趋势分析器，每次采集成功后按历史预测剩余天数（不保存历史时不分析）
+func (c *Collector) SetTrendAnalyzer(analyzer *trend.Analyzer) {
+	c.trend = analyzer
+}
+
+// Events 返回采集器的事件总线
+func (c *Collector) Events() *EventBus {
+	return c.events
 }
 
 // SetConfig 更新配置
@@ -102,4 +466,4 @@ func (c *Collector) SetConfig(config *smart.CollectorConfig) {
 		c.ticker.Stop()
 		c.ticker = time.NewTicker(c.config.Interval)
 	}
-}
\ No newline at end of file
+}
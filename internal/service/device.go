@@ -1,31 +1,99 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"smart-cat/internal/identity"
 	"smart-cat/internal/smart"
 	"smart-cat/internal/storage"
+	"smart-cat/internal/trend"
 )
 
 // DeviceService 设备管理服务
 type DeviceService struct {
-	detector *smart.DeviceDetector
-	storage  storage.Storage
+	detector      *smart.DeviceDetector
+	storage       storage.Storage
+	historyWindow time.Duration      // 未指定 from 时的默认查询窗口
+	power         *PowerTracker      // 不为 nil 时列出设备不唤醒待机的硬盘
+	resolver      *identity.Resolver // 把 API 中的设备标识、序列号转换为存储键和设备路径
+	aggregator    *Aggregator        // 不为 nil 时同时列出 agent 推送的其他主机的设备
+	host          string             // 汇聚模式下本机的主机名
+	readTimeout   time.Duration      // 实时读取 SMART 数据的超时，0 表示不限制
+	cache         *SnapshotCache     // 设备列表和 SMART 数据的缓存
+	live          bool               // 缓存不由采集器填充，每次读取都实时读取
+	trend         *trend.Analyzer    // 不为 nil 时实时读取的数据也附带趋势预测
 }
 
+// ErrUnknownHost 查询的主机没有推送过数据
+var ErrUnknownHost = errors.New("unknown host")
+
 // NewDeviceService 创建设备服务
 func NewDeviceService(detector *smart.DeviceDetector, storage storage.Storage) *DeviceService {
 	return &DeviceService{
-		detector: detector,
-		storage:  storage,
+		detector:      detector,
+		storage:       storage,
+		historyWindow: 7 * 24 * time.Hour,
+		cache:         NewSnapshotCache(0),
+		live:          true,
 	}
 }
 
-// GetAllDevices 获取所有设备信息
-func (s *DeviceService) GetAllDevices() ([]smart.DeviceInfo, error) {
-	devices, err := s.detector.ListDevices()
-	if err != nil {
-		return nil, err
+// SetTrendAnalyzer 设置趋势分析器，实时读取的数据按本机历史预测剩余天数
+func (s *DeviceService) SetTrendAnalyzer(analyzer *trend.Analyzer) {
+	s.trend = analyzer
+}
+
+// SetSnapshotCache 使用采集器填充的快照缓存，之后列出设备和读取 SMART 数据默认从缓存返回，
+// 只有显式刷新时才调用 smartctl
+func (s *DeviceService) SetSnapshotCache(cache *SnapshotCache) {
+	s.cache = cache
+	s.live = false
+}
+
+// SetHistoryWindow 设置历史查询的默认时间窗口
+func (s *DeviceService) SetHistoryWindow(window time.Duration) {
+	s.historyWindow = window
+}
+
+// SetReadTimeout 设置实时读取 SMART 数据的超时
+func (s *DeviceService) SetReadTimeout(timeout time.Duration) {
+	s.readTimeout = timeout
+}
+
+// SetIdentityResolver 设置设备标识解析器
+func (s *DeviceService) SetIdentityResolver(resolver *identity.Resolver) {
+	s.resolver = resolver
+}
+
+// SetAggregator 设置汇聚端，host 为本机的主机名，本机设备也带上主机维度
+func (s *DeviceService) SetAggregator(aggregator *Aggregator, host string) {
+	s.aggregator = aggregator
+	s.host = host
+}
+
+// SetPowerTracker 设置电源状态记录，之后列出设备时不唤醒待机的硬盘
+func (s *DeviceService) SetPowerTracker(tracker *PowerTracker) {
+	s.power = tracker
+}
+
+// GetAllDevices 获取所有设备信息，默认从快照缓存返回，refresh 为 true 时重新列出设备并实时读取
+func (s *DeviceService) GetAllDevices(ctx context.Context, refresh bool) ([]smart.DeviceInfo, error) {
+	entries, _, listed := s.cache.List()
+	if refresh || s.live || !listed {
+		err := s.cache.RefreshList(ctx, s.listDevices)
+		if err != nil {
+			if s.aggregator == nil {
+				return nil, err
+			}
+			// 汇聚端本机可以没有硬盘或 smartctl，仍然列出其他主机的设备
+			return s.aggregator.Devices(time.Now().Add(-s.historyWindow)), nil
+		}
+		entries, _, _ = s.cache.List()
 	}
 
 	// 获取所有已记录的序列号
@@ -35,50 +103,296 @@ func (s *DeviceService) GetAllDevices() ([]smart.DeviceInfo, error) {
 		serialMap[s] = true
 	}
 
-	var deviceInfos []smart.DeviceInfo
+	deviceInfos := make([]smart.DeviceInfo, 0, len(entries))
+	for _, e := range entries {
+		deviceInfos = append(deviceInfos, s.deviceInfo(e, serialMap))
+	}
+
+	if s.aggregator != nil {
+		for i := range deviceInfos {
+			deviceInfos[i].Host = s.host
+		}
+		deviceInfos = append(deviceInfos, s.aggregator.Devices(time.Now().Add(-s.historyWindow))...)
+	}
+
+	return deviceInfos, nil
+}
+
+// listDevices 列出设备并逐个读取 SMART 数据，结果写入缓存
+func (s *DeviceService) listDevices(ctx context.Context) error {
+	devices, err := s.detector.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	s.cache.SetDevices(devices)
+
 	for _, device := range devices {
 		// 尝试获取 SMART 数据来检测设备是否可读
-		data, err := s.detector.GetSMARTData(device.Name)
-		if err != nil {
-			// 添加无法读取的设备信息
-			deviceInfos = append(deviceInfos, smart.DeviceInfo{
-				Device: smart.Device{
-					Name:       device.Name,
-					Model:      "无法读取",
-					Serial:     "unknown",
-					DeviceType: "Unknown",
-					CapacityGB: device.CapacityGB,
-					IsExternal: device.IsExternal,
-				},
-				HasHistory:   false,
-				Error:        err.Error(),
-				ErrorMessage: "无法读取 SMART 数据（可能是不支持的 USB 桥接芯片）",
-			})
-			continue
+		now := time.Now()
+		data, err := s.readDevice(ctx, device.Name, s.power != nil)
+		switch {
+		case errors.Is(err, smart.ErrStandby):
+			s.cache.PutStandby(device.Name, now)
+		case err != nil:
+			s.cache.PutError(device.Name, err, now)
+		default:
+			data.Timestamp = now
+			if s.power != nil {
+				s.power.Active(data.Device, now)
+			}
+			s.cache.Put(device.Name, data)
 		}
+	}
+	return nil
+}
 
-		deviceInfos = append(deviceInfos, smart.DeviceInfo{
-			Device:     data.Device,
-			HasHistory: serialMap[data.Device.Serial],
-		})
+// readDevice 在读取超时内读取设备，noWake 为 true 时不唤醒待机的硬盘
+func (s *DeviceService) readDevice(ctx context.Context, name string, noWake bool) (*smart.SMARTData, error) {
+	if s.readTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.readTimeout)
+		defer cancel()
 	}
+	var data *smart.SMARTData
+	var err error
+	if noWake {
+		data, err = s.detector.GetSMARTDataIfActive(ctx, name)
+	} else {
+		data, err = s.detector.GetSMARTData(ctx, name)
+	}
+	if err == nil && s.trend != nil {
+		if data.Timestamp.IsZero() {
+			data.Timestamp = time.Now()
+		}
+		if err := s.trend.Apply(s.storage, data.Device.Key(), data); err != nil {
+			log.Printf("Failed to analyze trend for %s: %v", name, err)
+		}
+	}
+	return data, err
+}
 
-	return deviceInfos, nil
+// deviceInfo 把缓存项转换为设备列表中的一项
+func (s *DeviceService) deviceInfo(e CacheEntry, serialMap map[string]bool) smart.DeviceInfo {
+	var info smart.DeviceInfo
+	switch {
+	case e.State == smart.PowerStateStandby:
+		// 待机的设备使用最近一次读到的信息
+		info = smart.DeviceInfo{Device: e.Device, PowerState: smart.PowerStateStandby}
+		known := smart.Device{}
+		if e.Data != nil {
+			known = e.Data.Device
+		} else if s.power != nil {
+			if p, ok := s.power.Get(e.Device.Name); ok {
+				known = p.Device
+			}
+		}
+		if known.Key() != "" {
+			info.Device = known
+			info.Device.CapacityGB = e.Device.CapacityGB
+			info.Device.IsExternal = e.Device.IsExternal
+			info.HasHistory = serialMap[known.Key()]
+			info.AsleepPercent = s.asleepPercent(known.Key())
+		}
+	case e.Err != nil:
+		// 添加无法读取的设备信息
+		info = smart.DeviceInfo{
+			Device: smart.Device{
+				Name:       e.Device.Name,
+				Model:      "无法读取",
+				Serial:     "unknown",
+				DeviceType: "Unknown",
+				CapacityGB: e.Device.CapacityGB,
+				IsExternal: e.Device.IsExternal,
+			},
+			Error:        e.Err.Error(),
+			ErrorMessage: "无法读取 SMART 数据（可能是不支持的 USB 桥接芯片）",
+		}
+		if e.Data != nil {
+			// 之前读到过，保留设备信息
+			info.Device = e.Data.Device
+			info.HasHistory = serialMap[e.Data.Device.Key()]
+			info.ErrorMessage = "最近一次读取 SMART 数据失败"
+		}
+	case e.Data != nil:
+		info = smart.DeviceInfo{
+			Device:        e.Data.Device,
+			HasHistory:    serialMap[e.Data.Device.Key()],
+			PowerState:    smart.PowerStateActive,
+			AsleepPercent: s.asleepPercent(e.Data.Device.Key()),
+		}
+	default:
+		// 已列出但还没有读取过
+		info = smart.DeviceInfo{Device: e.Device}
+	}
+
+	if e.Data != nil {
+		updated := e.Data.Timestamp
+		ageSeconds := age(updated)
+		info.LastSeen = &updated
+		info.AgeSeconds = &ageSeconds
+		info.Trend = e.Data.Trend
+	}
+	return info
+}
+
+// isLocal 判断主机是否为本机（为空或与本机主机名相同）
+func (s *DeviceService) isLocal(host string) bool {
+	return host == "" || s.aggregator == nil || host == s.host
+}
+
+// asleepPercent 历史查询窗口内待机采样的占比，没有采样时返回 nil
+func (s *DeviceService) asleepPercent(serial string) *float64 {
+	stats, err := s.storage.GetPowerStats(serial, time.Now().Add(-s.historyWindow), time.Time{})
+	if err != nil || stats.Samples == 0 {
+		return nil
+	}
+	return &stats.AsleepPercent
 }
 
-// GetSMARTData 获取指定设备的实时 SMART 数据
-func (s *DeviceService) GetSMARTData(deviceName string) (*smart.SMARTData, error) {
-	return s.detector.GetSMARTData(deviceName)
+// GetSMARTData 获取指定设备的实时 SMART 数据，device 可以是设备路径或设备标识
+func (s *DeviceService) GetSMARTData(ctx context.Context, device string) (*smart.SMARTData, error) {
+	return s.readDevice(ctx, s.DevicePath(device), false)
 }
 
-// GetHistory 获取指定设备的历史数据
+// GetSnapshot 获取本机设备的 SMART 数据，默认从快照缓存返回，refresh 为 true 或缓存中没有数据时实时读取；
+// 使用采集器的缓存时只读取设备列表中的设备
+func (s *DeviceService) GetSnapshot(ctx context.Context, device string, refresh bool) (*Snapshot, error) {
+	name := s.DevicePath(device)
+	e, ok := s.cache.Get(name)
+	if !ok {
+		e, ok = s.cache.Get(device)
+	}
+	if !ok && !s.live {
+		// 缓存由采集器填充，列出设备之后不在设备列表中的标识不实时读取
+		if _, _, listed := s.cache.List(); listed {
+			return nil, fmt.Errorf("%w: %s", smart.ErrDeviceNotFound, device)
+		}
+	}
+	if ok {
+		name = e.Device.Name
+		if !refresh && !s.live {
+			if e.Data != nil {
+				return newSnapshot(e.Data, SourceCache, e.State), nil
+			}
+			if e.Err != nil {
+				return nil, e.Err
+			}
+		}
+	}
+
+	return s.cache.Refresh(ctx, name, func(ctx context.Context) (*smart.SMARTData, error) {
+		return s.readDevice(ctx, name, false)
+	})
+}
+
+// GetHostSMARTData 获取指定主机上设备的 SMART 数据：本机见 GetSnapshot，其他主机返回 agent 最近一次推送的数据
+func (s *DeviceService) GetHostSMARTData(ctx context.Context, host, device string, refresh bool) (*Snapshot, error) {
+	if s.isLocal(host) {
+		snap, err := s.GetSnapshot(ctx, device, refresh)
+		if err == nil && s.aggregator != nil {
+			// 缓存中的数据是共享的，复制后再设置主机
+			data := *snap.SMARTData
+			data.Device.Host = s.host
+			snap.SMARTData = &data
+		}
+		return snap, err
+	}
+	data, ok := s.aggregator.Snapshot(host, device)
+	if !ok {
+		return nil, fmt.Errorf("%w: no data for %s on %s", ErrUnknownHost, device, host)
+	}
+	return newSnapshot(data, SourceAgent, ""), nil
+}
+
+// DevicePath 把设备标识转换为最近一次出现的设备路径，不是已知标识时原样返回
+func (s *DeviceService) DevicePath(device string) string {
+	if s.resolver != nil && !strings.HasPrefix(device, "/dev/") {
+		if ident, ok := s.resolver.Lookup(device); ok && ident.Device != "" {
+			return ident.Device
+		}
+	}
+	return device
+}
+
+// StorageKey 把设备标识、序列号或设备路径转换为存储键，找不到时原样返回（兼容迁移前以序列号命名的数据）
+func (s *DeviceService) StorageKey(key string) string {
+	if s.resolver != nil {
+		if ident, ok := s.resolver.Lookup(key); ok {
+			return ident.ID
+		}
+	}
+	return key
+}
+
+// GetHistory 获取指定设备的历史数据，serial 可以是设备标识或序列号
 func (s *DeviceService) GetHistory(serial string, from, to time.Time) ([]smart.HistoryRecord, error) {
-	// 默认最近7天
 	if from.IsZero() {
-		from = time.Now().AddDate(0, 0, -7)
+		from = time.Now().Add(-s.historyWindow)
 	}
 
-	return s.storage.GetHistory(serial, from, to)
+	return s.storage.GetHistory(s.StorageKey(serial), from, to)
+}
+
+// ExportHistory 获取指定设备用于导出的历史数据，from 为零时不限定起点（导出全部历史），
+// 分辨率由存储按设备实际保存的最早数据选择
+func (s *DeviceService) ExportHistory(serial string, from, to time.Time) ([]smart.HistoryRecord, error) {
+	return s.storage.GetHistory(s.StorageKey(serial), from, to)
+}
+
+// GetHostHistory 获取指定主机上设备的历史数据，host 为空或为本机时查询本机数据
+func (s *DeviceService) GetHostHistory(host, key string, from, to time.Time) ([]smart.HistoryRecord, error) {
+	if s.isLocal(host) {
+		return s.GetHistory(key, from, to)
+	}
+	store, err := s.hostStorage(host)
+	if err != nil {
+		return nil, err
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-s.historyWindow)
+	}
+	return store.GetHistory(s.remoteKey(host, key), from, to)
+}
+
+// GetHostAttributeHistory 获取指定主机上设备单个 SMART 属性的历史数据
+func (s *DeviceService) GetHostAttributeHistory(host, key string, id int, from, to time.Time) ([]smart.AttributeRecord, error) {
+	if s.isLocal(host) {
+		return s.GetAttributeHistory(key, id, from, to)
+	}
+	store, err := s.hostStorage(host)
+	if err != nil {
+		return nil, err
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-s.historyWindow)
+	}
+	return store.GetAttributeHistory(s.remoteKey(host, key), id, from, to)
+}
+
+// hostStorage 返回其他主机的存储
+func (s *DeviceService) hostStorage(host string) (storage.Storage, error) {
+	store, ok := s.aggregator.Storage(host)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownHost, host)
+	}
+	return store, nil
+}
+
+// remoteKey 把其他主机上设备的序列号或设备路径转换为设备标识，找不到时原样返回
+func (s *DeviceService) remoteKey(host, key string) string {
+	if data, ok := s.aggregator.Snapshot(host, key); ok {
+		return data.Device.Key()
+	}
+	return key
+}
+
+// GetAttributeHistory 获取指定设备单个 SMART 属性的历史数据
+func (s *DeviceService) GetAttributeHistory(serial string, id int, from, to time.Time) ([]smart.AttributeRecord, error) {
+	if from.IsZero() {
+		from = time.Now().Add(-s.historyWindow)
+	}
+
+	return s.storage.GetAttributeHistory(s.StorageKey(serial), id, from, to)
 }
 
 // CleanOldRecords 清理旧记录
@@ -89,4 +403,4 @@ func (s *DeviceService) CleanOldRecords(days int) error {
 // CheckDependencies 检查系统依赖
 func (s *DeviceService) CheckDependencies() error {
 	return s.detector.CheckSmartctlInstalled()
-}
\ No newline at end of file
+}
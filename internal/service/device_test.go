@@ -0,0 +1,23 @@
+package service
+
+import (
+	"testing"
+
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+)
+
+func TestDeviceInfoStandbyWithoutPowerTracker(t *testing.T) {
+	store, err := storage.NewCSVStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewDeviceService(nil, store)
+
+	// 采集器记录了待机，但设备服务没有设置电源状态记录
+	e := CacheEntry{Device: smart.Device{Name: "/dev/sda"}, State: smart.PowerStateStandby}
+	info := s.deviceInfo(e, nil)
+	if info.PowerState != smart.PowerStateStandby || info.Name != "/dev/sda" {
+		t.Errorf("deviceInfo = %+v, want /dev/sda in standby", info)
+	}
+}
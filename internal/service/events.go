@@ -0,0 +1,140 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	EventCollectionStarted  = "collection_started"  // 一轮采集开始
+	EventCollectionFinished = "collection_finished" // 一轮采集结束，数据为 CollectionSummary
+	EventDeviceAdded        = "device_added"        // 新出现的设备，数据为 smart.Device
+	EventDeviceRemoved      = "device_removed"      // 消失的设备，数据为 smart.Device
+	EventSnapshotUpdated    = "snapshot_updated"    // 读到设备的新数据，数据为 smart.SMARTData
+	EventAlertChanged       = "alert_changed"       // 告警触发或恢复，数据为 alert.Alert
+	EventResync             = "resync"              // 续传时要求的事件已不在缓冲中，客户端应重新拉取完整状态
+)
+
+// DefaultEventBufferSize 默认保留的最近事件数，断线重连时从中续传
+const DefaultEventBufferSize = 1000
+
+// subscriberBuffer 每个订阅者的待发送事件数，写满时断开该订阅者
+const subscriberBuffer = 256
+
+// Event 一条事件
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// CollectionSummary 一轮采集的结果
+type CollectionSummary struct {
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Devices   int           `json:"devices"`
+	Succeeded int           `json:"succeeded"`
+	Error     string        `json:"error,omitempty"` // 列出设备失败时的错误
+}
+
+// EventBus 事件总线：发布的事件保存在固定大小的环形缓冲中，订阅时可以从某个事件 ID 之后续传
+//
+// 事件 ID 从启动时的毫秒时间戳（乘以 1000）开始递增，重启后仍然比之前发出的 ID 大，
+// 客户端带着重启前的 ID 续传时会被识别为缺失事件。
+type EventBus struct {
+	mu     sync.Mutex
+	buffer []Event // 环形缓冲
+	start  int     // 最旧事件在 buffer 中的位置
+	count  int
+	nextID uint64
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription 一个订阅，C 被关闭表示订阅者处理太慢被断开，客户端应带着最后收到的 ID 重新订阅
+type Subscription struct {
+	C   <-chan Event
+	ch  chan Event
+	bus *EventBus
+}
+
+// NewEventBus 创建事件总线，size 为保留的最近事件数
+func NewEventBus(size int) *EventBus {
+	if size <= 0 {
+		size = DefaultEventBufferSize
+	}
+	return &EventBus{
+		buffer: make([]Event, size),
+		nextID: uint64(time.Now().UnixMilli()) * 1000,
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish 发布一条事件，不会阻塞：订阅者的缓冲写满时断开该订阅者
+func (b *EventBus) Publish(eventType string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	ev := Event{ID: b.nextID, Type: eventType, Time: time.Now(), Data: data}
+
+	if b.count < len(b.buffer) {
+		b.buffer[(b.start+b.count)%len(b.buffer)] = ev
+		b.count++
+	} else {
+		b.buffer[b.start] = ev
+		b.start = (b.start + 1) % len(b.buffer)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return ev
+}
+
+// Subscribe 订阅之后发布的事件；lastID 不为 0 时先返回缓冲中 lastID 之后的事件，
+// complete 为 false 表示 lastID 之后有事件已经不在缓冲中（或来自重启之前）
+func (b *EventBus) Subscribe(lastID uint64) (sub *Subscription, backlog []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID != 0 {
+		oldest := b.nextID + 1 // 缓冲为空时下一条事件的 ID
+		if b.count > 0 {
+			oldest = b.buffer[b.start].ID
+		}
+		if lastID+1 < oldest || lastID > b.nextID {
+			complete = false
+		}
+		for i := 0; i < b.count; i++ {
+			ev := b.buffer[(b.start+i)%len(b.buffer)]
+			if ev.ID > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, bus: b}
+	b.subs[sub] = struct{}{}
+	return sub, backlog, complete
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
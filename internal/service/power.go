@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// DevicePower 一个设备最近的电源状态
+type DevicePower struct {
+	Device    smart.Device `json:"device"` // 最近一次读到的设备信息，待机时 smartctl 读不到标识
+	State     string       `json:"state"`  // active/standby
+	Skips     int          `json:"skips"`  // 连续因待机跳过的次数
+	Since     time.Time    `json:"since"`  // 进入当前状态的时间
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// PowerTracker 按设备名记录电源状态和最近的设备信息
+//
+// 待机跳过的采样要记到设备标识下，而待机时读不到标识，只能沿用最近一次读到的。
+// 状态持久化到文件，重启后不必为了识别设备而唤醒硬盘。
+type PowerTracker struct {
+	path string
+
+	mu      sync.Mutex
+	devices map[string]*DevicePower
+}
+
+// NewPowerTracker 创建电源状态记录，path 为状态文件路径（为空则不持久化）
+func NewPowerTracker(path string) (*PowerTracker, error) {
+	t := &PowerTracker{
+		path:    path,
+		devices: make(map[string]*DevicePower),
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Active 记录设备已读取，清零连续跳过次数
+func (t *PowerTracker) Active(device smart.Device, at time.Time) {
+	t.mu.Lock()
+	p := t.device(device.Name)
+	if p.State != smart.PowerStateActive {
+		p.State = smart.PowerStateActive
+		p.Since = at
+	}
+	p.Device = device
+	p.Skips = 0
+	p.UpdatedAt = at
+	err := t.save()
+	t.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save power state: %v", err)
+	}
+}
+
+// Standby 记录设备因待机被跳过，返回更新后的状态
+func (t *PowerTracker) Standby(name string, at time.Time) DevicePower {
+	t.mu.Lock()
+	p := t.device(name)
+	if p.State != smart.PowerStateStandby {
+		p.State = smart.PowerStateStandby
+		p.Since = at
+	}
+	p.Skips++
+	p.UpdatedAt = at
+	result := *p
+	err := t.save()
+	t.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save power state: %v", err)
+	}
+	return result
+}
+
+// Get 返回设备最近的电源状态
+func (t *PowerTracker) Get(name string) (DevicePower, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.devices[name]
+	if !ok {
+		return DevicePower{}, false
+	}
+	return *p, true
+}
+
+// device 返回设备的记录，不存在时创建，调用方持有锁
+func (t *PowerTracker) device(name string) *DevicePower {
+	p, ok := t.devices[name]
+	if !ok {
+		p = &DevicePower{Device: smart.Device{Name: name}}
+		t.devices[name] = p
+	}
+	return p
+}
+
+// load 从状态文件恢复
+func (t *PowerTracker) load() error {
+	if t.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read power state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &t.devices); err != nil {
+		return fmt.Errorf("parse power state: %w", err)
+	}
+	if t.devices == nil {
+		t.devices = make(map[string]*DevicePower)
+	}
+	return nil
+}
+
+// save 写入状态文件（先写临时文件再重命名），调用方持有锁
+func (t *PowerTracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(t.devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode power state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write power state: %w", err)
+	}
+	return os.Rename(tmp, t.path)
+}
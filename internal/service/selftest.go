@@ -0,0 +1,623 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"smart-cat/internal/smart"
+	"smart-cat/pkg/osutils"
+)
+
+// 自检运行状态
+const (
+	SelfTestRunning = "running" // 设备正在执行
+	SelfTestPassed  = "passed"  // 日志中记录为通过
+	SelfTestFailed  = "failed"  // 日志中记录为失败或被中止
+	SelfTestUnknown = "unknown" // 测试已结束但日志中找不到结果，或超过最长运行时间
+	SelfTestError   = "error"   // smartctl -t 启动失败
+)
+
+const (
+	// selfTestMaxRunTime 超过此时间仍未结束的测试不再跟踪（大容量硬盘的长测试可能超过一天）
+	selfTestMaxRunTime = 48 * time.Hour
+	// selfTestLogGrace 启动后设备状态可能还没有更新，这段时间内不认为测试已结束
+	selfTestLogGrace = time.Minute
+	// selfTestRetryDelay 启动失败后重试的间隔
+	selfTestRetryDelay = time.Hour
+	// selfTestHistorySize 每个设备保留的运行记录数
+	selfTestHistorySize = 20
+)
+
+// SelfTestSchedule 自检周期，为 0 表示不执行该类型的测试
+type SelfTestSchedule struct {
+	ShortInterval time.Duration `json:"short_interval"`
+	LongInterval  time.Duration `json:"long_interval"`
+}
+
+// SelfTestConfig 自检调度配置
+type SelfTestConfig struct {
+	Schedule      SelfTestSchedule            // 默认周期
+	Overrides     map[string]SelfTestSchedule // 按序列号覆盖
+	CheckInterval time.Duration               // 检查到期和轮询进度的间隔
+	DeviceTimeout time.Duration               // 单次 smartctl 调用的超时
+}
+
+// SelfTestRun 一次由调度器启动的自检
+type SelfTestRun struct {
+	Type             string               `json:"type"`
+	Device           string               `json:"device"`
+	StartedAt        time.Time            `json:"started_at"`
+	FinishedAt       *time.Time           `json:"finished_at,omitempty"`
+	RemainingPercent int                  `json:"remaining_percent"`
+	Status           string               `json:"status"`
+	Result           string               `json:"result,omitempty"` // 设备日志中的结果描述
+	Error            string               `json:"error,omitempty"`
+	Baseline         *smart.SelfTestEntry `json:"baseline,omitempty"` // 启动时日志中最新的一条，用于识别新结果
+}
+
+// SelfTestDevice 一个设备的自检状态，按设备标识持久化
+type SelfTestDevice struct {
+	ID        string                `json:"id"`
+	Serial    string                `json:"serial"`
+	Device    string                `json:"device"`
+	Enclosure string                `json:"enclosure"`
+	LastShort time.Time             `json:"last_short"` // 最近一次短测试（长测试也计入）
+	LastLong  time.Time             `json:"last_long"`
+	RetryAt   time.Time             `json:"retry_at"` // 启动失败后在此之前不再尝试
+	Running   *SelfTestRun          `json:"running,omitempty"`
+	Runs      []SelfTestRun         `json:"runs"` // 已结束的运行，最新的在前
+	Status    *smart.SelfTestStatus `json:"status,omitempty"`
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+// key 设备标识，旧状态中没有时使用序列号
+func (st *SelfTestDevice) key() string {
+	if st.ID != "" {
+		return st.ID
+	}
+	return st.Serial
+}
+
+// SelfTestInfo API 返回的设备自检信息
+type SelfTestInfo struct {
+	SelfTestDevice
+	Schedule  SelfTestSchedule `json:"schedule"`
+	NextShort *time.Time       `json:"next_short,omitempty"`
+	NextLong  *time.Time       `json:"next_long,omitempty"`
+}
+
+// SelfTestScheduler 自检调度器
+//
+// 按周期对采集器发现的设备启动 smartctl -t short|long，并轮询进度直到设备日志出现结果。
+// 同一硬盘柜（共享 USB 桥接或 SCSI host）内同时只运行一个测试，避免测试互相拖慢和桥接芯片过载。
+// 设备列表和自检日志来自采集器的快照，采集器未启用时不会调度任何测试。
+type SelfTestScheduler struct {
+	detector  *smart.DeviceDetector
+	collector *Collector
+	config    SelfTestConfig
+	path      string
+
+	mu      sync.Mutex
+	devices map[string]*SelfTestDevice
+
+	// runMu 串行化定期检查和手动启动，避免同一硬盘柜同时启动两个测试
+	runMu sync.Mutex
+}
+
+// ErrSelfTestBusy 设备或同一硬盘柜中的其他设备正在自检
+var ErrSelfTestBusy = errors.New("self-test already running")
+
+// NewSelfTestScheduler 创建自检调度器，path 为状态文件路径（为空则不持久化）
+func NewSelfTestScheduler(detector *smart.DeviceDetector, collector *Collector, config SelfTestConfig, path string) (*SelfTestScheduler, error) {
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = 5 * time.Minute
+	}
+	s := &SelfTestScheduler{
+		detector:  detector,
+		collector: collector,
+		config:    config,
+		path:      path,
+		devices:   make(map[string]*SelfTestDevice),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run 定期检查到期的测试和运行中测试的进度，直到 ctx 结束
+func (s *SelfTestScheduler) Run(ctx context.Context) {
+	log.Printf("Starting self-test scheduler (short %v, long %v)", s.config.Schedule.ShortInterval, s.config.Schedule.LongInterval)
+
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Self-test scheduler stopped")
+			return
+		case <-ticker.C:
+			s.check(ctx)
+		}
+	}
+}
+
+// Get 按设备标识或序列号返回设备的自检信息
+func (s *SelfTestScheduler) Get(key string) (SelfTestInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st := s.lookup(key); st != nil {
+		return s.info(st), true
+	}
+	return SelfTestInfo{}, false
+}
+
+// lookup 按设备标识或序列号查找设备，调用方持有锁
+func (s *SelfTestScheduler) lookup(key string) *SelfTestDevice {
+	if st, ok := s.devices[key]; ok {
+		return st
+	}
+	for _, st := range s.devices {
+		if st.Serial == key {
+			return st
+		}
+	}
+	return nil
+}
+
+// Start 手动启动一次测试，设备或同一硬盘柜中有测试在运行时返回 ErrSelfTestBusy
+func (s *SelfTestScheduler) Start(ctx context.Context, key, testType string) (SelfTestInfo, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	// 设备可能是上一次检查之后才出现的
+	s.sync()
+
+	s.mu.Lock()
+	st := s.lookup(key)
+	if st == nil || st.Device == "" {
+		s.mu.Unlock()
+		return SelfTestInfo{}, fmt.Errorf("%s: %w or does not support self-tests", key, smart.ErrDeviceNotFound)
+	}
+	for _, other := range s.devices {
+		if other != st && other.Enclosure != st.Enclosure {
+			continue
+		}
+		if other.Running != nil || (other.Status != nil && other.Status.InProgress) {
+			s.mu.Unlock()
+			return SelfTestInfo{}, fmt.Errorf("%w on %s", ErrSelfTestBusy, other.Device)
+		}
+	}
+	s.mu.Unlock()
+
+	s.start(ctx, st, testType)
+
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save self-test state: %v", err)
+	}
+
+	s.mu.Lock()
+	info := s.info(st)
+	s.mu.Unlock()
+
+	if info.Running == nil && len(info.Runs) > 0 && info.Runs[0].Status == SelfTestError {
+		return info, fmt.Errorf("start %s self-test on %s: %s", testType, info.Runs[0].Device, info.Runs[0].Error)
+	}
+	return info, nil
+}
+
+// List 返回所有设备的自检信息
+func (s *SelfTestScheduler) List() []SelfTestInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]SelfTestInfo, 0, len(s.devices))
+	for _, st := range s.devices {
+		infos = append(infos, s.info(st))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Device < infos[j].Device
+	})
+	return infos
+}
+
+// info 组装 API 信息，调用方持有锁
+func (s *SelfTestScheduler) info(st *SelfTestDevice) SelfTestInfo {
+	info := SelfTestInfo{SelfTestDevice: *st, Schedule: s.schedule(st)}
+	info.Runs = append([]SelfTestRun{}, st.Runs...)
+	if st.Running != nil {
+		run := *st.Running
+		info.Running = &run
+	}
+	if next, ok := nextRun(st.LastShort, info.Schedule.ShortInterval, st.RetryAt); ok {
+		info.NextShort = &next
+	}
+	if next, ok := nextRun(st.LastLong, info.Schedule.LongInterval, st.RetryAt); ok {
+		info.NextLong = &next
+	}
+	return info
+}
+
+// nextRun 计算下一次测试时间，interval 为 0 表示不调度
+func nextRun(last time.Time, interval time.Duration, retryAt time.Time) (time.Time, bool) {
+	if interval <= 0 {
+		return time.Time{}, false
+	}
+	next := last.Add(interval)
+	if last.IsZero() {
+		next = time.Now()
+	}
+	if retryAt.After(next) {
+		next = retryAt
+	}
+	return next, true
+}
+
+// schedule 返回设备生效的周期，单独配置可以按设备标识或序列号指定
+func (s *SelfTestScheduler) schedule(st *SelfTestDevice) SelfTestSchedule {
+	if override, ok := s.config.Overrides[st.ID]; ok && st.ID != "" {
+		return override
+	}
+	if override, ok := s.config.Overrides[st.Serial]; ok {
+		return override
+	}
+	return s.config.Schedule
+}
+
+// check 执行一轮检查：同步设备列表、轮询运行中的测试、启动到期的测试
+func (s *SelfTestScheduler) check(ctx context.Context) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	s.sync()
+	s.poll(ctx)
+	s.startDue(ctx)
+
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save self-test state: %v", err)
+	}
+}
+
+// sync 根据采集器快照更新设备名、硬盘柜和设备自检日志
+func (s *SelfTestScheduler) sync() {
+	snapshots := s.collector.Snapshots()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, data := range snapshots {
+		key := data.Device.Key()
+		if key == "" || key == "unknown" || data.SelfTest == nil {
+			continue
+		}
+
+		st, ok := s.devices[key]
+		if !ok && key != data.Device.Serial {
+			// 沿用以序列号保存的旧状态
+			if st, ok = s.devices[data.Device.Serial]; ok {
+				delete(s.devices, data.Device.Serial)
+				s.devices[key] = st
+			}
+		}
+		if !ok {
+			st = &SelfTestDevice{}
+			s.devices[key] = st
+			inferLastRuns(st, data)
+		}
+		st.ID = data.Device.ID
+		st.Serial = data.Device.Serial
+		if st.Device != data.Device.Name || st.Enclosure == "" {
+			st.Device = data.Device.Name
+			st.Enclosure = osutils.EnclosureID(data.Device.Name)
+		}
+		if data.Timestamp.After(st.UpdatedAt) {
+			st.Status = data.SelfTest
+			st.UpdatedAt = data.Timestamp
+		}
+	}
+}
+
+// inferLastRuns 首次见到设备时根据设备日志推算上次测试的时间，避免重复测试刚测过的硬盘
+//
+// 日志只记录通电小时数，按当前通电小时数倒推；关机的时间不计入，推算结果偏近。
+func inferLastRuns(st *SelfTestDevice, data *smart.SMARTData) {
+	for _, entry := range data.SelfTest.Log {
+		if entry.LifetimeHours > data.PowerOnHours {
+			continue // ATA 日志的小时数是 16 位，会回绕
+		}
+		at := data.Timestamp.Add(-time.Duration(data.PowerOnHours-entry.LifetimeHours) * time.Hour)
+		switch entry.Type {
+		case smart.SelfTestLong:
+			if at.After(st.LastLong) {
+				st.LastLong = at
+			}
+			if at.After(st.LastShort) {
+				st.LastShort = at
+			}
+		case smart.SelfTestShort:
+			if at.After(st.LastShort) {
+				st.LastShort = at
+			}
+		}
+	}
+}
+
+// poll 读取运行中测试的进度，结束后从设备日志取结果
+func (s *SelfTestScheduler) poll(ctx context.Context) {
+	s.mu.Lock()
+	var running []*SelfTestDevice
+	for _, st := range s.devices {
+		if st.Running != nil {
+			running = append(running, st)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, st := range running {
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		device := st.Device
+		s.mu.Unlock()
+
+		data, err := s.readDevice(ctx, device)
+		now := time.Now()
+
+		s.mu.Lock()
+		var status *smart.SelfTestStatus
+		switch {
+		case err == nil && data.SelfTest != nil && data.Device.Key() == st.key():
+			status = data.SelfTest
+			st.Status = status
+			st.UpdatedAt = now
+		case errors.Is(err, smart.ErrStandby):
+			// 测试结束后硬盘进入了待机，不为读取结果唤醒它；采集器之后读到的快照（sync 中更新）同样带有结果
+			err = nil
+			if st.Status != nil && st.UpdatedAt.After(st.Running.StartedAt) {
+				status = st.Status
+			}
+		}
+		s.updateRun(st, status, err, now)
+		s.mu.Unlock()
+	}
+}
+
+// readDevice 在单设备超时内读取 SMART 数据，硬盘待机时不唤醒，返回 smart.ErrStandby
+func (s *SelfTestScheduler) readDevice(ctx context.Context, device string) (*smart.SMARTData, error) {
+	if s.config.DeviceTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.DeviceTimeout)
+		defer cancel()
+	}
+	return s.detector.GetSMARTDataIfActive(ctx, device)
+}
+
+// updateRun 根据设备的自检状态更新运行中的测试，status 为 nil 表示没有读到新状态，调用方持有锁
+func (s *SelfTestScheduler) updateRun(st *SelfTestDevice, status *smart.SelfTestStatus, readErr error, now time.Time) {
+	run := st.Running
+	if status != nil {
+		if status.InProgress {
+			run.RemainingPercent = status.RemainingPercent
+			run.Error = ""
+		} else if len(status.Log) > 0 && (run.Baseline == nil || status.Log[0] != *run.Baseline) {
+			entry := status.Log[0]
+			run.Result = entry.Status
+			run.Status = SelfTestFailed
+			if entry.Passed {
+				run.Status = SelfTestPassed
+			}
+			s.finishRun(st, now)
+			return
+		} else if now.Sub(run.StartedAt) > selfTestLogGrace {
+			run.Status = SelfTestUnknown
+			run.Error = "test is no longer running but no new log entry was found"
+			s.finishRun(st, now)
+			return
+		}
+	} else if readErr != nil {
+		run.Error = readErr.Error()
+	}
+
+	if now.Sub(run.StartedAt) > selfTestMaxRunTime {
+		run.Status = SelfTestUnknown
+		run.Error = fmt.Sprintf("no result after %v", selfTestMaxRunTime)
+		s.finishRun(st, now)
+	}
+}
+
+// finishRun 把运行中的测试移入历史，调用方持有锁
+func (s *SelfTestScheduler) finishRun(st *SelfTestDevice, now time.Time) {
+	run := *st.Running
+	run.FinishedAt = &now
+	run.RemainingPercent = 0
+	st.Running = nil
+	st.Runs = append([]SelfTestRun{run}, st.Runs...)
+	if len(st.Runs) > selfTestHistorySize {
+		st.Runs = st.Runs[:selfTestHistorySize]
+	}
+	log.Printf("%s self-test on %s (S/N: %s) finished: %s %s", run.Type, run.Device, st.Serial, run.Status, run.Result)
+}
+
+// selfTestCandidate 一个到期的测试
+type selfTestCandidate struct {
+	st       *SelfTestDevice
+	testType string
+	overdue  time.Duration
+}
+
+// startDue 启动到期的测试，每个硬盘柜同时最多一个
+func (s *SelfTestScheduler) startDue(ctx context.Context) {
+	now := time.Now()
+
+	s.mu.Lock()
+	busy := make(map[string]bool)
+	for _, st := range s.devices {
+		// 手动启动或其他工具启动的测试同样占用硬盘柜
+		if st.Running != nil || (st.Status != nil && st.Status.InProgress) {
+			busy[st.Enclosure] = true
+		}
+	}
+
+	var due []selfTestCandidate
+	for _, st := range s.devices {
+		if busy[st.Enclosure] || st.Device == "" || now.Before(st.RetryAt) {
+			continue
+		}
+		sched := s.schedule(st)
+		// 长测试覆盖短测试，两者都到期时只做长测试
+		if sched.LongInterval > 0 && now.Sub(st.LastLong) >= sched.LongInterval {
+			due = append(due, selfTestCandidate{st, smart.SelfTestLong, now.Sub(st.LastLong) - sched.LongInterval})
+		} else if sched.ShortInterval > 0 && now.Sub(st.LastShort) >= sched.ShortInterval {
+			due = append(due, selfTestCandidate{st, smart.SelfTestShort, now.Sub(st.LastShort) - sched.ShortInterval})
+		}
+	}
+	s.mu.Unlock()
+
+	// 短测试优先，其次是逾期最久的
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].testType != due[j].testType {
+			return due[i].testType == smart.SelfTestShort
+		}
+		return due[i].overdue > due[j].overdue
+	})
+
+	for _, c := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if busy[c.st.Enclosure] {
+			continue
+		}
+		if !s.awake(ctx, c.st) {
+			continue
+		}
+		busy[c.st.Enclosure] = true
+		s.start(ctx, c.st, c.testType)
+	}
+}
+
+// awake 判断硬盘是否处于活动状态，待机的硬盘不为定期自检唤醒，等下一次检查再试；
+// 读到的自检日志同时作为这次测试的基准
+func (s *SelfTestScheduler) awake(ctx context.Context, st *SelfTestDevice) bool {
+	s.mu.Lock()
+	device := st.Device
+	s.mu.Unlock()
+
+	data, err := s.readDevice(ctx, device)
+	if errors.Is(err, smart.ErrStandby) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil && data.SelfTest != nil && data.Device.Key() == st.key() {
+		st.Status = data.SelfTest
+		st.UpdatedAt = time.Now()
+	}
+	return true
+}
+
+// start 启动一次测试
+func (s *SelfTestScheduler) start(ctx context.Context, st *SelfTestDevice, testType string) {
+	s.mu.Lock()
+	device := st.Device
+	run := &SelfTestRun{
+		Type:             testType,
+		Device:           device,
+		StartedAt:        time.Now(),
+		RemainingPercent: 100,
+		Status:           SelfTestRunning,
+	}
+	if st.Status != nil && len(st.Status.Log) > 0 {
+		baseline := st.Status.Log[0]
+		run.Baseline = &baseline
+	}
+	s.mu.Unlock()
+
+	startCtx := ctx
+	if s.config.DeviceTimeout > 0 {
+		var cancel context.CancelFunc
+		startCtx, cancel = context.WithTimeout(ctx, s.config.DeviceTimeout)
+		defer cancel()
+	}
+	err := s.detector.StartSelfTest(startCtx, device, testType)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to start %s self-test on %s (S/N: %s): %v", testType, device, st.Serial, err)
+		st.RetryAt = run.StartedAt.Add(selfTestRetryDelay)
+		run.Status = SelfTestError
+		run.Error = err.Error()
+		st.Running = run
+		s.finishRun(st, time.Now())
+		return
+	}
+
+	log.Printf("Started %s self-test on %s (S/N: %s)", testType, device, st.Serial)
+	st.Running = run
+	st.LastShort = run.StartedAt
+	if testType == smart.SelfTestLong {
+		st.LastLong = run.StartedAt
+	}
+}
+
+// load 从状态文件恢复
+func (s *SelfTestScheduler) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read self-test state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.devices); err != nil {
+		return fmt.Errorf("parse self-test state: %w", err)
+	}
+	if s.devices == nil {
+		s.devices = make(map[string]*SelfTestDevice)
+	}
+	return nil
+}
+
+// save 写入状态文件（先写临时文件再重命名）
+func (s *SelfTestScheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.devices, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode self-test state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write self-test state: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// 温度点的来源
+const (
+	TemperatureSourceSCT    = "sct"    // 硬盘自己记录的 SCT 温度历史
+	TemperatureSourceSample = "sample" // 采集器保存的采样
+)
+
+// TemperaturePoint 温度曲线上的一个点
+type TemperaturePoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Temperature int       `json:"temperature"`
+	Source      string    `json:"source"`          // sct/sample
+	State       string    `json:"state,omitempty"` // ok/warm/critical
+}
+
+// TemperatureHistory 设备的温度曲线和温度详情
+type TemperatureHistory struct {
+	Device  smart.Device       `json:"device"`
+	Current int                `json:"current"`           // 最近一次读到的温度
+	Thermal *smart.ThermalInfo `json:"thermal,omitempty"` // 最近一次读到的温度详情，不含 SCT 温度历史（已合并到 Points）
+	Points  []TemperaturePoint `json:"points"`            // 按时间排序，State 按 Thermal.Limits 判定
+}
+
+// GetTemperatureHistory 合并设备最近一次读到的 SCT 温度历史和保存的采样，得到时间范围内的温度曲线
+//
+// SCT 温度历史只覆盖硬盘自己的记录窗口（通常几小时，间隔几分钟），在这个窗口内使用 SCT 的点，
+// 窗口之外使用采集器的采样（原始采样每个采集间隔一个，更早的为小时/天汇总的平均值）。
+// 不实时读取设备，本机设备的 SCT 温度历史来自快照缓存，其他主机来自 agent 最近一次推送。
+func (s *DeviceService) GetTemperatureHistory(host, key string, from, to time.Time) (*TemperatureHistory, error) {
+	records, err := s.GetHostHistory(host, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-s.historyWindow)
+	}
+
+	result := &TemperatureHistory{Device: smart.Device{ID: key}}
+	var sct []smart.TemperatureSample
+	var limits *smart.ThermalLimits
+	if data := s.latestSnapshot(host, key); data != nil {
+		result.Device = data.Device
+		result.Current = data.Temperature
+		if data.Thermal != nil {
+			thermal := *data.Thermal
+			sct = thermal.History.Samples(data.Timestamp)
+			thermal.History = nil
+			result.Thermal = &thermal
+			limits = thermal.Limits
+		}
+	}
+
+	if result.Device.Name == "" && len(records) == 0 {
+		return nil, fmt.Errorf("%s: %w", key, smart.ErrDeviceNotFound)
+	}
+
+	// SCT 窗口内只保留 SCT 的点
+	var windowStart time.Time
+	if len(sct) > 0 {
+		windowStart = sct[0].Timestamp
+	}
+	for _, p := range sct {
+		if p.Timestamp.Before(from) || (!to.IsZero() && p.Timestamp.After(to)) {
+			continue
+		}
+		result.Points = append(result.Points, TemperaturePoint{
+			Timestamp:   p.Timestamp,
+			Temperature: p.Temperature,
+			Source:      TemperatureSourceSCT,
+		})
+	}
+	for _, rec := range records {
+		if rec.Temperature == 0 || (!windowStart.IsZero() && !rec.Timestamp.Before(windowStart)) {
+			continue
+		}
+		result.Points = append(result.Points, TemperaturePoint{
+			Timestamp:   rec.Timestamp,
+			Temperature: rec.Temperature,
+			Source:      TemperatureSourceSample,
+		})
+	}
+	sort.Slice(result.Points, func(i, j int) bool {
+		return result.Points[i].Timestamp.Before(result.Points[j].Timestamp)
+	})
+
+	if limits != nil {
+		for i := range result.Points {
+			result.Points[i].State = limits.Classify(result.Points[i].Temperature)
+		}
+	}
+	if result.Points == nil {
+		result.Points = []TemperaturePoint{}
+	}
+	return result, nil
+}
+
+// latestSnapshot 返回设备最近一次读到的数据，不实时读取
+func (s *DeviceService) latestSnapshot(host, key string) *smart.SMARTData {
+	if !s.isLocal(host) {
+		data, _ := s.aggregator.Snapshot(host, key)
+		return data
+	}
+	e, ok := s.cache.Get(s.DevicePath(key))
+	if !ok {
+		e, ok = s.cache.Get(key)
+	}
+	if !ok {
+		return nil
+	}
+	return e.Data
+}
@@ -0,0 +1,170 @@
+package smart
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BridgeAuto 不带 -d 参数，由 smartctl 自动识别设备类型
+const BridgeAuto = "auto"
+
+// USBBridgeTypes 依次尝试的 USB 桥接类型，"" 表示自动识别
+//
+// snt* 为 USB 转 NVMe 的桥接芯片，排在最后，只有前面的类型都失败时才会尝试。
+var USBBridgeTypes = []string{"", "sat", "usbsunplus", "usbjmicron", "usbcypress", "sntasmedia", "sntjmicron", "sntrealtek"}
+
+// BridgeMemory 记住每个设备可用的 USB 桥接类型，重启后仍然有效
+//
+// 读取 SMART 数据之前只知道设备路径，LookupBridge 据此找到设备标识和上次可用的类型；
+// 读取成功后以设备标识记住这次可用的类型。
+type BridgeMemory interface {
+	LookupBridge(devicePath string) (id, bridgeType string, ok bool)
+	RememberBridge(id, bridgeType string)
+}
+
+// SetBridgeMemory 设置桥接类型记忆，读取设备时先尝试上次可用的类型，失败后再依次尝试其他类型
+func (d *DeviceDetector) SetBridgeMemory(memory BridgeMemory) {
+	d.memory = memory
+}
+
+// SetBridgePins 设置固定的桥接类型，键为设备标识或设备路径的 glob（匹配完整路径或设备名），
+// 值为 -d 类型（如 sntjmicron、sat,12，auto 表示不带 -d）；固定的设备只尝试这一种类型
+//
+// 多个 glob 匹配同一设备时取最具体的一个：不含通配符的优先，其次是字面字符多的。
+func (d *DeviceDetector) SetBridgePins(pins map[string]string) {
+	d.pins = pins
+	d.pinGlobs = sortGlobs(pins)
+}
+
+// sortGlobs 返回按 pinOrder 从最具体到最宽泛排好序的 glob
+func sortGlobs(patterns map[string]string) []string {
+	globs := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		globs = append(globs, pattern)
+	}
+	sort.Slice(globs, func(i, j int) bool {
+		return pinOrder(globs[i], globs[j])
+	})
+	return globs
+}
+
+// bridgeOrder 返回读取设备时依次尝试的 -d 类型：固定的类型只有一种，记住的类型排在最前面
+func (d *DeviceDetector) bridgeOrder(devicePath string) (types []string, pinned bool) {
+	var id, remembered string
+	var known bool
+	if d.memory != nil {
+		id, remembered, known = d.memory.LookupBridge(devicePath)
+	}
+
+	if pin, ok := d.pin(id, devicePath); ok {
+		return []string{bridgeArg(pin)}, true
+	}
+	if !known {
+		return d.bridgeTypes, false
+	}
+
+	first := bridgeArg(remembered)
+	types = append(types, first)
+	for _, t := range d.bridgeTypes {
+		if t != first {
+			types = append(types, t)
+		}
+	}
+	return types, false
+}
+
+// pin 查找设备固定的桥接类型，设备标识优先于路径
+//
+// 设备标识与 /dev/disk/by-id 的链接名一致，也按设备路径的 by-id 链接名查找：桥接类型记忆
+// 还不认识这个路径时（第一次读取）固定的类型同样生效。
+func (d *DeviceDetector) pin(id, devicePath string) (string, bool) {
+	if len(d.pins) == 0 {
+		return "", false
+	}
+	if id != "" {
+		if pin, ok := d.pins[id]; ok {
+			return pin, true
+		}
+	}
+	if d.byID != nil {
+		for _, link := range d.byID(devicePath) {
+			if pin, ok := d.pins[link]; ok {
+				return pin, true
+			}
+		}
+	}
+	for _, pattern := range d.pinGlobs {
+		if ok, _ := filepath.Match(pattern, devicePath); ok {
+			return d.pins[pattern], true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(devicePath)); ok {
+			return d.pins[pattern], true
+		}
+	}
+	return "", false
+}
+
+// pinOrder 判断 glob a 是否比 b 更具体：不含通配符的在前，其次字面字符多的在前，
+// 再次 * 少的在前（? 和 [...] 只匹配一个字符），最后按字典序
+func pinOrder(a, b string) bool {
+	wa, la, sa := globLiterals(a)
+	wb, lb, sb := globLiterals(b)
+	if wa != wb {
+		return !wa
+	}
+	if la != lb {
+		return la > lb
+	}
+	if sa != sb {
+		return sa < sb
+	}
+	return a < b
+}
+
+// globLiterals 返回 glob 是否含通配符、字面字符的个数（* ? 和 [...] 不计入）和 * 的个数
+func globLiterals(pattern string) (wildcard bool, literals, stars int) {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			wildcard = true
+			stars++
+		case '?':
+			wildcard = true
+		case '[':
+			wildcard = true
+			if end := strings.IndexByte(pattern[i+1:], ']'); end >= 0 {
+				i += end + 1
+			}
+		case '\\':
+			i++
+			literals++
+		default:
+			literals++
+		}
+	}
+	return wildcard, literals, stars
+}
+
+// remember 读取成功后记住设备可用的桥接类型
+func (d *DeviceDetector) remember(device Device) {
+	if d.memory != nil && device.ID != "" {
+		d.memory.RememberBridge(device.ID, device.BridgeType)
+	}
+}
+
+// bridgeArg 把桥接类型转换为 -d 参数，auto 转换为空（不带 -d）
+func bridgeArg(bridgeType string) string {
+	if bridgeType == BridgeAuto {
+		return ""
+	}
+	return strings.TrimSpace(bridgeType)
+}
+
+// bridgeName 把 -d 参数转换为显示和记住的桥接类型，空转换为 auto
+func bridgeName(arg string) string {
+	if arg == "" {
+		return BridgeAuto
+	}
+	return arg
+}
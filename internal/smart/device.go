@@ -1,30 +1,129 @@
 package smart
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"smart-cat/pkg/osutils"
 )
 
 // DeviceDetector 设备检测器
-type DeviceDetector struct{}
+type DeviceDetector struct {
+	runner      Runner
+	bridgeTypes []string          // 依次尝试的 -d 类型
+	pins        map[string]string // 固定的 -d 类型，见 SetBridgePins
+	memory      BridgeMemory      // 为 nil 时每次都从头尝试
+	thermal     *ThermalPolicy    // 为 nil 时不判定温度状态
+	health      HealthModel       // 为 nil 时使用 legacy
+	include     []string          // 设备过滤 glob，为空表示全部
+	exclude     []string
+	resolver    IdentityResolver // 为 nil 时 Device.ID 为空
 
-// NewDeviceDetector 创建设备检测器
+	pinGlobs []string                         // pins 的键，按 pinOrder 排序
+	byID     func(devicePath string) []string // 设备路径的 /dev/disk/by-id 链接名，按设备标识固定类型时使用
+
+	probeTimeout     time.Duration // 发现设备时单次 smartctl 调用的超时
+	discoveryTimeout time.Duration // 一次 ListDevices 的总超时
+}
+
+// 发现设备的默认超时，卡住的 USB 桥接芯片不应拖住整个采集周期
+const (
+	DefaultProbeTimeout     = 30 * time.Second
+	DefaultDiscoveryTimeout = 2 * time.Minute
+)
+
+// NewDeviceDetector 创建设备检测器（直接调用本机 smartctl）
 func NewDeviceDetector() *DeviceDetector {
-	return &DeviceDetector{}
+	return NewDeviceDetectorWithRunner(NewExecRunner())
+}
+
+// NewDeviceDetectorWithRunner 使用指定的 smartctl 执行器创建设备检测器
+func NewDeviceDetectorWithRunner(runner Runner) *DeviceDetector {
+	return &DeviceDetector{
+		runner:           runner,
+		bridgeTypes:      USBBridgeTypes,
+		byID:             osutils.DiskByID,
+		probeTimeout:     DefaultProbeTimeout,
+		discoveryTimeout: DefaultDiscoveryTimeout,
+	}
+}
+
+// SetDiscoveryTimeout 设置发现设备时单次探测和整次发现的超时，非正值保留默认值
+func (d *DeviceDetector) SetDiscoveryTimeout(probe, total time.Duration) {
+	if probe > 0 {
+		d.probeTimeout = probe
+	}
+	if total > 0 {
+		d.discoveryTimeout = total
+	}
+}
+
+// probe 在单次探测超时内运行 smartctl
+func (d *DeviceDetector) probe(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.probeTimeout)
+	defer cancel()
+	return d.runner.Run(ctx, args...)
+}
+
+// SetBridgeTypes 设置依次尝试的 USB 桥接类型（"" 或 auto 表示自动检测）
+func (d *DeviceDetector) SetBridgeTypes(types []string) {
+	d.bridgeTypes = make([]string, 0, len(types))
+	for _, t := range types {
+		d.bridgeTypes = append(d.bridgeTypes, bridgeArg(t))
+	}
+}
+
+// SetIdentityResolver 设置设备标识解析器，每次读取 SMART 数据后填充 Device.ID
+func (d *DeviceDetector) SetIdentityResolver(resolver IdentityResolver) {
+	d.resolver = resolver
+}
+
+// SetDeviceFilter 设置设备包含/排除规则（glob，匹配完整路径或设备名）
+func (d *DeviceDetector) SetDeviceFilter(include, exclude []string) {
+	d.include = include
+	d.exclude = exclude
+}
+
+// allowed 判断设备是否通过包含/排除规则
+func (d *DeviceDetector) allowed(devicePath string) bool {
+	match := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, devicePath); ok {
+				return true
+			}
+			if ok, _ := filepath.Match(pattern, filepath.Base(devicePath)); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(d.include) > 0 && !match(d.include) {
+		return false
+	}
+	return !match(d.exclude)
 }
 
 // ListDevices 列出所有支持 SMART 的设备
-func (d *DeviceDetector) ListDevices() ([]Device, error) {
+//
+// 整次发现受 discoveryTimeout 限制，超时后返回已经发现的设备；ctx 本身被取消时返回错误。
+func (d *DeviceDetector) ListDevices(ctx context.Context) ([]Device, error) {
 	devices := make(map[string]Device)
 
+	discoverCtx, cancel := context.WithTimeout(ctx, d.discoveryTimeout)
+	defer cancel()
+
 	// 首先用 smartctl 扫描
-	out, err := exec.Command("smartctl", "--scan-open", "-j").Output()
+	out, err := d.probe(discoverCtx, "--scan-open", "-j")
 	if err == nil {
 		var result struct {
 			Devices []struct {
@@ -55,25 +154,69 @@ func (d *DeviceDetector) ListDevices() ([]Device, error) {
 
 	// Linux: 扫描所有 /dev/sd* 块设备（包括 USB 硬盘）
 	if runtime.GOOS == "linux" {
-		d.scanLinuxBlockDevices(devices)
+		d.scanLinuxBlockDevices(discoverCtx, devices)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if discoverCtx.Err() != nil {
+		log.Printf("Device discovery timed out after %v, using %d devices found so far", d.discoveryTimeout, len(devices))
 	}
 
 	// 转换为列表
 	deviceList := make([]Device, 0, len(devices))
 	for _, device := range devices {
+		if !d.allowed(device.Name) {
+			continue
+		}
 		deviceList = append(deviceList, device)
 	}
 
 	return deviceList, nil
 }
 
-// GetSMARTData 获取指定设备的 SMART 数据
-func (d *DeviceDetector) GetSMARTData(deviceName string) (*SMARTData, error) {
+// ErrStandby 设备处于待机（STANDBY/SLEEP）状态，为避免唤醒没有读取
+var ErrStandby = errors.New("device is in standby")
+
+// ErrDeviceNotFound 设备不存在（smartctl 无法打开设备文件）
+var ErrDeviceNotFound = errors.New("device not found")
+
+// ErrDeviceBusy 设备被其他进程占用
+var ErrDeviceBusy = errors.New("device busy")
+
+// ErrSmartctlNotFound 找不到 smartctl 可执行文件
+var ErrSmartctlNotFound = errors.New("smartctl not found")
+
+// GetSMARTData 获取指定设备的 SMART 数据（会唤醒待机的硬盘）
+func (d *DeviceDetector) GetSMARTData(ctx context.Context, deviceName string) (*SMARTData, error) {
+	return d.getSMARTData(ctx, deviceName, false)
+}
+
+// GetSMARTDataIfActive 获取指定设备的 SMART 数据，设备处于待机时不唤醒，返回 ErrStandby
+//
+// 使用 smartctl -n standby，只对 ATA 设备有效，NVMe 和 SCSI 设备总是读取。
+func (d *DeviceDetector) GetSMARTDataIfActive(ctx context.Context, deviceName string) (*SMARTData, error) {
+	return d.getSMARTData(ctx, deviceName, true)
+}
+
+// getSMARTData 依次尝试各个 USB 桥接类型读取 SMART 数据，成功后记住可用的类型
+func (d *DeviceDetector) getSMARTData(ctx context.Context, deviceName string, noWake bool) (*SMARTData, error) {
 	// 尝试不同的 USB 桥接类型
+	types, pinned := d.bridgeOrder(deviceName)
 	var lastErr error
-	for _, usbType := range USBBridgeTypes {
-		data, err := parseSMARTData(deviceName, usbType)
+	for _, usbType := range types {
+		data, err := d.readSMARTData(ctx, deviceName, usbType, noWake)
 		if err != nil {
+			// 超时或取消后不再尝试其他桥接类型
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("smartctl %s: %w", deviceName, ctxErr)
+			}
+			// 能查询到电源状态说明桥接类型可用，无需再试；设备不存在、被占用或没有 smartctl 时换桥接类型也没用
+			if errors.Is(err, ErrStandby) || errors.Is(err, ErrDeviceNotFound) ||
+				errors.Is(err, ErrDeviceBusy) || errors.Is(err, ErrSmartctlNotFound) {
+				return nil, err
+			}
 			lastErr = err
 			continue
 		}
@@ -83,7 +226,17 @@ func (d *DeviceDetector) GetSMARTData(deviceName string) (*SMARTData, error) {
 		isExternal := osutils.IsExternalEnclosure(deviceName)
 		data.Device.CapacityGB = capacity
 		data.Device.IsExternal = isExternal
-		data.Timestamp = data.Timestamp // 这里应该设置实际时间
+		data.Device.BridgeType = bridgeName(usbType)
+		if d.resolver != nil {
+			d.resolver.Resolve(&data.Device)
+		}
+		if !pinned {
+			d.remember(data.Device)
+		}
+		if d.thermal != nil {
+			d.thermal.Apply(data)
+		}
+		ApplyHealth(d.health, data)
 
 		return data, nil
 	}
@@ -95,16 +248,21 @@ func (d *DeviceDetector) GetSMARTData(deviceName string) (*SMARTData, error) {
 }
 
 // CanReadSMART 测试能否读取 SMART 数据
-func (d *DeviceDetector) CanReadSMART(devicePath string) bool {
-	for _, usbType := range USBBridgeTypes {
-		args := []string{"--all", "-j"}
+func (d *DeviceDetector) CanReadSMART(ctx context.Context, devicePath string) bool {
+	types, _ := d.bridgeOrder(devicePath)
+	for _, usbType := range types {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		// 待机的设备同样说明桥接类型可用，不必唤醒
+		args := []string{"--all", "-j", "-n", "standby"}
 		if usbType != "" {
 			args = append(args, "-d", usbType)
 		}
 		args = append(args, devicePath)
 
-		cmd := exec.Command("smartctl", args...)
-		out, _ := cmd.CombinedOutput()
+		out, _ := d.probe(ctx, args...)
 
 		var result struct {
 			SmartStatus struct {
@@ -136,6 +294,11 @@ func (d *DeviceDetector) CanReadSMART(devicePath string) bool {
 
 // CheckSmartctlInstalled 检查 smartctl 是否安装
 func (d *DeviceDetector) CheckSmartctlInstalled() error {
+	// 回放模式不需要真实的 smartctl
+	if _, ok := d.runner.(*ReplayRunner); ok {
+		return nil
+	}
+
 	_, err := exec.LookPath("smartctl")
 	if err != nil {
 		msg := "smartctl not found. Please install smartmontools:\n"
@@ -154,13 +317,18 @@ func (d *DeviceDetector) CheckSmartctlInstalled() error {
 }
 
 // scanLinuxBlockDevices 扫描 Linux 块设备
-func (d *DeviceDetector) scanLinuxBlockDevices(devices map[string]Device) {
+func (d *DeviceDetector) scanLinuxBlockDevices(ctx context.Context, devices map[string]Device) {
 	entries, err := os.ReadDir("/sys/block")
 	if err != nil {
 		return
 	}
 
 	for _, entry := range entries {
+		// 发现超时后不再探测剩下的设备
+		if ctx.Err() != nil {
+			return
+		}
+
 		name := entry.Name()
 		// 只处理 sd* 设备（SATA/USB 硬盘）
 		if !strings.HasPrefix(name, "sd") {
@@ -172,13 +340,13 @@ func (d *DeviceDetector) scanLinuxBlockDevices(devices map[string]Device) {
 			continue // 已经被 smartctl --scan 检测到
 		}
 
-		// 检查是否为分区
-		if isPartition(name) {
+		// 检查是否为分区或被过滤
+		if isPartition(name) || !d.allowed(devicePath) {
 			continue
 		}
 
 		// 尝试读取这个设备
-		if d.CanReadSMART(devicePath) {
+		if d.CanReadSMART(ctx, devicePath) {
 			capacity := osutils.GetDiskCapacity(devicePath)
 			isExternal := osutils.IsExternalEnclosure(devicePath)
 			devices[devicePath] = Device{
@@ -199,4 +367,4 @@ func isPartition(name string) bool {
 	// sda1, sdb2 等是分区，sda, sdb 是设备
 	lastChar := name[len(name)-1]
 	return lastChar >= '0' && lastChar <= '9'
-}
\ No newline at end of file
+}
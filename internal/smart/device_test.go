@@ -0,0 +1,34 @@
+package smart
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// hangingRunner 模拟卡住的 smartctl，直到 ctx 结束才返回
+type hangingRunner struct{}
+
+func (hangingRunner) Run(ctx context.Context, args ...string) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestListDevicesDeadline(t *testing.T) {
+	detector := NewDeviceDetectorWithRunner(hangingRunner{})
+	detector.SetDiscoveryTimeout(20*time.Millisecond, 100*time.Millisecond)
+
+	start := time.Now()
+	if _, err := detector.ListDevices(context.Background()); err != nil {
+		t.Fatalf("ListDevices: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ListDevices took %v, want it bounded by the discovery timeout", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := detector.ListDevices(ctx); err == nil {
+		t.Error("canceled context: expected an error")
+	}
+}
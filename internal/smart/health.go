@@ -0,0 +1,441 @@
+package smart
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 健康度等级
+const (
+	HealthOK       = "ok"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+)
+
+// 内置的健康度模型
+const (
+	HealthModelLegacy       = "legacy"        // 按计数线性扣分，与旧版本相同
+	HealthModelBackblaze    = "backblaze"     // 按 Backblaze 统计中与故障相关的 5/187/188/197/198 属性评估风险
+	HealthModelSSDEndurance = "ssd_endurance" // 按 SSD 剩余写入寿命评分
+	HealthModelNVMe         = "nvme"          // 按 NVMe 关键警告位、寿命已用和备用空间评分
+	HealthModelAuto         = "auto"          // 按设备类型选择：NVMe 用 nvme，SSD 用 ssd_endurance，其他用 backblaze
+)
+
+// HealthModels 全部内置模型的名称
+var HealthModels = []string{HealthModelLegacy, HealthModelBackblaze, HealthModelSSDEndurance, HealthModelNVMe, HealthModelAuto}
+
+// HealthScore 健康度评分和评分依据
+type HealthScore struct {
+	Model    string         `json:"model"`    // 实际使用的模型，模型不适用于设备时为 legacy
+	Score    int            `json:"score"`    // 0-100，同 SMARTData.HealthPercent
+	Severity string         `json:"severity"` // ok/warning/critical
+	Factors  []HealthFactor `json:"factors"`  // 影响评分的因素，没有扣分时为空
+}
+
+// HealthFactor 影响评分的一个因素
+type HealthFactor struct {
+	Name        string `json:"name"`                  // 如 reallocated_sectors、attribute_197、nvme_critical_warning
+	Value       int64  `json:"value"`                 // 读到的值
+	Impact      int    `json:"impact"`                // 扣除的分数
+	Severity    string `json:"severity"`              // ok/warning/critical，ok 表示扣分但不单独构成风险
+	Description string `json:"description,omitempty"` // 可读的说明
+}
+
+// HealthModel 健康度模型
+//
+// Score 返回 false 表示模型不适用于该设备（比如 nvme 模型遇到 SATA 硬盘），此时退回 legacy 模型。
+type HealthModel interface {
+	Name() string
+	Score(data *SMARTData) (HealthScore, bool)
+}
+
+// NewHealthModel 按名称创建内置模型，空名称为 legacy
+func NewHealthModel(name string) (HealthModel, error) {
+	switch name {
+	case "", HealthModelLegacy:
+		return legacyModel{}, nil
+	case HealthModelBackblaze:
+		return backblazeModel{}, nil
+	case HealthModelSSDEndurance:
+		return ssdEnduranceModel{}, nil
+	case HealthModelNVMe:
+		return nvmeModel{}, nil
+	case HealthModelAuto:
+		return autoModel{}, nil
+	default:
+		return nil, fmt.Errorf("unknown health model %q (available: %s)", name, strings.Join(HealthModels, ", "))
+	}
+}
+
+// SetHealthModel 设置健康度模型，为 nil 时使用 legacy
+func (d *DeviceDetector) SetHealthModel(model HealthModel) {
+	d.health = model
+}
+
+// ApplyHealth 按模型计算健康度，写入 data.Health 和 data.HealthPercent
+func ApplyHealth(model HealthModel, data *SMARTData) {
+	if model == nil {
+		model = legacyModel{}
+	}
+	score, ok := model.Score(data)
+	if !ok {
+		score, _ = legacyModel{}.Score(data)
+	}
+	if score.Factors == nil {
+		score.Factors = []HealthFactor{}
+	}
+	data.Health = &score
+	data.HealthPercent = score.Score
+}
+
+// scorer 累计扣分和因素
+type scorer struct {
+	model    string
+	score    int
+	severity string
+	factors  []HealthFactor
+}
+
+func newScorer(model string, base int) *scorer {
+	return &scorer{model: model, score: clamp(base), severity: HealthOK}
+}
+
+// deduct 扣分并记录因素，impact 为 0 时只记录
+func (s *scorer) deduct(name string, value int64, impact int, severity, description string) {
+	s.score -= impact
+	s.factors = append(s.factors, HealthFactor{
+		Name:        name,
+		Value:       value,
+		Impact:      impact,
+		Severity:    severity,
+		Description: description,
+	})
+	s.escalate(severity)
+}
+
+// ceiling 把分数限制在 limit 以内，超出部分记为该因素的扣分
+func (s *scorer) ceiling(name string, value int64, limit int, severity, description string) {
+	impact := 0
+	if s.score > limit {
+		impact = s.score - limit
+	}
+	s.deduct(name, value, impact, severity, description)
+}
+
+// escalate 提高等级，不会降低
+func (s *scorer) escalate(severity string) {
+	if severityRank(severity) > severityRank(s.severity) {
+		s.severity = severity
+	}
+}
+
+// result 返回评分，分数低于 80 至少为 warning，低于 50 为 critical（与网页界面的颜色一致）
+func (s *scorer) result() HealthScore {
+	score := clamp(s.score)
+	switch {
+	case score < 50:
+		s.escalate(HealthCritical)
+	case score < 80:
+		s.escalate(HealthWarning)
+	}
+	return HealthScore{Model: s.model, Score: score, Severity: s.severity, Factors: s.factors}
+}
+
+// smartFailed SMART 总体状态失败时分数为 0
+func (s *scorer) smartFailed(data *SMARTData) {
+	if data.SmartStatus == "FAILED" {
+		s.ceiling("smart_status", 0, 0, HealthCritical, "SMART 总体状态为 FAILED")
+	}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case HealthCritical:
+		return 2
+	case HealthWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func clamp(score int) int {
+	if score < 0 {
+		return 0
+	}
+	if score > 100 {
+		return 100
+	}
+	return score
+}
+
+// attribute 按 ID 查找 ATA 属性
+func attribute(data *SMARTData, id int) (SMARTAttribute, bool) {
+	for _, attr := range data.Attributes {
+		if attr.ID == id {
+			return attr, true
+		}
+	}
+	return SMARTAttribute{}, false
+}
+
+// legacyModel 旧版本的算法：重映射扇区每个 -2，待映射扇区每个 -3，不可纠正错误每个 -5，
+// SMART 状态失败 -50；NVMe 为 100 - 寿命已用百分比。适用于所有设备
+type legacyModel struct{}
+
+func (legacyModel) Name() string { return HealthModelLegacy }
+
+func (legacyModel) Score(data *SMARTData) (HealthScore, bool) {
+	if data.NVMe != nil {
+		s := newScorer(HealthModelLegacy, 100)
+		if used := data.NVMe.PercentageUsed; used > 0 {
+			s.deduct("nvme_percentage_used", int64(used), used, HealthOK, fmt.Sprintf("寿命已用 %d%%", used))
+		}
+		return s.result(), true
+	}
+
+	s := newScorer(HealthModelLegacy, 100)
+	for _, c := range []struct {
+		name, label string
+		value       int64
+		points      int
+	}{
+		{"reallocated_sectors", "重映射扇区", data.ReallocatedSectors, 2},
+		{"pending_sectors", "待映射扇区", data.PendingSectors, 3},
+		{"uncorrectable_errors", "不可纠正错误", data.UncorrectableErrors, 5},
+	} {
+		if c.value > 0 {
+			s.deduct(c.name, c.value, int(c.value)*c.points, HealthOK, fmt.Sprintf("%s %d 个，每个扣 %d 分", c.label, c.value, c.points))
+		}
+	}
+	if data.SmartStatus == "FAILED" {
+		s.deduct("smart_status", 0, 50, HealthCritical, "SMART 总体状态为 FAILED")
+	}
+	return s.result(), true
+}
+
+// backblazeModel 按 Backblaze 公布的硬盘统计，5/187/188/197/198 任何一个不为 0 都与故障率明显升高相关
+//
+// 每个属性不为 0 时先扣一个基础分，之后按对数增长，到饱和值时扣满。重映射和待映射类计数按容量（TB）
+// 折算，同样数量的坏扇区在大容量硬盘上扣分更少。SAS/SCSI 硬盘没有属性表，使用对应的计数。
+// 不适用于 NVMe。
+type backblazeModel struct{}
+
+// backblazeAttribute 一个风险属性的扣分参数
+type backblazeAttribute struct {
+	id         int
+	name       string
+	label      string
+	base, max  int     // 不为 0 时的基础扣分和最多扣分
+	saturation float64 // 扣满时的计数
+	perTB      bool    // 是否按容量折算
+}
+
+var backblazeAttributes = []backblazeAttribute{
+	{5, "reallocated_sectors", "重映射扇区", 5, 30, 1000, true},
+	{187, "reported_uncorrect", "报告的不可纠正错误", 10, 40, 100, false},
+	{188, "command_timeout", "命令超时", 3, 15, 100, false},
+	{197, "pending_sectors", "待映射扇区", 10, 40, 100, true},
+	{198, "offline_uncorrectable", "离线不可纠正扇区", 10, 40, 100, true},
+}
+
+func (backblazeModel) Name() string { return HealthModelBackblaze }
+
+func (backblazeModel) Score(data *SMARTData) (HealthScore, bool) {
+	if data.NVMe != nil {
+		return HealthScore{}, false
+	}
+
+	tb := float64(data.Device.CapacityGB) / 1000
+	if tb < 1 {
+		tb = 1
+	}
+
+	s := newScorer(HealthModelBackblaze, 100)
+	for _, a := range backblazeAttributes {
+		raw, ok := backblazeValue(data, a.id)
+		if !ok || raw <= 0 {
+			continue
+		}
+		count := float64(raw)
+		if a.perTB {
+			count /= tb
+		}
+		growth := math.Min(1, math.Log10(1+count)/math.Log10(1+a.saturation))
+		impact := a.base + int(math.Round(float64(a.max-a.base)*growth))
+
+		severity := HealthWarning
+		if impact >= a.max {
+			severity = HealthCritical
+		}
+		description := fmt.Sprintf("%s（%d）%d", a.label, a.id, raw)
+		if a.perTB && tb > 1 {
+			description += fmt.Sprintf("，按容量折算为每 TB %.1f", count)
+		}
+		s.deduct(a.name, raw, impact, severity, description)
+	}
+	s.smartFailed(data)
+	return s.result(), true
+}
+
+// backblazeValue 属性的原始值；没有属性表（SAS/SCSI）时使用对应的计数
+func backblazeValue(data *SMARTData, id int) (int64, bool) {
+	if len(data.Attributes) > 0 {
+		attr, ok := attribute(data, id)
+		if !ok {
+			return 0, false
+		}
+		raw := attr.RawValue
+		// 部分厂商（如希捷）把三个 16 位计数打包在 188 的原始值中，只取最低的一个
+		if id == 188 && raw > 0xFFFF {
+			raw &= 0xFFFF
+		}
+		return raw, true
+	}
+	switch id {
+	case 5:
+		return data.ReallocatedSectors, true
+	case 187:
+		return data.UncorrectableErrors, true
+	}
+	return 0, false
+}
+
+// ssdEnduranceModel 按 SSD 剩余写入寿命评分：NVMe 使用寿命已用百分比，SATA SSD 使用厂商的寿命属性
+// （归一化值即剩余百分比）。备用块低于阈值和介质错误另外扣分。没有寿命指标的设备不适用
+type ssdEnduranceModel struct{}
+
+// 常见的 SATA SSD 剩余寿命属性，按顺序使用第一个存在的
+var enduranceAttributes = []struct {
+	id   int
+	name string
+}{
+	{231, "SSD_Life_Left"},
+	{233, "Media_Wearout_Indicator"},
+	{202, "Percent_Lifetime_Remain"},
+	{177, "Wear_Leveling_Count"},
+	{169, "Remaining_Lifetime_Perc"},
+}
+
+func (ssdEnduranceModel) Name() string { return HealthModelSSDEndurance }
+
+func (ssdEnduranceModel) Score(data *SMARTData) (HealthScore, bool) {
+	remaining, name, ok := enduranceRemaining(data)
+	if !ok {
+		return HealthScore{}, false
+	}
+
+	s := newScorer(HealthModelSSDEndurance, 100)
+	if used := 100 - remaining; used > 0 {
+		severity := HealthOK
+		switch {
+		case remaining <= 10:
+			severity = HealthCritical
+		case remaining <= 30:
+			severity = HealthWarning
+		}
+		s.deduct(name, int64(remaining), used, severity, fmt.Sprintf("剩余写入寿命 %d%%", remaining))
+	}
+
+	if h := data.NVMe; h != nil {
+		if h.AvailableSpare < h.AvailableSpareThreshold {
+			s.ceiling("nvme_available_spare", int64(h.AvailableSpare), 10, HealthCritical,
+				fmt.Sprintf("备用空间 %d%% 低于阈值 %d%%", h.AvailableSpare, h.AvailableSpareThreshold))
+		}
+	} else if attr, ok := attribute(data, 232); ok && attr.Threshold > 0 && attr.Value <= attr.Threshold {
+		s.ceiling("attribute_232", int64(attr.Value), 10, HealthCritical,
+			fmt.Sprintf("保留空间 %d 不高于阈值 %d", attr.Value, attr.Threshold))
+	}
+
+	if n := data.UncorrectableErrors; n > 0 {
+		s.deduct("uncorrectable_errors", n, int(math.Min(30, float64(n)*5)), HealthWarning, fmt.Sprintf("介质错误 %d 个", n))
+	}
+	s.smartFailed(data)
+	return s.result(), true
+}
+
+// enduranceRemaining 剩余写入寿命百分比和使用的指标
+func enduranceRemaining(data *SMARTData) (int, string, bool) {
+	if data.NVMe != nil {
+		return clamp(100 - data.NVMe.PercentageUsed), "nvme_percentage_used", true
+	}
+	for _, a := range enduranceAttributes {
+		if attr, ok := attribute(data, a.id); ok {
+			return clamp(attr.Value), fmt.Sprintf("attribute_%d", a.id), true
+		}
+	}
+	return 0, "", false
+}
+
+// nvmeModel 按 NVMe 关键警告位评分：寿命已用按比例扣分，备用空间不足、可靠性下降和只读直接限制分数，
+// 温度和易失性存储备份警告另外扣分。不适用于非 NVMe 设备
+type nvmeModel struct{}
+
+// nvmeWarnings 关键警告位的处理：limit >= 0 时把分数限制在 limit 以内，否则扣 impact 分
+var nvmeWarnings = []struct {
+	bit      int
+	limit    int
+	impact   int
+	severity string
+	label    string
+}{
+	{NVMeWarnSpare, 20, 0, HealthCritical, "备用空间低于阈值"},
+	{NVMeWarnReliability, 10, 0, HealthCritical, "介质或内部错误导致可靠性下降"},
+	{NVMeWarnReadOnly, 0, 0, HealthCritical, "介质已进入只读模式"},
+	{NVMeWarnTemperature, -1, 10, HealthWarning, "温度超出阈值"},
+	{NVMeWarnVolatileBackup, -1, 10, HealthWarning, "易失性存储备份失效"},
+	{NVMeWarnPMRReadOnly, -1, 10, HealthWarning, "持久内存区域只读"},
+}
+
+func (nvmeModel) Name() string { return HealthModelNVMe }
+
+func (nvmeModel) Score(data *SMARTData) (HealthScore, bool) {
+	h := data.NVMe
+	if h == nil {
+		return HealthScore{}, false
+	}
+
+	// 寿命已用可以超过 100，分数最低为 0
+	s := newScorer(HealthModelNVMe, 100)
+	if used := h.PercentageUsed; used > 0 {
+		severity := HealthOK
+		if used >= 90 {
+			severity = HealthWarning
+		}
+		s.deduct("nvme_percentage_used", int64(used), int(math.Min(100, float64(used))), severity, fmt.Sprintf("寿命已用 %d%%", used))
+	}
+	for _, w := range nvmeWarnings {
+		if h.CriticalWarning&w.bit == 0 {
+			continue
+		}
+		description := fmt.Sprintf("关键警告位 0x%02x：%s", w.bit, w.label)
+		if w.limit >= 0 {
+			s.ceiling("nvme_critical_warning", int64(w.bit), w.limit, w.severity, description)
+		} else {
+			s.deduct("nvme_critical_warning", int64(w.bit), w.impact, w.severity, description)
+		}
+	}
+	if n := h.MediaErrors; n > 0 {
+		s.deduct("nvme_media_errors", n, int(math.Min(30, float64(n)*5)), HealthWarning, fmt.Sprintf("介质错误 %d 个", n))
+	}
+	s.smartFailed(data)
+	return s.result(), true
+}
+
+// autoModel 按设备类型选择模型：NVMe 用 nvme；SSD 优先用 ssd_endurance，没有寿命指标时用 backblaze；其他用 backblaze
+type autoModel struct{}
+
+func (autoModel) Name() string { return HealthModelAuto }
+
+func (autoModel) Score(data *SMARTData) (HealthScore, bool) {
+	if data.NVMe != nil {
+		return nvmeModel{}.Score(data)
+	}
+	if data.Device.DeviceType == "SSD" {
+		if score, ok := (ssdEnduranceModel{}).Score(data); ok {
+			return score, true
+		}
+	}
+	return backblazeModel{}.Score(data)
+}
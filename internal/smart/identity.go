@@ -0,0 +1,57 @@
+package smart
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IdentityResolver 根据设备信息确定稳定的设备标识并写入 Device.ID
+//
+// 设备路径（/dev/sdX）重启后会变化，部分 USB 桥接芯片读不到序列号，
+// 因此不能直接以路径或序列号作为存储的键。
+type IdentityResolver interface {
+	Resolve(device *Device)
+}
+
+// wwnValue smartctl 输出的 WWN（NAA 4 位 + OUI 24 位 + 厂商 ID 36 位）
+type wwnValue struct {
+	NAA int    `json:"naa"`
+	OUI uint64 `json:"oui"`
+	ID  uint64 `json:"id"`
+}
+
+// nvmeNamespace nvme_namespaces 中的一项
+type nvmeNamespace struct {
+	ID    int `json:"id"`
+	EUI64 *struct {
+		OUI   uint64 `json:"oui"`
+		ExtID uint64 `json:"ext_id"`
+	} `json:"eui64"`
+	NGUID string `json:"nguid"`
+}
+
+// parseIdentifiers 解析固件版本、WWN 和 NVMe 命名空间标识，格式与 /dev/disk/by-id 中的一致
+func parseIdentifiers(data *SMARTData, raw *smartctlOutput) {
+	data.Device.Firmware = raw.FirmwareVersion
+
+	if w := raw.Wwn; w != nil && (w.OUI != 0 || w.ID != 0) {
+		data.Device.WWN = fmt.Sprintf("0x%016x", uint64(w.NAA)<<60|w.OUI<<36|w.ID)
+	} else if lu := strings.ToLower(raw.LogicalUnitID); lu != "" {
+		if !strings.HasPrefix(lu, "0x") {
+			lu = "0x" + lu
+		}
+		data.Device.WWN = lu
+	}
+
+	// 只取第一个命名空间，和 smartctl 读取的数据一致
+	if len(raw.NvmeNamespaces) > 0 {
+		ns := raw.NvmeNamespaces[0]
+		if ns.EUI64 != nil && (ns.EUI64.OUI != 0 || ns.EUI64.ExtID != 0) {
+			data.Device.EUI64 = fmt.Sprintf("%016x", ns.EUI64.OUI<<40|ns.EUI64.ExtID)
+		}
+		nguid := strings.ToLower(strings.ReplaceAll(ns.NGUID, "-", ""))
+		if strings.Trim(nguid, "0") != "" {
+			data.Device.NGUID = nguid
+		}
+	}
+}
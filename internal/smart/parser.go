@@ -1,16 +1,17 @@
 package smart
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"strings"
 )
 
 // smartctlOutput smartctl JSON 输出结构（只解析需要的字段）
 type smartctlOutput struct {
 	Smartctl struct {
-		Messages []struct {
+		ExitStatus int `json:"exit_status"`
+		Messages   []struct {
 			String   string `json:"string"`
 			Severity string `json:"severity"`
 		} `json:"messages"`
@@ -20,22 +21,53 @@ type smartctlOutput struct {
 		Type     string `json:"type"`
 		Protocol string `json:"protocol"`
 	} `json:"device"`
-	ModelName       string `json:"model_name"`
-	SerialNumber    string `json:"serial_number"`
-	RotationRate    int    `json:"rotation_rate"`    // 0 = SSD, >0 = HDD RPM
+	ModelName       string          `json:"model_name"`
+	FirmwareVersion string          `json:"firmware_version"`
+	Wwn             *wwnValue       `json:"wwn"`
+	LogicalUnitID   string          `json:"logical_unit_id"` // SCSI 的 NAA 标识，相当于 WWN
+	NvmeNamespaces  []nvmeNamespace `json:"nvme_namespaces"`
+	ScsiVendor      string          `json:"scsi_vendor"`
+	ScsiProduct     string          `json:"scsi_product"`
+	SerialNumber    string          `json:"serial_number"`
+	RotationRate    int             `json:"rotation_rate"` // 0 = SSD, >0 = HDD RPM
 	Trim            struct {
 		Supported bool `json:"supported"` // TRIM 支持表示 SSD
 	} `json:"trim"`
-	SmartStatus     struct {
+	SmartStatus struct {
 		Passed bool `json:"passed"`
 	} `json:"smart_status"`
 	Temperature struct {
-		Current int `json:"current"`
+		Current          int  `json:"current"`
+		PowerCycleMin    *int `json:"power_cycle_min"`
+		PowerCycleMax    *int `json:"power_cycle_max"`
+		LifetimeMin      *int `json:"lifetime_min"`
+		LifetimeMax      *int `json:"lifetime_max"`
+		OpLimitMin       *int `json:"op_limit_min"`
+		OpLimitMax       *int `json:"op_limit_max"`
+		LimitMin         *int `json:"limit_min"`
+		LimitMax         *int `json:"limit_max"`
+		CriticalLimitMax *int `json:"critical_limit_max"`
+		DriveTrip        *int `json:"drive_trip"`
 	} `json:"temperature"`
+	NvmeCompositeTemperatureThreshold *struct {
+		Warning  int `json:"warning"`
+		Critical int `json:"critical"`
+	} `json:"nvme_composite_temperature_threshold"`
+	AtaSctTemperatureHistory *struct {
+		SamplingPeriodMinutes  int `json:"sampling_period_minutes"`
+		LoggingIntervalMinutes int `json:"logging_interval_minutes"`
+		Temperature            struct {
+			OpLimitMin *int `json:"op_limit_min"`
+			OpLimitMax *int `json:"op_limit_max"`
+			LimitMin   *int `json:"limit_min"`
+			LimitMax   *int `json:"limit_max"`
+		} `json:"temperature"`
+		Table []*int `json:"table"`
+	} `json:"ata_sct_temperature_history"`
 	PowerOnTime struct {
 		Hours int64 `json:"hours"`
 	} `json:"power_on_time"`
-	PowerCycleCount int64 `json:"power_cycle_count"`
+	PowerCycleCount    int64 `json:"power_cycle_count"`
 	AtaSmartAttributes struct {
 		Table []struct {
 			ID         int    `json:"id"`
@@ -45,38 +77,73 @@ type smartctlOutput struct {
 			Thresh     int    `json:"thresh"`
 			WhenFailed string `json:"when_failed"`
 			Raw        struct {
-				Value  int64 `json:"value"`
+				Value  int64  `json:"value"`
 				String string `json:"string"`
 			} `json:"raw"`
 		} `json:"table"`
 	} `json:"ata_smart_attributes"`
+	ScsiGrownDefectList       int64 `json:"scsi_grown_defect_list"`
+	ScsiStartStopCycleCounter struct {
+		AccumulatedStartStopCycles  int64 `json:"accumulated_start_stop_cycles"`
+		AccumulatedLoadUnloadCycles int64 `json:"accumulated_load_unload_cycles"`
+	} `json:"scsi_start_stop_cycle_counter"`
+	ScsiErrorCounterLog struct {
+		Read   scsiErrorCounter `json:"read"`
+		Write  scsiErrorCounter `json:"write"`
+		Verify scsiErrorCounter `json:"verify"`
+	} `json:"scsi_error_counter_log"`
+	AtaSmartData                  ataSmartData        `json:"ata_smart_data"`
+	AtaSmartSelfTestLog           ataSmartSelfTestLog `json:"ata_smart_self_test_log"`
+	NvmeSelfTestLog               nvmeSelfTestLog     `json:"nvme_self_test_log"`
 	NvmeSmartHealthInformationLog struct {
-		Temperature         int   `json:"temperature"`
-		PowerOnHours        int64 `json:"power_on_hours"`
-		PowerCycles         int64 `json:"power_cycles"`
-		UnsafeShutdowns     int64 `json:"unsafe_shutdowns"`
-		MediaErrors         int64 `json:"media_errors"`
-		PercentageUsed      int   `json:"percentage_used"`
+		CriticalWarning         int   `json:"critical_warning"`
+		Temperature             int   `json:"temperature"`
+		AvailableSpare          int   `json:"available_spare"`
+		AvailableSpareThreshold int   `json:"available_spare_threshold"`
+		PercentageUsed          int   `json:"percentage_used"`
+		DataUnitsRead           int64 `json:"data_units_read"`
+		DataUnitsWritten        int64 `json:"data_units_written"`
+		HostReads               int64 `json:"host_reads"`
+		HostWrites              int64 `json:"host_writes"`
+		ControllerBusyTime      int64 `json:"controller_busy_time"`
+		PowerCycles             int64 `json:"power_cycles"`
+		PowerOnHours            int64 `json:"power_on_hours"`
+		UnsafeShutdowns         int64 `json:"unsafe_shutdowns"`
+		MediaErrors             int64 `json:"media_errors"`
+		NumErrLogEntries        int64 `json:"num_err_log_entries"`
+		WarningTempTime         int64 `json:"warning_temp_time"`
+		CriticalCompTime        int64 `json:"critical_comp_time"`
 	} `json:"nvme_smart_health_information_log"`
 }
 
-// USBBridgeTypes 支持的 USB 桥接类型
-var USBBridgeTypes = []string{"", "sat", "usbsunplus", "usbjmicron", "usbcypress"}
+// scsiErrorCounter SCSI 错误计数日志（读/写/校验各一份）
+type scsiErrorCounter struct {
+	TotalErrorsCorrected   int64 `json:"total_errors_corrected"`
+	TotalUncorrectedErrors int64 `json:"total_uncorrected_errors"`
+}
 
-// parseSMARTData 解析 smartctl 输出
-func parseSMARTData(deviceName string, usbType string) (*SMARTData, error) {
-	args := []string{"--all", "-j"}
+// readSMARTData 调用 smartctl 读取并解析指定设备的数据，noWake 时设备处于待机则不读取并返回 ErrStandby
+func (d *DeviceDetector) readSMARTData(ctx context.Context, deviceName string, usbType string, noWake bool) (*SMARTData, error) {
+	// --all 不包含 SCT 温度历史，NVMe 和 SCSI 设备会忽略 -l scttemp
+	args := []string{"--all", "-l", "scttemp", "-j"}
+	if noWake {
+		args = append(args, "-n", "standby")
+	}
 	if usbType != "" {
 		args = append(args, "-d", usbType)
 	}
 	args = append(args, deviceName)
 
-	cmd := exec.Command("smartctl", args...)
-	out, err := cmd.Output()
+	out, err := d.runner.Run(ctx, args...)
 	if err != nil && len(out) == 0 {
-		return nil, fmt.Errorf("smartctl failed: %w", err)
+		return nil, err
 	}
 
+	return parseSMARTData(deviceName, out)
+}
+
+// parseSMARTData 解析 smartctl -j 输出
+func parseSMARTData(deviceName string, out []byte) (*SMARTData, error) {
 	var raw smartctlOutput
 	if err := json.Unmarshal(out, &raw); err != nil {
 		return nil, fmt.Errorf("parse smartctl output: %w", err)
@@ -95,15 +162,37 @@ func parseSMARTData(deviceName string, usbType string) (*SMARTData, error) {
 		return nil, fmt.Errorf("不支持的 USB 桥接芯片，无法读取 SMART 数据")
 	}
 
+	// -n standby 跳过时只输出一条 "Device is in STANDBY mode, exit(2)"
+	for _, msg := range raw.Smartctl.Messages {
+		if strings.Contains(msg.String, "is in STANDBY mode") || strings.Contains(msg.String, "is in SLEEP mode") {
+			return nil, ErrStandby
+		}
+	}
+
+	// 打开设备失败时只输出一条 "Smartctl open device: /dev/sdx failed: No such device"
+	for _, msg := range raw.Smartctl.Messages {
+		if msg.Severity != "error" {
+			continue
+		}
+		if strings.Contains(msg.String, "No such device") || strings.Contains(msg.String, "No such file or directory") {
+			return nil, fmt.Errorf("%s: %w", deviceName, ErrDeviceNotFound)
+		}
+		if strings.Contains(msg.String, "Device or resource busy") {
+			return nil, fmt.Errorf("%s: %w", deviceName, ErrDeviceBusy)
+		}
+	}
+
 	// 构建数据结构
 	data := &SMARTData{
 		Device: Device{
-			Name:    deviceName,
-			Model:   raw.ModelName,
-			Serial:  raw.SerialNumber,
+			Name:   deviceName,
+			Model:  raw.ModelName,
+			Serial: raw.SerialNumber,
 		},
 		SmartStatus: "PASSED",
 	}
+	parseIdentifiers(data, &raw)
+	parseThermal(data, &raw)
 
 	if !raw.SmartStatus.Passed {
 		data.SmartStatus = "FAILED"
@@ -113,10 +202,16 @@ func parseSMARTData(deviceName string, usbType string) (*SMARTData, error) {
 	if strings.Contains(raw.Device.Protocol, "NVMe") {
 		data.Device.DeviceType = "NVMe"
 		parseNVMeData(data, &raw)
+		data.SelfTest = parseNVMeSelfTest(&raw.NvmeSelfTestLog)
+	} else if raw.Device.Protocol == "SCSI" {
+		// SAS/SCSI 设备没有 ATA 属性表
+		parseSCSIData(data, &raw)
+		data.Device.DeviceType = detectDriveType(&raw)
 	} else {
 		// ATA/SATA (HDD/SSD)
 		parseATAData(data, &raw)
 		data.Device.DeviceType = detectDriveType(&raw)
+		data.SelfTest = parseATASelfTest(&raw.AtaSmartData, &raw.AtaSmartSelfTestLog)
 	}
 
 	return data, nil
@@ -158,9 +253,6 @@ func parseATAData(data *SMARTData, raw *smartctlOutput) {
 			}
 		}
 	}
-
-	// 计算健康度
-	data.HealthPercent = calculateHealth(data)
 }
 
 // parseNVMeData 解析 NVMe 设备数据
@@ -170,38 +262,43 @@ func parseNVMeData(data *SMARTData, raw *smartctlOutput) {
 	data.PowerOnHours = log.PowerOnHours
 	data.PowerCycleCount = log.PowerCycles
 	data.UncorrectableErrors = log.MediaErrors
-	data.HealthPercent = 100 - log.PercentageUsed
-}
-
-// calculateHealth 计算健康度百分比
-func calculateHealth(data *SMARTData) int {
-	health := 100
 
-	// 重映射扇区每个 -2%
-	if data.ReallocatedSectors > 0 {
-		health -= int(data.ReallocatedSectors) * 2
-	}
-
-	// 待映射扇区每个 -3%
-	if data.PendingSectors > 0 {
-		health -= int(data.PendingSectors) * 3
-	}
-
-	// 不可纠正错误每个 -5%
-	if data.UncorrectableErrors > 0 {
-		health -= int(data.UncorrectableErrors) * 5
+	data.NVMe = &NVMeHealth{
+		CriticalWarning:         log.CriticalWarning,
+		AvailableSpare:          log.AvailableSpare,
+		AvailableSpareThreshold: log.AvailableSpareThreshold,
+		PercentageUsed:          log.PercentageUsed,
+		DataUnitsRead:           log.DataUnitsRead,
+		DataUnitsWritten:        log.DataUnitsWritten,
+		HostReadCommands:        log.HostReads,
+		HostWriteCommands:       log.HostWrites,
+		ControllerBusyTime:      log.ControllerBusyTime,
+		UnsafeShutdowns:         log.UnsafeShutdowns,
+		MediaErrors:             log.MediaErrors,
+		ErrorLogEntries:         log.NumErrLogEntries,
+		WarningTempTime:         log.WarningTempTime,
+		CriticalCompTime:        log.CriticalCompTime,
 	}
+}
 
-	// SMART 状态失败 -50%
-	if data.SmartStatus == "FAILED" {
-		health -= 50
+// parseSCSIData 解析 SAS/SCSI 设备数据，映射到与 ATA 相同的字段
+func parseSCSIData(data *SMARTData, raw *smartctlOutput) {
+	// 旧版 smartctl 的 SCSI 输出没有 model_name
+	if data.Device.Model == "" {
+		data.Device.Model = strings.TrimSpace(raw.ScsiVendor + " " + raw.ScsiProduct)
 	}
+	data.Temperature = raw.Temperature.Current
+	data.PowerOnHours = raw.PowerOnTime.Hours
+	data.PowerCycleCount = raw.ScsiStartStopCycleCounter.AccumulatedStartStopCycles
 
-	if health < 0 {
-		health = 0
-	}
+	// Grown defect list 相当于 ATA 的重映射扇区
+	data.ReallocatedSectors = raw.ScsiGrownDefectList
 
-	return health
+	// 读/写/校验中未能纠正的错误总和
+	counters := raw.ScsiErrorCounterLog
+	data.UncorrectableErrors = counters.Read.TotalUncorrectedErrors +
+		counters.Write.TotalUncorrectedErrors +
+		counters.Verify.TotalUncorrectedErrors
 }
 
 // detectDriveType 准确检测 SSD/HDD 类型
@@ -240,4 +337,4 @@ func detectDeviceType(name string) string {
 		return "NVMe"
 	}
 	return "Unknown"
-}
\ No newline at end of file
+}
@@ -0,0 +1,155 @@
+package smart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Runner 执行 smartctl 命令的抽象，便于在没有真实硬盘的机器上开发和复现问题
+type Runner interface {
+	// Run 以给定参数执行 smartctl，返回标准输出。
+	// smartctl 的退出码是位掩码，非零时仍可能输出有效 JSON，调用方需自行判断。
+	// ctx 取消或超时时应尽快终止命令
+	Run(ctx context.Context, args ...string) ([]byte, error)
+}
+
+// ExecRunner 直接调用本机 smartctl
+type ExecRunner struct {
+	Path string // smartctl 可执行文件路径，为空时从 PATH 查找
+}
+
+// NewExecRunner 创建本机 smartctl 执行器
+func NewExecRunner() *ExecRunner {
+	return &ExecRunner{Path: "smartctl"}
+}
+
+// Run 实现 Runner 接口
+func (r *ExecRunner) Run(ctx context.Context, args ...string) ([]byte, error) {
+	path := r.Path
+	if path == "" {
+		path = "smartctl"
+	}
+
+	out, err := exec.CommandContext(ctx, path, args...).Output()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// 被 ctx 终止时返回 ctx 的错误，便于调用方区分超时和取消
+		return nil, ctxErr
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %v", ErrSmartctlNotFound, err)
+	}
+	return out, err
+}
+
+// ErrFixtureNotFound 回放目录中没有对应的录制文件
+var ErrFixtureNotFound = errors.New("fixture not found")
+
+// ReplayRunner 从目录回放录制的 smartctl -j 输出
+//
+// 目录布局（每个文件是一次 smartctl -j 调用的原始标准输出）：
+//
+//	scan.json            smartctl --scan-open -j
+//	sda.json             smartctl --all -j /dev/sda
+//	sde@sat.json         smartctl --all -j -d sat /dev/sde
+//	sdf@sat_12.json      smartctl --all -j -d sat,12 /dev/sdf
+//	sda+test_short.json  smartctl -t short -j /dev/sda
+type ReplayRunner struct {
+	Dir string
+}
+
+// NewReplayRunner 创建回放执行器
+func NewReplayRunner(dir string) *ReplayRunner {
+	return &ReplayRunner{Dir: dir}
+}
+
+// Run 实现 Runner 接口
+func (r *ReplayRunner) Run(ctx context.Context, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	name := FixtureName(args)
+	out, err := os.ReadFile(filepath.Join(r.Dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("replay %s: %w", name, ErrFixtureNotFound)
+		}
+		return nil, fmt.Errorf("replay %s: %w", name, err)
+	}
+	return out, nil
+}
+
+// RecordRunner 包装另一个 Runner，把每次输出按回放目录的格式保存下来
+type RecordRunner struct {
+	Runner Runner
+	Dir    string
+}
+
+// NewRecordRunner 创建录制执行器
+func NewRecordRunner(runner Runner, dir string) *RecordRunner {
+	return &RecordRunner{Runner: runner, Dir: dir}
+}
+
+// Run 实现 Runner 接口
+func (r *RecordRunner) Run(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := r.Runner.Run(ctx, args...)
+	if len(out) == 0 {
+		return out, err
+	}
+
+	// 录制失败不影响正常采集
+	if mkErr := os.MkdirAll(r.Dir, 0755); mkErr != nil {
+		log.Printf("Failed to create record dir %s: %v", r.Dir, mkErr)
+		return out, err
+	}
+	filename := filepath.Join(r.Dir, FixtureName(args))
+	if wErr := os.WriteFile(filename, out, 0644); wErr != nil {
+		log.Printf("Failed to record %s: %v", filename, wErr)
+	}
+
+	return out, err
+}
+
+// fixtureReplacer 把设备路径和 -d 参数转换为安全的文件名
+var fixtureReplacer = strings.NewReplacer("/", "_", ",", "_", " ", "_", ":", "_", "\\", "_")
+
+// FixtureName 根据 smartctl 参数生成录制文件名（按设备、-t 自检类型和 -d 类型区分）
+func FixtureName(args []string) string {
+	var device, devType, test string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--scan-open" || arg == "--scan":
+			return "scan.json"
+		case arg == "-d" && i+1 < len(args):
+			devType = args[i+1]
+			i++
+		case arg == "-n" && i+1 < len(args):
+			// -n 只决定待机时是否跳过读取，和完整读取共用同一个录制文件
+			i++
+		case arg == "-l" && i+1 < len(args):
+			// 附加的日志和完整读取共用同一个录制文件
+			i++
+		case arg == "-t" && i+1 < len(args):
+			test = args[i+1]
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			device = arg
+		}
+	}
+
+	name := fixtureReplacer.Replace(strings.TrimPrefix(device, "/dev/"))
+	if test != "" {
+		name += "+test_" + fixtureReplacer.Replace(test)
+	}
+	if devType != "" {
+		name += "@" + fixtureReplacer.Replace(devType)
+	}
+	return name + ".json"
+}
@@ -0,0 +1,87 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// replayDir 测试用的录制目录
+const replayDir = "testdata/replay"
+
+func TestFixtureName(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--scan-open", "-j"}, "scan.json"},
+		{[]string{"--all", "-j", "/dev/sda"}, "sda.json"},
+		{[]string{"--all", "-l", "scttemp", "-j", "-n", "standby", "/dev/sda"}, "sda.json"},
+		{[]string{"--all", "-j", "-d", "sat", "/dev/sde"}, "sde@sat.json"},
+		{[]string{"--all", "-j", "-d", "sat,12", "/dev/sdf"}, "sdf@sat_12.json"},
+		{[]string{"-t", "short", "-j", "/dev/sda"}, "sda+test_short.json"},
+		{[]string{"--all", "-j", "/dev/disk/by-id/usb-JMicron_0001"}, "disk_by-id_usb-JMicron_0001.json"},
+	}
+	for _, tt := range tests {
+		if got := FixtureName(tt.args); got != tt.want {
+			t.Errorf("FixtureName(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestReplayRunner(t *testing.T) {
+	runner := NewReplayRunner(replayDir)
+
+	out, err := runner.Run(context.Background(), "--all", "-j", "/dev/sda")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want, err := os.ReadFile(filepath.Join(replayDir, "sda.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, want) {
+		t.Errorf("Run returned %d bytes, want the content of sda.json", len(out))
+	}
+
+	if _, err := runner.Run(context.Background(), "--all", "-j", "/dev/sdz"); !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("missing fixture: err = %v, want ErrFixtureNotFound", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := runner.Run(ctx, "--all", "-j", "/dev/sda"); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: err = %v, want context.Canceled", err)
+	}
+}
+
+func TestRecordRunner(t *testing.T) {
+	dir := t.TempDir()
+	recorder := NewRecordRunner(NewReplayRunner(replayDir), dir)
+
+	args := []string{"--all", "-j", "-d", "sat", "/dev/sdc"}
+	out, err := recorder.Run(context.Background(), args...)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// 录制的文件可以直接回放
+	replayed, err := NewReplayRunner(dir).Run(context.Background(), args...)
+	if err != nil {
+		t.Fatalf("replay recorded output: %v", err)
+	}
+	if !bytes.Equal(out, replayed) {
+		t.Error("replayed output differs from the recorded one")
+	}
+
+	// 没有输出时不录制
+	if _, err := recorder.Run(context.Background(), "--all", "-j", "/dev/sdz"); err == nil {
+		t.Fatal("expected an error for a missing fixture")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sdz.json")); !os.IsNotExist(err) {
+		t.Errorf("empty output was recorded: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package smart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 自检类型
+const (
+	SelfTestShort      = "short"
+	SelfTestLong       = "long"
+	SelfTestConveyance = "conveyance"
+	SelfTestOther      = "other"
+)
+
+// SelfTestStatus 设备当前的自检状态和自检日志
+type SelfTestStatus struct {
+	InProgress       bool            `json:"in_progress"`
+	Type             string          `json:"type,omitempty"`              // 正在进行的测试类型（NVMe 才报告）
+	RemainingPercent int             `json:"remaining_percent,omitempty"` // 正在进行的测试剩余百分比
+	Status           string          `json:"status,omitempty"`            // smartctl 对当前状态的描述
+	ShortMinutes     int             `json:"short_minutes,omitempty"`     // 厂商给出的短测试预计耗时（ATA）
+	LongMinutes      int             `json:"long_minutes,omitempty"`      // 厂商给出的长测试预计耗时（ATA）
+	Log              []SelfTestEntry `json:"log,omitempty"`               // 设备自检日志，最新的在前
+}
+
+// SelfTestEntry 设备自检日志中的一条记录
+type SelfTestEntry struct {
+	Type          string `json:"type"`        // short/long/conveyance/other
+	Description   string `json:"description"` // smartctl 给出的类型描述，如 Short offline
+	Status        string `json:"status"`      // 结果描述，如 Completed without error
+	Passed        bool   `json:"passed"`
+	LifetimeHours int64  `json:"lifetime_hours"`        // 测试时的通电小时数
+	FailingLBA    int64  `json:"failing_lba,omitempty"` // 第一个出错的 LBA
+}
+
+// smartctlValue smartctl JSON 中常见的 {value, string} 结构
+type smartctlValue struct {
+	Value  int    `json:"value"`
+	String string `json:"string"`
+}
+
+// ataSmartData ata_smart_data 中与自检相关的部分
+type ataSmartData struct {
+	SelfTest struct {
+		Status struct {
+			Value            int    `json:"value"`
+			String           string `json:"string"`
+			RemainingPercent *int   `json:"remaining_percent"`
+		} `json:"status"`
+		PollingMinutes struct {
+			Short    int `json:"short"`
+			Extended int `json:"extended"`
+		} `json:"polling_minutes"`
+	} `json:"self_test"`
+}
+
+// ataSmartSelfTestLog ata_smart_self_test_log
+type ataSmartSelfTestLog struct {
+	Standard struct {
+		Table []struct {
+			Type   smartctlValue `json:"type"`
+			Status struct {
+				Value  int    `json:"value"`
+				String string `json:"string"`
+				Passed *bool  `json:"passed"`
+			} `json:"status"`
+			LifetimeHours int64 `json:"lifetime_hours"`
+			LBA           int64 `json:"lba"`
+		} `json:"table"`
+	} `json:"standard"`
+}
+
+// nvmeSelfTestLog nvme_self_test_log
+type nvmeSelfTestLog struct {
+	CurrentSelfTestOperation         smartctlValue `json:"current_self_test_operation"`
+	CurrentSelfTestCompletionPercent int           `json:"current_self_test_completion_percent"`
+	Table                            []struct {
+		SelfTestCode   smartctlValue `json:"self_test_code"`
+		SelfTestResult smartctlValue `json:"self_test_result"`
+		PowerOnHours   int64         `json:"power_on_hours"`
+		LBA            int64         `json:"lba"`
+	} `json:"table"`
+}
+
+// parseATASelfTest 解析 ATA 自检执行状态和自检日志
+func parseATASelfTest(data *ataSmartData, testLog *ataSmartSelfTestLog) *SelfTestStatus {
+	st := data.SelfTest
+	status := &SelfTestStatus{
+		Status:       st.Status.String,
+		ShortMinutes: st.PollingMinutes.Short,
+		LongMinutes:  st.PollingMinutes.Extended,
+	}
+
+	// 执行状态高 4 位为 0xF 表示正在进行，低 4 位为剩余的十分之几
+	if st.Status.Value>>4 == 0xF {
+		status.InProgress = true
+		status.RemainingPercent = (st.Status.Value & 0xF) * 10
+		if st.Status.RemainingPercent != nil {
+			status.RemainingPercent = *st.Status.RemainingPercent
+		}
+	}
+
+	for _, e := range testLog.Standard.Table {
+		passed := e.Status.Value == 0
+		if e.Status.Passed != nil {
+			passed = *e.Status.Passed
+		}
+		status.Log = append(status.Log, SelfTestEntry{
+			Type:          ataSelfTestType(e.Type.Value),
+			Description:   e.Type.String,
+			Status:        e.Status.String,
+			Passed:        passed,
+			LifetimeHours: e.LifetimeHours,
+			FailingLBA:    e.LBA,
+		})
+	}
+
+	if status.Status == "" && len(status.Log) == 0 {
+		return nil
+	}
+	return status
+}
+
+// ataSelfTestType ATA 自检类型：1/129 短测试，2/130 扩展测试，3/131 传输测试（129 起为 captive 模式）
+func ataSelfTestType(value int) string {
+	switch value & 0x7F {
+	case 1:
+		return SelfTestShort
+	case 2:
+		return SelfTestLong
+	case 3:
+		return SelfTestConveyance
+	default:
+		return SelfTestOther
+	}
+}
+
+// parseNVMeSelfTest 解析 NVMe 自检日志（Log Page 06h）
+func parseNVMeSelfTest(testLog *nvmeSelfTestLog) *SelfTestStatus {
+	op := testLog.CurrentSelfTestOperation
+	if op.String == "" && len(testLog.Table) == 0 {
+		return nil
+	}
+
+	status := &SelfTestStatus{Status: op.String}
+	if op.Value != 0 {
+		status.InProgress = true
+		status.Type = nvmeSelfTestType(op.Value)
+		status.RemainingPercent = 100 - testLog.CurrentSelfTestCompletionPercent
+	}
+
+	for _, e := range testLog.Table {
+		// 0xF 表示日志条目未使用
+		if e.SelfTestResult.Value == 0xF {
+			continue
+		}
+		status.Log = append(status.Log, SelfTestEntry{
+			Type:          nvmeSelfTestType(e.SelfTestCode.Value),
+			Description:   e.SelfTestCode.String,
+			Status:        e.SelfTestResult.String,
+			Passed:        e.SelfTestResult.Value == 0,
+			LifetimeHours: e.PowerOnHours,
+			FailingLBA:    e.LBA,
+		})
+	}
+
+	return status
+}
+
+// nvmeSelfTestType NVMe 自检代码：1 短测试，2 扩展测试
+func nvmeSelfTestType(code int) string {
+	switch code {
+	case 1:
+		return SelfTestShort
+	case 2:
+		return SelfTestLong
+	default:
+		return SelfTestOther
+	}
+}
+
+// StartSelfTest 启动设备自检（smartctl -t short|long），测试在设备后台运行，命令立即返回
+func (d *DeviceDetector) StartSelfTest(ctx context.Context, deviceName, testType string) error {
+	if testType != SelfTestShort && testType != SelfTestLong {
+		return fmt.Errorf("unsupported self-test type %q", testType)
+	}
+
+	types, _ := d.bridgeOrder(deviceName)
+	var lastErr error
+	for _, usbType := range types {
+		args := []string{"-t", testType, "-j"}
+		if usbType != "" {
+			args = append(args, "-d", usbType)
+		}
+		args = append(args, deviceName)
+
+		out, err := d.runner.Run(ctx, args...)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("smartctl %s: %w", deviceName, ctxErr)
+		}
+		if err != nil && len(out) == 0 {
+			lastErr = err
+			continue
+		}
+		if err := checkSmartctlResult(out); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+
+	return fmt.Errorf("start %s self-test on %s: %w", testType, deviceName, lastErr)
+}
+
+// checkSmartctlResult 检查 smartctl 退出码的低 3 位（参数错误、无法打开设备、命令失败）
+func checkSmartctlResult(out []byte) error {
+	var raw smartctlOutput
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return fmt.Errorf("parse smartctl output: %w", err)
+	}
+	if raw.Smartctl.ExitStatus&0x7 == 0 {
+		return nil
+	}
+
+	var msgs []string
+	for _, msg := range raw.Smartctl.Messages {
+		msgs = append(msgs, msg.String)
+	}
+	if len(msgs) == 0 {
+		return fmt.Errorf("smartctl exit status %d", raw.Smartctl.ExitStatus)
+	}
+	return fmt.Errorf("smartctl exit status %d: %s", raw.Smartctl.ExitStatus, strings.Join(msgs, "; "))
+}
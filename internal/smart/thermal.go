@@ -0,0 +1,228 @@
+package smart
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// 温度状态
+const (
+	ThermalOK       = "ok"
+	ThermalWarm     = "warm"
+	ThermalCritical = "critical"
+)
+
+// 内置的设备类别，对应 Device.DeviceType
+const (
+	ThermalClassHDD  = "hdd"
+	ThermalClassSSD  = "ssd"
+	ThermalClassNVMe = "nvme"
+)
+
+// ThermalInfo 温度详情：smartctl 的 temperature 块、SCT 温度历史，以及按设备类别判定的温度状态
+//
+// 硬盘没有报告的值为空。
+type ThermalInfo struct {
+	PowerCycleMin    *int `json:"power_cycle_min,omitempty"`    // 本次通电以来最低温度
+	PowerCycleMax    *int `json:"power_cycle_max,omitempty"`    // 本次通电以来最高温度
+	LifetimeMin      *int `json:"lifetime_min,omitempty"`       // 有记录以来最低温度
+	LifetimeMax      *int `json:"lifetime_max,omitempty"`       // 有记录以来最高温度
+	OpLimitMin       *int `json:"op_limit_min,omitempty"`       // 推荐工作温度下限
+	OpLimitMax       *int `json:"op_limit_max,omitempty"`       // 推荐工作温度上限（NVMe 为警告阈值 WCTEMP）
+	LimitMin         *int `json:"limit_min,omitempty"`          // 极限温度下限
+	LimitMax         *int `json:"limit_max,omitempty"`          // 极限温度上限
+	CriticalLimitMax *int `json:"critical_limit_max,omitempty"` // NVMe 临界阈值 CCTEMP
+	DriveTrip        *int `json:"drive_trip,omitempty"`         // SCSI 硬盘的过热保护温度
+
+	History *SCTTemperatureHistory `json:"sct_history,omitempty"` // ATA SCT 温度历史（smartctl -l scttemp）
+
+	Class  string         `json:"class,omitempty"`  // 温度策略使用的设备类别
+	Limits *ThermalLimits `json:"limits,omitempty"` // 该类别的温度阈值
+	State  string         `json:"state,omitempty"`  // ok/warm/critical，没有温度读数时为空
+}
+
+// SCTTemperatureHistory 硬盘自己记录的温度历史（环形缓冲，smartctl 按从旧到新输出）
+type SCTTemperatureHistory struct {
+	SamplingPeriodMinutes  int    `json:"sampling_period_minutes"`  // 采样周期
+	LoggingIntervalMinutes int    `json:"logging_interval_minutes"` // 每条记录的间隔
+	Table                  []*int `json:"table"`                    // 从旧到新，最后一条为读取时的温度，空表示没有记录
+}
+
+// TemperatureSample 一个时间点的温度
+type TemperatureSample struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Temperature int       `json:"temperature"`
+}
+
+// Samples 把温度历史换算为时间点，at 为读取时间（对应表中最后一条）
+func (h *SCTTemperatureHistory) Samples(at time.Time) []TemperatureSample {
+	if h == nil || h.LoggingIntervalMinutes <= 0 {
+		return nil
+	}
+	interval := time.Duration(h.LoggingIntervalMinutes) * time.Minute
+	samples := make([]TemperatureSample, 0, len(h.Table))
+	for i, t := range h.Table {
+		if t == nil {
+			continue
+		}
+		samples = append(samples, TemperatureSample{
+			Timestamp:   at.Add(-time.Duration(len(h.Table)-1-i) * interval),
+			Temperature: *t,
+		})
+	}
+	return samples
+}
+
+// ThermalLimits 一个设备类别的温度阈值（°C），达到 Warm 为 warm，达到 Critical 为 critical
+type ThermalLimits struct {
+	Warm     int `json:"warm" yaml:"warm"`
+	Critical int `json:"critical" yaml:"critical"`
+}
+
+// Classify 判定温度状态，0 表示没有温度读数，返回空
+func (l ThermalLimits) Classify(temperature int) string {
+	switch {
+	case temperature == 0:
+		return ""
+	case temperature >= l.Critical:
+		return ThermalCritical
+	case temperature >= l.Warm:
+		return ThermalWarm
+	default:
+		return ThermalOK
+	}
+}
+
+// ThermalPolicy 按设备类别的温度策略
+//
+// 设备默认按类型归入 hdd/ssd/nvme，Devices 可以把设备（设备标识、序列号或设备路径 glob）
+// 归入自定义类别，比如把装在通风差的硬盘柜里的硬盘单独设一个更低的阈值。
+// 设备标识和序列号优先于 glob，多个 glob 匹配同一设备时与桥接类型固定一样取最具体的一个。
+type ThermalPolicy struct {
+	Classes map[string]ThermalLimits `json:"classes" yaml:"classes"`
+	Devices map[string]string        `json:"devices" yaml:"devices"`
+
+	globs []string // 按具体程度排好序的 Devices 键，SetThermalPolicy 时计算
+}
+
+// DefaultThermalPolicy 默认温度策略
+func DefaultThermalPolicy() ThermalPolicy {
+	return ThermalPolicy{
+		Classes: map[string]ThermalLimits{
+			ThermalClassHDD:  {Warm: 45, Critical: 55},
+			ThermalClassSSD:  {Warm: 60, Critical: 70},
+			ThermalClassNVMe: {Warm: 70, Critical: 80},
+		},
+	}
+}
+
+// Class 返回设备所属的类别，类型未知时返回空
+func (p ThermalPolicy) Class(device Device) string {
+	for _, key := range []string{device.ID, device.Serial} {
+		if class, ok := p.Devices[key]; ok && key != "" {
+			return class
+		}
+	}
+	globs := p.globs
+	if globs == nil && len(p.Devices) > 0 {
+		globs = sortGlobs(p.Devices)
+	}
+	for _, pattern := range globs {
+		if ok, _ := filepath.Match(pattern, device.Name); ok {
+			return p.Devices[pattern]
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(device.Name)); ok {
+			return p.Devices[pattern]
+		}
+	}
+
+	switch device.DeviceType {
+	case "HDD":
+		return ThermalClassHDD
+	case "SSD":
+		return ThermalClassSSD
+	case "NVMe":
+		return ThermalClassNVMe
+	default:
+		return ""
+	}
+}
+
+// Limits 返回设备所属的类别和阈值
+func (p ThermalPolicy) Limits(device Device) (string, ThermalLimits, bool) {
+	class := p.Class(device)
+	limits, ok := p.Classes[class]
+	return class, limits, ok
+}
+
+// Apply 按策略判定快照的温度状态
+func (p ThermalPolicy) Apply(data *SMARTData) {
+	class, limits, ok := p.Limits(data.Device)
+	if !ok {
+		return
+	}
+	if data.Thermal == nil {
+		data.Thermal = &ThermalInfo{}
+	}
+	data.Thermal.Class = class
+	data.Thermal.Limits = &limits
+	data.Thermal.State = limits.Classify(data.Temperature)
+}
+
+// SetThermalPolicy 设置温度策略，每次读取 SMART 数据后判定温度状态
+func (d *DeviceDetector) SetThermalPolicy(policy ThermalPolicy) {
+	policy.globs = sortGlobs(policy.Devices)
+	d.thermal = &policy
+}
+
+// parseThermal 解析 temperature 块、NVMe 温度阈值和 SCT 温度历史
+func parseThermal(data *SMARTData, raw *smartctlOutput) {
+	t := raw.Temperature
+	info := &ThermalInfo{
+		PowerCycleMin:    t.PowerCycleMin,
+		PowerCycleMax:    t.PowerCycleMax,
+		LifetimeMin:      t.LifetimeMin,
+		LifetimeMax:      t.LifetimeMax,
+		OpLimitMin:       t.OpLimitMin,
+		OpLimitMax:       t.OpLimitMax,
+		LimitMin:         t.LimitMin,
+		LimitMax:         t.LimitMax,
+		CriticalLimitMax: t.CriticalLimitMax,
+		DriveTrip:        t.DriveTrip,
+	}
+
+	// 较早的 smartctl 把 NVMe 的 WCTEMP/CCTEMP 放在单独的字段中
+	if th := raw.NvmeCompositeTemperatureThreshold; th != nil {
+		if info.OpLimitMax == nil && th.Warning > 0 {
+			info.OpLimitMax = &th.Warning
+		}
+		if info.CriticalLimitMax == nil && th.Critical > 0 {
+			info.CriticalLimitMax = &th.Critical
+		}
+	}
+
+	if h := raw.AtaSctTemperatureHistory; h != nil && len(h.Table) > 0 {
+		info.History = &SCTTemperatureHistory{
+			SamplingPeriodMinutes:  h.SamplingPeriodMinutes,
+			LoggingIntervalMinutes: h.LoggingIntervalMinutes,
+			Table:                  h.Table,
+		}
+		// 温度历史中的推荐范围和极限比 temperature 块更常见
+		if info.OpLimitMin == nil {
+			info.OpLimitMin = h.Temperature.OpLimitMin
+		}
+		if info.OpLimitMax == nil {
+			info.OpLimitMax = h.Temperature.OpLimitMax
+		}
+		if info.LimitMin == nil {
+			info.LimitMin = h.Temperature.LimitMin
+		}
+		if info.LimitMax == nil {
+			info.LimitMax = h.Temperature.LimitMax
+		}
+	}
+
+	if *info != (ThermalInfo{}) {
+		data.Thermal = info
+	}
+}
@@ -0,0 +1,39 @@
+package smart
+
+import "testing"
+
+func TestThermalClassPrefersSpecificKeys(t *testing.T) {
+	policy := ThermalPolicy{Devices: map[string]string{
+		"sd*":       "wide",
+		"sd?":       "single",
+		"sda":       "exact",
+		"/dev/sd*":  "path",
+		"SERIAL123": "serial",
+		"ata-DISK1": "id",
+	}}
+	detector := NewDeviceDetectorWithRunner(hangingRunner{})
+	detector.SetThermalPolicy(policy)
+
+	tests := []struct {
+		device Device
+		want   string
+	}{
+		{Device{Name: "/dev/sda", Serial: "SERIAL123", ID: "ata-DISK1"}, "id"},
+		{Device{Name: "/dev/sda", Serial: "SERIAL123"}, "serial"},
+		{Device{Name: "/dev/sda"}, "exact"},
+		{Device{Name: "/dev/sdb"}, "path"},
+		{Device{Name: "/dev/sdaa"}, "path"},
+		{Device{Name: "sdb"}, "single"},
+		{Device{Name: "sdaa"}, "wide"},
+	}
+	// map 遍历顺序随机，多跑几次确认结果稳定
+	for i := 0; i < 20; i++ {
+		for _, p := range []ThermalPolicy{policy, *detector.thermal} {
+			for _, tt := range tests {
+				if got := p.Class(tt.device); got != tt.want {
+					t.Fatalf("Class(%+v) = %q, want %q", tt.device, got, tt.want)
+				}
+			}
+		}
+	}
+}
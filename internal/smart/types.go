@@ -4,35 +4,60 @@ import "time"
 
 // Device 表示一个存储设备
 type Device struct {
-	Name       string `json:"name"`        // 设备名称 /dev/sda
-	Model      string `json:"model"`       // 型号
-	Serial     string `json:"serial"`      // 序列号
-	DeviceType string `json:"device_type"` // HDD/SSD/NVMe
-	CapacityGB int64  `json:"capacity_gb"` // 容量(GB)
-	IsExternal bool   `json:"is_external"` // 是否为外置设备
+	ID         string `json:"id"`                    // 稳定的设备标识，存储和 API 以此为键，见 IdentityResolver
+	Host       string `json:"host,omitempty"`        // 所在主机，汇聚模式下区分各 agent 推送的设备
+	Name       string `json:"name"`                  // 设备名称 /dev/sda
+	Model      string `json:"model"`                 // 型号
+	Serial     string `json:"serial"`                // 序列号
+	Firmware   string `json:"firmware,omitempty"`    // 固件版本
+	WWN        string `json:"wwn,omitempty"`         // World Wide Name，如 0x5000c500a1b2c3d4
+	EUI64      string `json:"eui64,omitempty"`       // NVMe 命名空间 EUI-64
+	NGUID      string `json:"nguid,omitempty"`       // NVMe 命名空间 NGUID
+	DeviceType string `json:"device_type"`           // HDD/SSD/NVMe
+	CapacityGB int64  `json:"capacity_gb"`           // 容量(GB)
+	IsExternal bool   `json:"is_external"`           // 是否为外置设备
+	BridgeType string `json:"bridge_type,omitempty"` // 读取时使用的 -d 类型，auto 表示 smartctl 自动识别
+}
+
+// Key 返回存储使用的键：未设置标识解析器时退回序列号
+func (d Device) Key() string {
+	if d.ID != "" {
+		return d.ID
+	}
+	return d.Serial
 }
 
 // DeviceInfo 设备信息（用于API响应）
 type DeviceInfo struct {
 	Device
-	HasHistory   bool   `json:"has_history"`
-	Error        string `json:"error,omitempty"`        // 错误信息
-	ErrorMessage string `json:"error_message,omitempty"` // 用户友好的错误消息
+	HasHistory    bool         `json:"has_history"`
+	PowerState    string       `json:"power_state,omitempty"`    // active/standby
+	AsleepPercent *float64     `json:"asleep_percent,omitempty"` // 历史查询窗口内待机采样的占比
+	LastSeen      *time.Time   `json:"last_seen,omitempty"`      // 最近一次读到（汇聚模式下为收到）该设备数据的时间
+	AgeSeconds    *float64     `json:"age_seconds,omitempty"`    // LastSeen 距现在的秒数
+	Trend         *TrendReport `json:"trend,omitempty"`          // 最近一次读到的数据的趋势预测
+	Error         string       `json:"error,omitempty"`          // 错误信息
+	ErrorMessage  string       `json:"error_message,omitempty"`  // 用户友好的错误消息
 }
 
 // SMARTData 表示 SMART 数据快照
 type SMARTData struct {
-	Device              Device         `json:"device"`
-	Temperature         int            `json:"temperature"`          // 温度 °C
-	PowerOnHours        int64          `json:"power_on_hours"`       // 通电时间
-	PowerCycleCount     int64          `json:"power_cycle_count"`    // 通电次数
-	ReallocatedSectors  int64          `json:"reallocated_sectors"`  // 重映射扇区
-	PendingSectors      int64          `json:"pending_sectors"`      // 待映射扇区
-	UncorrectableErrors int64          `json:"uncorrectable_errors"` // 不可纠正错误
-	HealthPercent       int            `json:"health_percent"`       // 健康度百分比
-	SmartStatus         string         `json:"smart_status"`         // PASSED/FAILED
+	Device              Device           `json:"device"`
+	Temperature         int              `json:"temperature"`          // 温度 °C
+	Thermal             *ThermalInfo     `json:"thermal,omitempty"`    // 温度详情和温度状态
+	PowerOnHours        int64            `json:"power_on_hours"`       // 通电时间
+	PowerCycleCount     int64            `json:"power_cycle_count"`    // 通电次数
+	ReallocatedSectors  int64            `json:"reallocated_sectors"`  // 重映射扇区
+	PendingSectors      int64            `json:"pending_sectors"`      // 待映射扇区
+	UncorrectableErrors int64            `json:"uncorrectable_errors"` // 不可纠正错误
+	HealthPercent       int              `json:"health_percent"`       // 健康度百分比
+	Health              *HealthScore     `json:"health,omitempty"`     // 健康度评分的模型、等级和依据
+	SmartStatus         string           `json:"smart_status"`         // PASSED/FAILED
 	Attributes          []SMARTAttribute `json:"attributes"`           // 所有属性
-	Timestamp           time.Time      `json:"timestamp"`            // 数据采集时间
+	NVMe                *NVMeHealth      `json:"nvme,omitempty"`       // NVMe 健康日志（仅 NVMe 设备）
+	SelfTest            *SelfTestStatus  `json:"self_test,omitempty"`  // 自检状态和自检日志（ATA/NVMe）
+	Trend               *TrendReport     `json:"trend,omitempty"`      // 按历史增长率预测的剩余天数，没有历史时为空
+	Timestamp           time.Time        `json:"timestamp"`            // 数据采集时间
 }
 
 // SMARTAttribute 表示单个 SMART 属性
@@ -46,30 +71,155 @@ type SMARTAttribute struct {
 	WhenFailed string `json:"when_failed,omitempty"`
 }
 
+// NVMe Critical Warning 位定义（NVMe 规范 Log Page 02h, Byte 0）
+const (
+	NVMeWarnSpare          = 1 << 0 // 备用空间低于阈值
+	NVMeWarnTemperature    = 1 << 1 // 温度超出阈值
+	NVMeWarnReliability    = 1 << 2 // 介质或内部错误导致可靠性下降
+	NVMeWarnReadOnly       = 1 << 3 // 介质已进入只读模式
+	NVMeWarnVolatileBackup = 1 << 4 // 易失性存储备份失效
+	NVMeWarnPMRReadOnly    = 1 << 5 // 持久内存区域只读
+)
+
+// NVMeHealth NVMe SMART/Health Information 日志
+type NVMeHealth struct {
+	CriticalWarning         int   `json:"critical_warning"`          // 关键警告位图
+	AvailableSpare          int   `json:"available_spare"`           // 剩余备用空间 %
+	AvailableSpareThreshold int   `json:"available_spare_threshold"` // 备用空间告警阈值 %
+	PercentageUsed          int   `json:"percentage_used"`           // 寿命已用 %（可超过 100）
+	DataUnitsRead           int64 `json:"data_units_read"`           // 读取量，单位 1000×512 字节
+	DataUnitsWritten        int64 `json:"data_units_written"`        // 写入量，单位 1000×512 字节
+	HostReadCommands        int64 `json:"host_read_commands"`        // 主机读命令数
+	HostWriteCommands       int64 `json:"host_write_commands"`       // 主机写命令数
+	ControllerBusyTime      int64 `json:"controller_busy_time"`      // 控制器忙碌时间（分钟）
+	UnsafeShutdowns         int64 `json:"unsafe_shutdowns"`          // 异常断电次数
+	MediaErrors             int64 `json:"media_errors"`              // 介质和数据完整性错误
+	ErrorLogEntries         int64 `json:"error_log_entries"`         // 错误日志条目数
+	WarningTempTime         int64 `json:"warning_temp_time"`         // 复合温度超过警告阈值的时间（分钟）
+	CriticalCompTime        int64 `json:"critical_comp_time"`        // 复合温度超过临界阈值的时间（分钟）
+}
+
+// nvmeDataUnitBytes 一个 NVMe 数据单元的字节数
+const nvmeDataUnitBytes = 512 * 1000
+
+// BytesRead 累计读取字节数
+func (h *NVMeHealth) BytesRead() int64 {
+	return h.DataUnitsRead * nvmeDataUnitBytes
+}
+
+// BytesWritten 累计写入字节数
+func (h *NVMeHealth) BytesWritten() int64 {
+	return h.DataUnitsWritten * nvmeDataUnitBytes
+}
+
+// SpareBelowThreshold 备用空间是否已低于厂商阈值
+func (h *NVMeHealth) SpareBelowThreshold() bool {
+	return h.AvailableSpare < h.AvailableSpareThreshold
+}
+
+// Warnings 解码关键警告位
+func (h *NVMeHealth) Warnings() []string {
+	names := []struct {
+		bit  int
+		name string
+	}{
+		{NVMeWarnSpare, "available_spare"},
+		{NVMeWarnTemperature, "temperature"},
+		{NVMeWarnReliability, "reliability_degraded"},
+		{NVMeWarnReadOnly, "read_only"},
+		{NVMeWarnVolatileBackup, "volatile_backup_failed"},
+		{NVMeWarnPMRReadOnly, "pmr_read_only"},
+	}
+
+	var warnings []string
+	for _, n := range names {
+		if h.CriticalWarning&n.bit != 0 {
+			warnings = append(warnings, n.name)
+		}
+	}
+	return warnings
+}
+
+// TrendReport 设备的趋势预测：各指标的增长率和达到阈值的预计天数
+type TrendReport struct {
+	Metrics       []MetricTrend `json:"metrics"`
+	DaysRemaining *float64      `json:"days_remaining,omitempty"` // 最先达到阈值的指标的预计天数，都没有在增长时为空
+	Limiting      string        `json:"limiting,omitempty"`       // 最先达到阈值的指标
+	Confidence    float64       `json:"confidence"`               // 最先达到阈值的指标的置信度（0-1）
+	Since         time.Time     `json:"since"`                    // 拟合使用的历史起点
+}
+
+// MetricTrend 单个指标的增长趋势
+type MetricTrend struct {
+	Metric        string   `json:"metric"`                   // 与告警规则的指标名相同，如 reallocated_sectors
+	Current       float64  `json:"current"`                  // 当前值
+	RatePerDay    float64  `json:"rate_per_day"`             // 拟合的每天增长量
+	Threshold     float64  `json:"threshold"`                // 阈值
+	DaysRemaining *float64 `json:"days_remaining,omitempty"` // 按当前增长率达到阈值的预计天数，已达到为 0，没有增长时为空
+	Confidence    float64  `json:"confidence"`               // 0-1，综合拟合优度、样本数和历史跨度
+	Samples       int      `json:"samples"`                  // 参与拟合的样本数
+}
+
+// AttributeRecord 单个 SMART 属性在某次采集时的值
+type AttributeRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	SMARTAttribute
+}
+
 // HistoryRecord 表示历史记录中的一条数据
 type HistoryRecord struct {
-	Timestamp           time.Time `json:"timestamp"`
-	Temperature         int       `json:"temperature"`
-	PowerOnHours        int64     `json:"power_on_hours"`
-	PowerCycleCount     int64     `json:"power_cycle_count"`
-	ReallocatedSectors  int64     `json:"reallocated_sectors"`
-	PendingSectors      int64     `json:"pending_sectors"`
-	UncorrectableErrors int64     `json:"uncorrectable_errors"`
-	HealthPercent       int       `json:"health_percent"`
+	Timestamp           time.Time   `json:"timestamp"`
+	Temperature         int         `json:"temperature"`
+	PowerOnHours        int64       `json:"power_on_hours"`
+	PowerCycleCount     int64       `json:"power_cycle_count"`
+	ReallocatedSectors  int64       `json:"reallocated_sectors"`
+	PendingSectors      int64       `json:"pending_sectors"`
+	UncorrectableErrors int64       `json:"uncorrectable_errors"`
+	HealthPercent       int         `json:"health_percent"`
+	NVMe                *NVMeHealth `json:"nvme,omitempty"` // 仅 NVMe 设备
+
+	// 以下字段仅用于汇总数据（小时/天级），原始采样为空
+	Resolution string         `json:"resolution,omitempty"` // raw/hourly/daily
+	Samples    int            `json:"samples,omitempty"`    // 汇总的原始采样数
+	Min        *HistoryRecord `json:"min,omitempty"`        // 区间内各字段最小值
+	Max        *HistoryRecord `json:"max,omitempty"`        // 区间内各字段最大值
+	Avg        *HistoryRecord `json:"avg,omitempty"`        // 区间内各字段平均值（取整）
+	Last       *HistoryRecord `json:"last,omitempty"`       // 区间内各字段最后的值
+}
+
+// 采集时的电源状态
+const (
+	PowerStateActive  = "active"  // 设备处于活动或空闲状态，已读取
+	PowerStateStandby = "standby" // 设备处于待机，为避免唤醒跳过了读取
+)
+
+// PowerStats 一段时间内采集时的电源状态统计
+type PowerStats struct {
+	Samples       int     `json:"samples"`
+	Standby       int     `json:"standby"`
+	AsleepPercent float64 `json:"asleep_percent"` // 待机采样占比
 }
 
 // CollectorConfig 采集器配置
 type CollectorConfig struct {
-	Interval    time.Duration // 采集间隔
-	DataDir     string        // 数据存储目录
-	Enabled     bool          // 是否启用采集
+	Interval        time.Duration // 采集间隔
+	DataDir         string        // 数据存储目录
+	Enabled         bool          // 是否启用采集
+	Workers         int           // 并发采集的设备数
+	DeviceTimeout   time.Duration // 单个设备的采集超时
+	SkipStandby     bool          // 设备待机时跳过读取，不唤醒硬盘
+	MaxStandbySkips int           // 连续跳过多少次后强制读取一次，0 表示不强制
 }
 
 // DefaultCollectorConfig 默认采集器配置
 func DefaultCollectorConfig() *CollectorConfig {
 	return &CollectorConfig{
-		Interval: time.Hour,
-		DataDir:  "./data",
-		Enabled:  true,
+		Interval:        time.Hour,
+		DataDir:         "./data",
+		Enabled:         true,
+		Workers:         4,
+		DeviceTimeout:   2 * time.Minute,
+		SkipStandby:     true,
+		MaxStandbySkips: 24,
 	}
-}
\ No newline at end of file
+}
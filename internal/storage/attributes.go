@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// attributesDir 属性表存放在数据目录的子目录中，避免被 GetAllSerials 当作设备
+const attributesDir = "attributes"
+
+// attributeHeader 属性表 CSV 头部（长表：每次采集每个属性一行）
+var attributeHeader = []string{
+	"timestamp",
+	"id",
+	"name",
+	"value",
+	"worst",
+	"threshold",
+	"raw_value",
+	"when_failed",
+}
+
+// attributeFile 返回设备属性表文件路径
+func (s *CSVStorage) attributeFile(serial string) string {
+	if serial == "" {
+		serial = "unknown"
+	}
+	return filepath.Join(s.dataDir, attributesDir, fmt.Sprintf("%s.csv", serial))
+}
+
+// SaveAttributes 实现 Storage 接口
+func (s *CSVStorage) SaveAttributes(serial string, timestamp time.Time, attrs []smart.SMARTAttribute) error {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filename := s.attributeFile(serial)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("create attributes dir: %w", err)
+	}
+
+	ts := timestamp.Format(time.RFC3339)
+	rows := make([][]string, 0, len(attrs))
+	for _, attr := range attrs {
+		row := []string{
+			ts,
+			strconv.Itoa(attr.ID),
+			attr.Name,
+			strconv.Itoa(attr.Value),
+			strconv.Itoa(attr.Worst),
+			strconv.Itoa(attr.Threshold),
+			strconv.FormatInt(attr.RawValue, 10),
+			attr.WhenFailed,
+		}
+		rows = append(rows, row)
+	}
+
+	if err := appendCSV(filename, [][]string{attributeHeader}, rows); err != nil {
+		return fmt.Errorf("write attributes: %w", err)
+	}
+	return nil
+}
+
+// GetAttributeHistory 实现 Storage 接口
+func (s *CSVStorage) GetAttributeHistory(serial string, id int, from, to time.Time) ([]smart.AttributeRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAttributes(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []smart.AttributeRecord{}
+	for _, r := range all {
+		if r.ID != id {
+			continue
+		}
+		// 时间过滤
+		if !from.IsZero() && r.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && r.Timestamp.After(to) {
+			continue
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
+}
+
+// readAttributes 读取设备的全部属性表（调用方持有锁）
+func (s *CSVStorage) readAttributes(serial string) ([]smart.AttributeRecord, error) {
+	rows, _, err := readCSV(s.attributeFile(serial))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read attributes: %w", err)
+	}
+
+	var records []smart.AttributeRecord
+	for i, row := range rows {
+		if i == 0 || len(row) < len(attributeHeader) {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, row[0])
+		if err != nil {
+			continue
+		}
+		id, err := strconv.Atoi(row[1])
+		if err != nil {
+			continue
+		}
+		value, _ := strconv.Atoi(row[3])
+		worst, _ := strconv.Atoi(row[4])
+		threshold, _ := strconv.Atoi(row[5])
+		raw, _ := strconv.ParseInt(row[6], 10, 64)
+
+		records = append(records, smart.AttributeRecord{
+			Timestamp: timestamp,
+			SMARTAttribute: smart.SMARTAttribute{
+				ID:         id,
+				Name:       row[2],
+				Value:      value,
+				Worst:      worst,
+				Threshold:  threshold,
+				RawValue:   raw,
+				WhenFailed: row[7],
+			},
+		})
+	}
+	return records, nil
+}
+
+// thinAttributes 早于 cutoff 的属性表每天只保留最后一次采集（调用方持有锁）
+func (s *CSVStorage) thinAttributes(serial string, cutoff time.Time) error {
+	filename := s.attributeFile(serial)
+	rows, _, err := readCSV(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read attributes: %w", err)
+	}
+	if len(rows) < 2 {
+		return nil
+	}
+
+	// 找出每天最后一次采集的时间
+	lastOfDay := make(map[string]time.Time) // 日期 -> 最后采集时间
+	for _, row := range rows[1:] {
+		ts, err := time.Parse(time.RFC3339, row[0])
+		if err != nil || !ts.Before(cutoff) {
+			continue
+		}
+		day := ts.Format("2006-01-02")
+		if prev, ok := lastOfDay[day]; !ok || ts.After(prev) {
+			lastOfDay[day] = ts
+		}
+	}
+
+	kept := [][]string{rows[0]}
+	for _, row := range rows[1:] {
+		ts, err := time.Parse(time.RFC3339, row[0])
+		if err == nil && ts.Before(cutoff) && !lastOfDay[ts.Format("2006-01-02")].Equal(ts) {
+			continue
+		}
+		kept = append(kept, row)
+	}
+	if len(kept) == len(rows) {
+		return nil
+	}
+
+	if err := writeCSVAtomic(filename, kept); err != nil {
+		return fmt.Errorf("write attributes: %w", err)
+	}
+	return nil
+}
@@ -1,11 +1,12 @@
 package storage
 
 import (
-	"encoding/csv"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 // CSVStorage CSV 文件存储实现
 type CSVStorage struct {
 	dataDir string
+	policy  RetentionPolicy
 	mu      sync.Mutex
 }
 
@@ -26,9 +28,17 @@ func NewCSVStorage(dataDir string) (*CSVStorage, error) {
 
 	return &CSVStorage{
 		dataDir: dataDir,
+		policy:  DefaultRetentionPolicy(),
 	}, nil
 }
 
+// SetRetentionPolicy 设置保留策略（同时决定 GetHistory 使用的分辨率）
+func (s *CSVStorage) SetRetentionPolicy(policy RetentionPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
 // SaveRecord 实现 Storage 接口
 func (s *CSVStorage) SaveRecord(serial string, data *smart.SMARTData) error {
 	s.mu.Lock()
@@ -38,60 +48,32 @@ func (s *CSVStorage) SaveRecord(serial string, data *smart.SMARTData) error {
 		serial = "unknown"
 	}
 
-	filename := filepath.Join(s.dataDir, fmt.Sprintf("%s.csv", serial))
-
-	// 检查文件是否存在，不存在则创建并写入头部
-	needHeader := false
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		needHeader = true
-	}
-
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("open file: %w", err)
+	filename := s.rawFile(serial)
+	version, header, err := readRawHead(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read header: %w", err)
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// 写入头部
-	if needHeader {
-		header := []string{
-			"timestamp",
-			"temperature",
-			"power_on_hours",
-			"power_cycle_count",
-			"reallocated_sectors",
-			"pending_sectors",
-			"uncorrectable_errors",
-			"health_percent",
-		}
-		if err := writer.Write(header); err != nil {
-			return fmt.Errorf("write header: %w", err)
+	if header != nil && needsUpgrade(version, header) {
+		if err := s.upgradeRaw(serial); err != nil {
+			return err
 		}
+		version, header = rawSchemaVersion, rawHeader()
 	}
-
-	// 写入数据行
-	record := []string{
-		data.Timestamp.Format(time.RFC3339),
-		strconv.Itoa(data.Temperature),
-		strconv.FormatInt(data.PowerOnHours, 10),
-		strconv.FormatInt(data.PowerCycleCount, 10),
-		strconv.FormatInt(data.ReallocatedSectors, 10),
-		strconv.FormatInt(data.PendingSectors, 10),
-		strconv.FormatInt(data.UncorrectableErrors, 10),
-		strconv.Itoa(data.HealthPercent),
+	if header == nil {
+		version, header = rawSchemaVersion, rawHeader()
 	}
 
-	if err := writer.Write(record); err != nil {
+	// 按文件头部的列写入数据行
+	rec := historyRecordOf(data)
+	columns, _ := rawColumns(version, header)
+	if err := appendCSV(filename, rawHead(), [][]string{formatRaw(&rec, columns)}); err != nil {
 		return fmt.Errorf("write record: %w", err)
 	}
 
 	return nil
 }
 
-// GetHistory 实现 Storage 接口
+// GetHistory 实现 Storage 接口，按时间范围自动选择原始、小时或天级分辨率
 func (s *CSVStorage) GetHistory(serial string, from, to time.Time) ([]smart.HistoryRecord, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -100,67 +82,64 @@ func (s *CSVStorage) GetHistory(serial string, from, to time.Time) ([]smart.Hist
 		serial = "unknown"
 	}
 
-	filename := filepath.Join(s.dataDir, fmt.Sprintf("%s.csv", serial))
+	var oldest time.Time
+	if from.IsZero() {
+		var err error
+		if oldest, err = s.oldestAggregate(serial); err != nil {
+			return nil, err
+		}
+	}
+	resolution := s.policy.resolutionFor(from, oldest, time.Now())
+	if resolution == ResolutionRaw {
+		records, err := s.readRaw(serial, from, to)
+		for i := range records {
+			records[i].Resolution = ResolutionRaw
+		}
+		return records, err
+	}
+	return s.readAggregated(serial, resolution, from, to)
+}
 
-	file, err := os.Open(filename)
+// rawFile 返回设备原始采样文件路径
+func (s *CSVStorage) rawFile(serial string) string {
+	return filepath.Join(s.dataDir, fmt.Sprintf("%s.csv", serial))
+}
+
+// readRaw 读取原始采样（调用方持有锁）
+func (s *CSVStorage) readRaw(serial string, from, to time.Time) ([]smart.HistoryRecord, error) {
+	filename := s.rawFile(serial)
+
+	content, err := os.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []smart.HistoryRecord{}, nil
 		}
-		return nil, fmt.Errorf("open file: %w", err)
+		return nil, fmt.Errorf("read file: %w", err)
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
 
-	// 跳过头部
-	if _, err := reader.Read(); err != nil {
-		return nil, fmt.Errorf("read header: %w", err)
+	// 写入中断留下的半行和损坏的行跳过，不影响其余记录
+	rows, _, _ := parseCSV(content)
+	if len(rows) == 0 {
+		return []smart.HistoryRecord{}, nil
 	}
+	columns, minLen := rawColumns(schemaVersion(content), rows[0])
 
 	var records []smart.HistoryRecord
-
-	for {
-		row, err := reader.Read()
-		if err != nil {
-			break
-		}
-
-		if len(row) < 8 {
-			continue
-		}
-
-		timestamp, err := time.Parse(time.RFC3339, row[0])
-		if err != nil {
+	for _, row := range rows[1:] {
+		rec, ok := parseRaw(row, columns, minLen)
+		if !ok {
 			continue
 		}
 
 		// 时间过滤
-		if !from.IsZero() && timestamp.Before(from) {
+		if !from.IsZero() && rec.Timestamp.Before(from) {
 			continue
 		}
-		if !to.IsZero() && timestamp.After(to) {
+		if !to.IsZero() && rec.Timestamp.After(to) {
 			continue
 		}
 
-		temp, _ := strconv.Atoi(row[1])
-		powerOnHours, _ := strconv.ParseInt(row[2], 10, 64)
-		powerCycleCount, _ := strconv.ParseInt(row[3], 10, 64)
-		reallocated, _ := strconv.ParseInt(row[4], 10, 64)
-		pending, _ := strconv.ParseInt(row[5], 10, 64)
-		uncorrectable, _ := strconv.ParseInt(row[6], 10, 64)
-		health, _ := strconv.Atoi(row[7])
-
-		records = append(records, smart.HistoryRecord{
-			Timestamp:           timestamp,
-			Temperature:         temp,
-			PowerOnHours:        powerOnHours,
-			PowerCycleCount:     powerCycleCount,
-			ReallocatedSectors:  reallocated,
-			PendingSectors:      pending,
-			UncorrectableErrors: uncorrectable,
-			HealthPercent:       health,
-		})
+		records = append(records, rec)
 	}
 
 	return records, nil
@@ -171,6 +150,11 @@ func (s *CSVStorage) GetAllSerials() ([]string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.listSerials()
+}
+
+// listSerials 列出数据目录中的设备（调用方持有锁）
+func (s *CSVStorage) listSerials() ([]string, error) {
 	entries, err := os.ReadDir(s.dataDir)
 	if err != nil {
 		return nil, fmt.Errorf("read dir: %w", err)
@@ -191,28 +175,20 @@ func (s *CSVStorage) GetAllSerials() ([]string, error) {
 	return serials, nil
 }
 
-// CleanOldRecords 实现 Storage 接口
+// CleanOldRecords 实现 Storage 接口，直接删除 days 天前的原始采样（不做汇总）
 func (s *CSVStorage) CleanOldRecords(days int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	cutoff := time.Now().AddDate(0, 0, -days)
 
-	serials, err := s.GetAllSerials()
+	serials, err := s.listSerials()
 	if err != nil {
 		return err
 	}
 
 	for _, serial := range serials {
-		filename := filepath.Join(s.dataDir, fmt.Sprintf("%s.csv", serial))
-
-		records, err := s.GetHistory(serial, cutoff, time.Time{})
-		if err != nil {
-			continue
-		}
-
-		// 重写文件，只保留新记录
-		if err := s.rewriteFile(filename, records); err != nil {
+		if err := s.filterRaw(serial, cutoff); err != nil {
 			return err
 		}
 	}
@@ -220,48 +196,86 @@ func (s *CSVStorage) CleanOldRecords(days int) error {
 	return nil
 }
 
-// rewriteFile 重写文件（内部方法）
-func (s *CSVStorage) rewriteFile(filename string, records []smart.HistoryRecord) error {
-	file, err := os.Create(filename)
+// filterRaw 删除原始采样文件中 cutoff 之前的行（调用方持有锁）
+//
+// 版本行、头部和保留的行原样写回，更新版本写入的文件不会丢掉不认识的列或降低版本；
+// 只有 upgradeRaw 按当前头部重写。写入中断的半行和无效的行一并丢弃，没有要删除的行时不重写。
+func (s *CSVStorage) filterRaw(serial string, cutoff time.Time) error {
+	filename := s.rawFile(serial)
+	content, err := os.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("create file: %w", err)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read file: %w", err)
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// 写入头部
-	header := []string{
-		"timestamp",
-		"temperature",
-		"power_on_hours",
-		"power_cycle_count",
-		"reallocated_sectors",
-		"pending_sectors",
-		"uncorrectable_errors",
-		"health_percent",
+
+	rows, partial, malformed := parseCSV(content)
+	if len(rows) == 0 {
+		return nil
 	}
-	if err := writer.Write(header); err != nil {
-		return err
+	head := rows[:1]
+	if line, _, _ := bytes.Cut(content, []byte("\n")); bytes.HasPrefix(line, []byte("#")) {
+		head = [][]string{{strings.TrimSpace(string(line))}, rows[0]}
+	}
+	columns, minLen := rawColumns(schemaVersion(content), rows[0])
+
+	kept := append([][]string(nil), head...)
+	dropped := partial || malformed > 0
+	for _, row := range rows[1:] {
+		rec, ok := parseRaw(row, columns, minLen)
+		if !ok || rec.Timestamp.Before(cutoff) {
+			dropped = true
+			continue
+		}
+		kept = append(kept, row)
+	}
+	if !dropped {
+		return nil
+	}
+	if err := writeCSVAtomic(filename, kept); err != nil {
+		return fmt.Errorf("rewrite %s: %w", filename, err)
+	}
+	return nil
+}
+
+// rewriteFile 按当前版本的头部原子地重写文件，只用于升级旧格式的文件（内部方法）
+func (s *CSVStorage) rewriteFile(filename string, records []smart.HistoryRecord) error {
+	rows := rawHead()
+	header := rawHeader()
+	for i := range records {
+		rows = append(rows, formatRaw(&records[i], header))
+	}
+
+	return writeCSVAtomic(filename, rows)
+}
+
+// RenameDevice 实现 Storage 接口
+func (s *CSVStorage) RenameDevice(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := [][2]string{
+		{s.rawFile(from), s.rawFile(to)},
+		{s.aggregateFile(from, ResolutionHourly), s.aggregateFile(to, ResolutionHourly)},
+		{s.aggregateFile(from, ResolutionDaily), s.aggregateFile(to, ResolutionDaily)},
+		{s.attributeFile(from), s.attributeFile(to)},
+		{s.powerFile(from), s.powerFile(to)},
 	}
 
-	// 写入记录
-	for _, rec := range records {
-		row := []string{
-			rec.Timestamp.Format(time.RFC3339),
-			strconv.Itoa(rec.Temperature),
-			strconv.FormatInt(rec.PowerOnHours, 10),
-			strconv.FormatInt(rec.PowerCycleCount, 10),
-			strconv.FormatInt(rec.ReallocatedSectors, 10),
-			strconv.FormatInt(rec.PendingSectors, 10),
-			strconv.FormatInt(rec.UncorrectableErrors, 10),
-			strconv.Itoa(rec.HealthPercent),
+	// 逐个文件迁移，一个失败不影响其他文件
+	var errs []error
+	for _, f := range files {
+		if _, err := os.Stat(f[0]); os.IsNotExist(err) {
+			continue
 		}
-		if err := writer.Write(row); err != nil {
-			return err
+		if _, err := os.Stat(f[1]); err == nil {
+			errs = append(errs, fmt.Errorf("rename %s: %s already exists", f[0], f[1]))
+			continue
+		}
+		if err := os.Rename(f[0], f[1]); err != nil {
+			errs = append(errs, fmt.Errorf("rename %s: %w", f[0], err))
 		}
 	}
-
-	return nil
-}
\ No newline at end of file
+	return errors.Join(errs...)
+}
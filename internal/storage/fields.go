@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"math"
+
+	"smart-cat/internal/smart"
+)
+
+// historyField 历史记录中的一个数值字段，汇总时按字段计算 min/max/avg/last
+type historyField struct {
+	name  string
+	gauge bool // 温度、健康度这类瞬时量，汇总的主值取平均；其余为累计计数，取最后的值
+	get   func(r *smart.HistoryRecord) (float64, bool)
+	set   func(r *smart.HistoryRecord, v float64)
+}
+
+// intField 基础字段（所有设备都有）
+func intField(name string, gauge bool, ptr func(r *smart.HistoryRecord) *int) historyField {
+	return historyField{
+		name:  name,
+		gauge: gauge,
+		get:   func(r *smart.HistoryRecord) (float64, bool) { return float64(*ptr(r)), true },
+		set:   func(r *smart.HistoryRecord, v float64) { *ptr(r) = int(math.Round(v)) },
+	}
+}
+
+// int64Field 基础字段（所有设备都有）
+func int64Field(name string, ptr func(r *smart.HistoryRecord) *int64) historyField {
+	return historyField{
+		name: name,
+		get:  func(r *smart.HistoryRecord) (float64, bool) { return float64(*ptr(r)), true },
+		set:  func(r *smart.HistoryRecord, v float64) { *ptr(r) = int64(math.Round(v)) },
+	}
+}
+
+// nvmeIntField 只有 NVMe 设备才有的字段
+func nvmeIntField(name string, gauge bool, ptr func(h *smart.NVMeHealth) *int) historyField {
+	return historyField{
+		name:  name,
+		gauge: gauge,
+		get: func(r *smart.HistoryRecord) (float64, bool) {
+			if r.NVMe == nil {
+				return 0, false
+			}
+			return float64(*ptr(r.NVMe)), true
+		},
+		set: func(r *smart.HistoryRecord, v float64) { *ptr(ensureNVMe(r)) = int(math.Round(v)) },
+	}
+}
+
+// nvmeInt64Field 只有 NVMe 设备才有的累计计数
+func nvmeInt64Field(name string, ptr func(h *smart.NVMeHealth) *int64) historyField {
+	return historyField{
+		name: name,
+		get: func(r *smart.HistoryRecord) (float64, bool) {
+			if r.NVMe == nil {
+				return 0, false
+			}
+			return float64(*ptr(r.NVMe)), true
+		},
+		set: func(r *smart.HistoryRecord, v float64) { *ptr(ensureNVMe(r)) = int64(math.Round(v)) },
+	}
+}
+
+func ensureNVMe(r *smart.HistoryRecord) *smart.NVMeHealth {
+	if r.NVMe == nil {
+		r.NVMe = &smart.NVMeHealth{}
+	}
+	return r.NVMe
+}
+
+// historyFields 历史记录的数值字段，顺序与原始 CSV 列一致
+var historyFields = []historyField{
+	intField("temperature", true, func(r *smart.HistoryRecord) *int { return &r.Temperature }),
+	int64Field("power_on_hours", func(r *smart.HistoryRecord) *int64 { return &r.PowerOnHours }),
+	int64Field("power_cycle_count", func(r *smart.HistoryRecord) *int64 { return &r.PowerCycleCount }),
+	int64Field("reallocated_sectors", func(r *smart.HistoryRecord) *int64 { return &r.ReallocatedSectors }),
+	int64Field("pending_sectors", func(r *smart.HistoryRecord) *int64 { return &r.PendingSectors }),
+	int64Field("uncorrectable_errors", func(r *smart.HistoryRecord) *int64 { return &r.UncorrectableErrors }),
+	intField("health_percent", true, func(r *smart.HistoryRecord) *int { return &r.HealthPercent }),
+	nvmeIntField("nvme_critical_warning", false, func(h *smart.NVMeHealth) *int { return &h.CriticalWarning }),
+	nvmeIntField("nvme_available_spare", true, func(h *smart.NVMeHealth) *int { return &h.AvailableSpare }),
+	nvmeIntField("nvme_available_spare_threshold", false, func(h *smart.NVMeHealth) *int { return &h.AvailableSpareThreshold }),
+	nvmeIntField("nvme_percentage_used", false, func(h *smart.NVMeHealth) *int { return &h.PercentageUsed }),
+	nvmeInt64Field("nvme_data_units_read", func(h *smart.NVMeHealth) *int64 { return &h.DataUnitsRead }),
+	nvmeInt64Field("nvme_data_units_written", func(h *smart.NVMeHealth) *int64 { return &h.DataUnitsWritten }),
+	nvmeInt64Field("nvme_host_read_commands", func(h *smart.NVMeHealth) *int64 { return &h.HostReadCommands }),
+	nvmeInt64Field("nvme_host_write_commands", func(h *smart.NVMeHealth) *int64 { return &h.HostWriteCommands }),
+	nvmeInt64Field("nvme_controller_busy_time", func(h *smart.NVMeHealth) *int64 { return &h.ControllerBusyTime }),
+	nvmeInt64Field("nvme_unsafe_shutdowns", func(h *smart.NVMeHealth) *int64 { return &h.UnsafeShutdowns }),
+	nvmeInt64Field("nvme_media_errors", func(h *smart.NVMeHealth) *int64 { return &h.MediaErrors }),
+	nvmeInt64Field("nvme_error_log_entries", func(h *smart.NVMeHealth) *int64 { return &h.ErrorLogEntries }),
+	nvmeInt64Field("nvme_warning_temp_time", func(h *smart.NVMeHealth) *int64 { return &h.WarningTempTime }),
+	nvmeInt64Field("nvme_critical_comp_time", func(h *smart.NVMeHealth) *int64 { return &h.CriticalCompTime }),
+}
+
+// historyFieldIndex 字段名 -> historyFields 中的下标，按 CSV 头部的列名查找字段
+var historyFieldIndex = func() map[string]int {
+	index := make(map[string]int, len(historyFields))
+	for i, f := range historyFields {
+		index[f.name] = i
+	}
+	return index
+}()
+
+// historyRecordOf 取出快照中与历史记录相同的字段
+func historyRecordOf(data *smart.SMARTData) smart.HistoryRecord {
+	return smart.HistoryRecord{
+		Timestamp:           data.Timestamp,
+		Temperature:         data.Temperature,
+		PowerOnHours:        data.PowerOnHours,
+		PowerCycleCount:     data.PowerCycleCount,
+		ReallocatedSectors:  data.ReallocatedSectors,
+		PendingSectors:      data.PendingSectors,
+		UncorrectableErrors: data.UncorrectableErrors,
+		HealthPercent:       data.HealthPercent,
+		NVMe:                data.NVMe,
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// tmpSuffix 原子重写时的临时文件后缀，重命名前崩溃会留下这个文件，原文件不受影响
+const tmpSuffix = ".tmp"
+
+// readCSV 读取 CSV 文件的全部行（含头部）
+//
+// 没有以换行结尾的最后一行是写入中断留下的半行，丢弃；无法解析的行跳过，不影响后面的行。
+// 返回丢弃和跳过的行数。文件不存在时返回的错误满足 os.IsNotExist。
+func readCSV(filename string) ([][]string, int, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, partial, malformed := parseCSV(content)
+	if partial {
+		malformed++
+	}
+	return rows, malformed, nil
+}
+
+// parseCSV 解析文件内容，返回完整的行、最后一行是否写入中断和无法解析的行数
+func parseCSV(content []byte) (rows [][]string, partial bool, malformed int) {
+	if n := len(content); n > 0 && content[n-1] != '\n' {
+		content = content[:bytes.LastIndexByte(content, '\n')+1]
+		partial = true
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#' // 版本行
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 内容已经全部在内存中，只会是 *csv.ParseError
+			malformed++
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, partial, malformed
+}
+
+// appendCSV 追加行并 fsync，文件不存在或为空时先写入 head（头部，可以带版本行）
+//
+// 上一次追加中断留下的半行没有换行结尾，先把文件截断到最后一个换行，丢掉半行，
+// 新的行从完整的一行之后开始写，半行不会和新的行拼在一起，也不会变成文件中间的一行。
+// 所有内容一次写入，尽量缩小中断的窗口。
+func appendCSV(filename string, head [][]string, rows [][]string) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file: %w", err)
+	}
+
+	size := info.Size()
+	if size > 0 {
+		end, err := completeLength(file, size)
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+		if end < size {
+			if err := file.Truncate(end); err != nil {
+				return fmt.Errorf("truncate partial line: %w", err)
+			}
+			size = end
+		}
+	}
+	if size == 0 {
+		rows = append(head, rows...)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("format rows: %w", err)
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
+	return file.Close()
+}
+
+// completeLength 返回文件中以换行结尾的完整内容的长度，从末尾向前查找最后一个换行
+func completeLength(file *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// writeCSVAtomic 把全部行写入临时文件，fsync 后重命名覆盖原文件
+//
+// 任何一步失败或中途崩溃，原文件都保持完整。调用方持有锁，临时文件名固定。
+func writeCSVAtomic(filename string, rows [][]string) error {
+	tmp := filename + tmpSuffix
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	writer := csv.NewWriter(file)
+	err = writer.WriteAll(rows)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
+	syncDir(filepath.Dir(filename))
+	return nil
+}
+
+// syncDir fsync 目录，让重命名本身落盘；不支持的平台（Windows）忽略错误
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -1,11 +1,13 @@
 package storage
 
 import (
-	"time"
 	"smart-cat/internal/smart"
+	"time"
 )
 
 // Storage 存储接口
+//
+// 参数 serial 是设备的存储键：设置了标识解析器时为 Device.ID，否则为序列号。
 type Storage interface {
 	// SaveRecord 保存一条 SMART 数据记录
 	SaveRecord(serial string, data *smart.SMARTData) error
@@ -13,9 +15,27 @@ type Storage interface {
 	// GetHistory 获取指定设备的历史记录
 	GetHistory(serial string, from, to time.Time) ([]smart.HistoryRecord, error)
 
+	// SaveAttributes 保存一次采集的完整 SMART 属性表
+	SaveAttributes(serial string, timestamp time.Time, attrs []smart.SMARTAttribute) error
+
+	// GetAttributeHistory 获取指定设备单个属性的时间序列
+	GetAttributeHistory(serial string, id int, from, to time.Time) ([]smart.AttributeRecord, error)
+
+	// SavePowerState 记录一次采集时设备的电源状态（active 或因待机跳过的 standby）
+	SavePowerState(serial string, timestamp time.Time, state string) error
+
+	// GetPowerStats 统计时间范围内的电源状态采样
+	GetPowerStats(serial string, from, to time.Time) (smart.PowerStats, error)
+
 	// GetAllSerials 获取所有已记录的设备序列号
 	GetAllSerials() ([]string, error)
 
+	// RenameDevice 把设备的全部数据从一个键改到另一个键下（迁移以序列号命名的旧数据）
+	RenameDevice(from, to string) error
+
 	// CleanOldRecords 清理旧记录
 	CleanOldRecords(days int) error
-}
\ No newline at end of file
+
+	// ApplyRetention 按保留策略把过期原始采样汇总为小时/天级数据，并删除超期数据
+	ApplyRetention() error
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportStats ImportCSV 导入的数据量
+type ImportStats struct {
+	Devices     int `json:"devices"`
+	Records     int `json:"records"`      // 原始采样
+	Aggregates  int `json:"aggregates"`   // 小时和天汇总
+	Attributes  int `json:"attributes"`   // 属性表的行数
+	PowerStates int `json:"power_states"` // 电源状态采样
+}
+
+// ImportCSV 把 CSV 存储中的全部数据（原始采样、小时/天汇总、属性表、电源状态）导入 SQLite 存储
+//
+// 每个设备在一个事务中导入，同一时间的数据覆盖已有的值，可以重复执行。不修改也不删除 CSV 文件。
+func (s *SQLiteStorage) ImportCSV(src *CSVStorage) (ImportStats, error) {
+	var stats ImportStats
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	devices, err := src.allDevices()
+	if err != nil {
+		return stats, err
+	}
+
+	for _, device := range devices {
+		raw, err := src.readRaw(device, time.Time{}, time.Time{})
+		if err != nil {
+			return stats, fmt.Errorf("read %s: %w", device, err)
+		}
+		hourly, err := src.readAggregates(device, ResolutionHourly)
+		if err != nil {
+			return stats, fmt.Errorf("read %s hourly: %w", device, err)
+		}
+		daily, err := src.readAggregates(device, ResolutionDaily)
+		if err != nil {
+			return stats, fmt.Errorf("read %s daily: %w", device, err)
+		}
+		attrs, err := src.readAttributes(device)
+		if err != nil {
+			return stats, fmt.Errorf("read %s attributes: %w", device, err)
+		}
+		power, err := src.readPower(device)
+		if err != nil {
+			return stats, fmt.Errorf("read %s power states: %w", device, err)
+		}
+
+		err = s.withTx(func(tx *sql.Tx) error {
+			if err := s.insertRecords(tx, device, raw); err != nil {
+				return err
+			}
+			if err := s.insertAggregates(tx, device, ResolutionHourly, hourly); err != nil {
+				return err
+			}
+			if err := s.insertAggregates(tx, device, ResolutionDaily, daily); err != nil {
+				return err
+			}
+			if err := insertAttributes(tx, device, attrs); err != nil {
+				return err
+			}
+			for _, row := range power {
+				ts, err := time.Parse(time.RFC3339, row[0])
+				if err != nil {
+					continue
+				}
+				if err := insertPowerState(tx, device, ts, row[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("import %s: %w", device, err)
+		}
+
+		stats.Devices++
+		stats.Records += len(raw)
+		stats.Aggregates += len(hourly) + len(daily)
+		stats.Attributes += len(attrs)
+		stats.PowerStates += len(power)
+	}
+	return stats, nil
+}
+
+// allDevices 列出在任何一类文件中有数据的设备（调用方持有锁）
+func (s *CSVStorage) allDevices() ([]string, error) {
+	seen := make(map[string]bool)
+	for _, dir := range []string{"", ResolutionHourly, ResolutionDaily, attributesDir, powerDir} {
+		entries, err := os.ReadDir(filepath.Join(s.dataDir, dir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("read dir: %w", err)
+		}
+		for _, entry := range entries {
+			if device, ok := strings.CutSuffix(entry.Name(), ".csv"); ok && !entry.IsDir() {
+				seen[device] = true
+			}
+		}
+	}
+
+	devices := make([]string, 0, len(seen))
+	for device := range seen {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	return devices, nil
+}
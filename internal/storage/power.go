@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// powerDir 电源状态采样存放在数据目录的子目录中，每次采集（包括因待机跳过的）一行
+const powerDir = "power"
+
+// powerHeader 电源状态 CSV 头部
+var powerHeader = []string{"timestamp", "state"}
+
+// powerFile 返回设备电源状态文件路径
+func (s *CSVStorage) powerFile(serial string) string {
+	if serial == "" {
+		serial = "unknown"
+	}
+	return filepath.Join(s.dataDir, powerDir, fmt.Sprintf("%s.csv", serial))
+}
+
+// SavePowerState 实现 Storage 接口
+func (s *CSVStorage) SavePowerState(serial string, timestamp time.Time, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filename := s.powerFile(serial)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("create power dir: %w", err)
+	}
+
+	row := []string{timestamp.Format(time.RFC3339), state}
+	if err := appendCSV(filename, [][]string{powerHeader}, [][]string{row}); err != nil {
+		return fmt.Errorf("write power state: %w", err)
+	}
+	return nil
+}
+
+// GetPowerStats 实现 Storage 接口
+func (s *CSVStorage) GetPowerStats(serial string, from, to time.Time) (smart.PowerStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats smart.PowerStats
+	rows, err := s.readPower(serial)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, row := range rows {
+		ts, err := time.Parse(time.RFC3339, row[0])
+		if err != nil {
+			continue
+		}
+		if (!from.IsZero() && ts.Before(from)) || (!to.IsZero() && ts.After(to)) {
+			continue
+		}
+		stats.Samples++
+		if row[1] == smart.PowerStateStandby {
+			stats.Standby++
+		}
+	}
+	if stats.Samples > 0 {
+		stats.AsleepPercent = float64(stats.Standby) * 100 / float64(stats.Samples)
+	}
+	return stats, nil
+}
+
+// readPower 读取电源状态采样，不含头部（调用方持有锁）
+func (s *CSVStorage) readPower(serial string) ([][]string, error) {
+	rows, _, err := readCSV(s.powerFile(serial))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read power states: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// 列数不对的行是损坏的行，跳过
+	var valid [][]string
+	for _, row := range rows[1:] {
+		if len(row) == len(powerHeader) {
+			valid = append(valid, row)
+		}
+	}
+	return valid, nil
+}
+
+// trimPower 删除早于 cutoff 的电源状态采样（调用方持有锁）
+func (s *CSVStorage) trimPower(cutoff time.Time) error {
+	entries, err := os.ReadDir(filepath.Join(s.dataDir, powerDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read power dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		serial, ok := strings.CutSuffix(entry.Name(), ".csv")
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		rows, err := s.readPower(serial)
+		if err != nil {
+			return fmt.Errorf("retention %s power states: %w", serial, err)
+		}
+		kept := [][]string{powerHeader}
+		for _, row := range rows {
+			ts, err := time.Parse(time.RFC3339, row[0])
+			if err == nil && ts.Before(cutoff) {
+				continue
+			}
+			kept = append(kept, row)
+		}
+		if len(kept) == len(rows)+1 {
+			continue
+		}
+
+		if err := writeCSVAtomic(s.powerFile(serial), kept); err != nil {
+			return fmt.Errorf("write power states: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,465 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// 历史数据分辨率
+const (
+	ResolutionRaw    = "raw"    // 原始采样
+	ResolutionHourly = "hourly" // 每小时汇总
+	ResolutionDaily  = "daily"  // 每天汇总
+)
+
+// RetentionPolicy 历史数据保留策略
+//
+// 原始采样保留 RawDays 天，之后汇总为小时数据；小时数据保留 HourlyDays 天，
+// 之后汇总为天数据；天数据保留 DailyDays 天。天数都从当前时间往前算。
+type RetentionPolicy struct {
+	RawDays    int
+	HourlyDays int
+	DailyDays  int
+}
+
+// DefaultRetentionPolicy 默认保留策略：原始 30 天，小时 180 天，天 2 年
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		RawDays:    30,
+		HourlyDays: 180,
+		DailyDays:  730,
+	}
+}
+
+// resolutionFor 根据查询起点选择分辨率：起点还在原始数据范围内就返回原始采样
+//
+// from 为零时按 oldest（设备最早的汇总数据）选择，没有汇总数据时返回原始采样，
+// 不会因为没有指定起点就把最近的原始采样也按天汇总。
+func (p RetentionPolicy) resolutionFor(from, oldest, now time.Time) string {
+	if from.IsZero() {
+		from = oldest
+	}
+	switch {
+	case from.IsZero():
+		return ResolutionRaw
+	case !from.Before(now.AddDate(0, 0, -p.RawDays)):
+		return ResolutionRaw
+	case !from.Before(now.AddDate(0, 0, -p.HourlyDays)):
+		return ResolutionHourly
+	default:
+		return ResolutionDaily
+	}
+}
+
+// bucketStart 返回时间所在汇总区间的起点
+func bucketStart(t time.Time, resolution string) time.Time {
+	if resolution == ResolutionDaily {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(time.Hour)
+}
+
+// aggregate 一个时间区间内的汇总值，各切片按 historyFields 的顺序
+type aggregate struct {
+	start   time.Time
+	samples int
+	has     []bool // 该字段是否有值（非 NVMe 设备没有 nvme_* 字段）
+	count   []int  // 该字段有值的采样数
+	min     []float64
+	max     []float64
+	sum     []float64
+	last    []float64
+}
+
+func newAggregate(start time.Time) *aggregate {
+	n := len(historyFields)
+	return &aggregate{
+		start: start,
+		has:   make([]bool, n),
+		count: make([]int, n),
+		min:   make([]float64, n),
+		max:   make([]float64, n),
+		sum:   make([]float64, n),
+		last:  make([]float64, n),
+	}
+}
+
+// add 加入一条原始采样，记录需按时间顺序加入
+func (a *aggregate) add(rec *smart.HistoryRecord) {
+	a.samples++
+	for i, f := range historyFields {
+		v, ok := f.get(rec)
+		if !ok {
+			continue
+		}
+		a.addValue(i, v, v, v, v, 1)
+	}
+}
+
+// merge 合并另一个汇总，b 需晚于 a
+func (a *aggregate) merge(b *aggregate) {
+	a.samples += b.samples
+	for i := range historyFields {
+		if !b.has[i] {
+			continue
+		}
+		a.addValue(i, b.min[i], b.max[i], b.sum[i], b.last[i], b.count[i])
+	}
+}
+
+func (a *aggregate) addValue(i int, min, max, sum, last float64, count int) {
+	if !a.has[i] {
+		a.has[i] = true
+		a.min[i], a.max[i] = min, max
+	} else {
+		a.min[i] = math.Min(a.min[i], min)
+		a.max[i] = math.Max(a.max[i], max)
+	}
+	a.sum[i] += sum
+	a.count[i] += count
+	a.last[i] = last
+}
+
+// avg 返回字段平均值
+func (a *aggregate) avg(i int) float64 {
+	if a.count[i] == 0 {
+		return 0
+	}
+	return a.sum[i] / float64(a.count[i])
+}
+
+// record 转换为 API 使用的历史记录
+//
+// 主字段中温度、健康度这类量取平均值，累计计数取区间内最后的值；
+// Min/Max/Avg/Last 给出完整的汇总。
+func (a *aggregate) record(resolution string) smart.HistoryRecord {
+	rec := smart.HistoryRecord{
+		Timestamp:  a.start,
+		Resolution: resolution,
+		Samples:    a.samples,
+		Min:        &smart.HistoryRecord{Timestamp: a.start},
+		Max:        &smart.HistoryRecord{Timestamp: a.start},
+		Avg:        &smart.HistoryRecord{Timestamp: a.start},
+		Last:       &smart.HistoryRecord{Timestamp: a.start},
+	}
+	for i, f := range historyFields {
+		if !a.has[i] {
+			continue
+		}
+		avg := a.avg(i)
+		f.set(rec.Min, a.min[i])
+		f.set(rec.Max, a.max[i])
+		f.set(rec.Avg, avg)
+		f.set(rec.Last, a.last[i])
+		if f.gauge {
+			f.set(&rec, avg)
+		} else {
+			f.set(&rec, a.last[i])
+		}
+	}
+	return rec
+}
+
+// aggregateRecords 把按时间排序的原始采样汇总到区间
+func aggregateRecords(records []smart.HistoryRecord, resolution string) []*aggregate {
+	var aggs []*aggregate
+	for i := range records {
+		start := bucketStart(records[i].Timestamp, resolution)
+		if len(aggs) == 0 || !aggs[len(aggs)-1].start.Equal(start) {
+			aggs = append(aggs, newAggregate(start))
+		}
+		aggs[len(aggs)-1].add(&records[i])
+	}
+	return aggs
+}
+
+// rebucket 把较细的汇总按新的分辨率合并，同一区间的汇总合并为一个
+func rebucket(aggs []*aggregate, resolution string) []*aggregate {
+	sort.SliceStable(aggs, func(i, j int) bool {
+		return aggs[i].start.Before(aggs[j].start)
+	})
+
+	var merged []*aggregate
+	for _, a := range aggs {
+		start := bucketStart(a.start, resolution)
+		if len(merged) == 0 || !merged[len(merged)-1].start.Equal(start) {
+			merged = append(merged, newAggregate(start))
+		}
+		merged[len(merged)-1].merge(a)
+	}
+	return merged
+}
+
+// aggregateFile 返回汇总文件路径，如 data/hourly/<serial>.csv
+func (s *CSVStorage) aggregateFile(serial, resolution string) string {
+	return filepath.Join(s.dataDir, resolution, fmt.Sprintf("%s.csv", serial))
+}
+
+// aggregateHeader 汇总文件头部：timestamp,samples,<字段>_min,<字段>_max,<字段>_avg,<字段>_last...
+func aggregateHeader() []string {
+	header := []string{"timestamp", "samples"}
+	for _, f := range historyFields {
+		header = append(header, f.name+"_min", f.name+"_max", f.name+"_avg", f.name+"_last")
+	}
+	return header
+}
+
+// readAggregates 读取汇总文件（调用方持有锁）
+func (s *CSVStorage) readAggregates(serial, resolution string) ([]*aggregate, error) {
+	rows, _, err := readCSV(s.aggregateFile(serial, resolution))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+
+	var aggs []*aggregate
+	for _, row := range rows[1:] {
+		if len(row) < 2 {
+			continue
+		}
+
+		start, err := time.Parse(time.RFC3339, row[0])
+		if err != nil {
+			continue
+		}
+		a := newAggregate(start)
+		a.samples, _ = strconv.Atoi(row[1])
+
+		for i, f := range historyFields {
+			col, ok := columns[f.name+"_min"]
+			if !ok || col+3 >= len(row) || row[col] == "" {
+				continue
+			}
+			// 文件中只有总采样数，按该字段每次都有值处理
+			a.has[i] = true
+			a.count[i] = a.samples
+			a.min[i], _ = strconv.ParseFloat(row[col], 64)
+			a.max[i], _ = strconv.ParseFloat(row[col+1], 64)
+			avg, _ := strconv.ParseFloat(row[col+2], 64)
+			a.sum[i] = avg * float64(a.samples)
+			a.last[i], _ = strconv.ParseFloat(row[col+3], 64)
+		}
+		aggs = append(aggs, a)
+	}
+
+	return aggs, nil
+}
+
+// writeAggregates 重写汇总文件，没有数据时删除文件（调用方持有锁）
+func (s *CSVStorage) writeAggregates(serial, resolution string, aggs []*aggregate) error {
+	filename := s.aggregateFile(serial, resolution)
+	if len(aggs) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", filename, err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("create %s dir: %w", resolution, err)
+	}
+
+	rows := [][]string{aggregateHeader()}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, a := range aggs {
+		row := []string{a.start.Format(time.RFC3339), strconv.Itoa(a.samples)}
+		for i := range historyFields {
+			if !a.has[i] {
+				row = append(row, "", "", "", "")
+				continue
+			}
+			row = append(row, format(a.min[i]), format(a.max[i]), format(a.avg(i)), format(a.last[i]))
+		}
+		rows = append(rows, row)
+	}
+
+	if err := writeCSVAtomic(filename, rows); err != nil {
+		return fmt.Errorf("write %s records: %w", resolution, err)
+	}
+	return nil
+}
+
+// readAggregated 按指定分辨率读取历史：已汇总的数据加上尚未汇总的较细数据（调用方持有锁）
+func (s *CSVStorage) readAggregated(serial, resolution string, from, to time.Time) ([]smart.HistoryRecord, error) {
+	raw, err := s.readRaw(serial, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	aggs := aggregateRecords(raw, ResolutionHourly)
+
+	hourly, err := s.readAggregates(serial, ResolutionHourly)
+	if err != nil {
+		return nil, err
+	}
+	aggs = append(hourly, aggs...)
+
+	if resolution == ResolutionDaily {
+		daily, err := s.readAggregates(serial, ResolutionDaily)
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(daily, aggs...)
+	}
+	aggs = rebucket(aggs, resolution)
+
+	// 包含 from 所在的区间
+	if !from.IsZero() {
+		from = bucketStart(from, resolution)
+	}
+
+	records := []smart.HistoryRecord{}
+	for _, a := range aggs {
+		if !from.IsZero() && a.start.Before(from) {
+			continue
+		}
+		if !to.IsZero() && a.start.After(to) {
+			continue
+		}
+		records = append(records, a.record(resolution))
+	}
+
+	return records, nil
+}
+
+// oldestAggregate 返回设备最早的汇总数据的时间，没有汇总数据时返回零值（调用方持有锁）
+func (s *CSVStorage) oldestAggregate(serial string) (time.Time, error) {
+	for _, resolution := range []string{ResolutionDaily, ResolutionHourly} {
+		aggs, err := s.readAggregates(serial, resolution)
+		if err != nil {
+			return time.Time{}, err
+		}
+		var oldest time.Time
+		for _, a := range aggs {
+			if oldest.IsZero() || a.start.Before(oldest) {
+				oldest = a.start
+			}
+		}
+		if !oldest.IsZero() {
+			return oldest, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// ApplyRetention 实现 Storage 接口
+func (s *CSVStorage) ApplyRetention() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// 按完整区间截断，避免把尚未结束的小时或天拆成两段
+	rawCutoff := bucketStart(now.AddDate(0, 0, -s.policy.RawDays), ResolutionHourly)
+	hourlyCutoff := bucketStart(now.AddDate(0, 0, -s.policy.HourlyDays), ResolutionDaily)
+	dailyCutoff := bucketStart(now.AddDate(0, 0, -s.policy.DailyDays), ResolutionDaily)
+
+	serials, err := s.listSerials()
+	if err != nil {
+		return err
+	}
+
+	for _, serial := range serials {
+		if err := s.retainSerial(serial, rawCutoff, hourlyCutoff, dailyCutoff); err != nil {
+			return fmt.Errorf("retention %s: %w", serial, err)
+		}
+		if err := s.thinAttributes(serial, rawCutoff); err != nil {
+			return fmt.Errorf("retention %s attributes: %w", serial, err)
+		}
+	}
+
+	// 电源状态只用于统计待机占比，和天数据保留同样久
+	return s.trimPower(dailyCutoff)
+}
+
+// retainSerial 对一个设备执行保留策略（调用方持有锁）
+//
+// 先写入较粗的汇总再删除较细的数据，中途失败最多重复计数，不会丢数据。
+func (s *CSVStorage) retainSerial(serial string, rawCutoff, hourlyCutoff, dailyCutoff time.Time) error {
+	raw, err := s.readRaw(serial, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	hourly, err := s.readAggregates(serial, ResolutionHourly)
+	if err != nil {
+		return err
+	}
+	daily, err := s.readAggregates(serial, ResolutionDaily)
+	if err != nil {
+		return err
+	}
+
+	// 原始采样 → 小时，原始采样文件中的行在最后按时间删除
+	var oldRaw []smart.HistoryRecord
+	for _, rec := range raw {
+		if rec.Timestamp.Before(rawCutoff) {
+			oldRaw = append(oldRaw, rec)
+		}
+	}
+	hourlyChanged := len(oldRaw) > 0
+	if hourlyChanged {
+		hourly = rebucket(append(hourly, aggregateRecords(oldRaw, ResolutionHourly)...), ResolutionHourly)
+	}
+
+	// 小时 → 天
+	var keepHourly, oldHourly []*aggregate
+	for _, a := range hourly {
+		if a.start.Before(hourlyCutoff) {
+			oldHourly = append(oldHourly, a)
+		} else {
+			keepHourly = append(keepHourly, a)
+		}
+	}
+	dailyChanged := len(oldHourly) > 0
+	if dailyChanged {
+		hourlyChanged = true
+		daily = rebucket(append(daily, oldHourly...), ResolutionDaily)
+	}
+
+	// 删除超期的天数据
+	keepDaily := daily[:0:0]
+	for _, a := range daily {
+		if a.start.Before(dailyCutoff) {
+			dailyChanged = true
+			continue
+		}
+		keepDaily = append(keepDaily, a)
+	}
+
+	if dailyChanged {
+		if err := s.writeAggregates(serial, ResolutionDaily, keepDaily); err != nil {
+			return err
+		}
+	}
+	if hourlyChanged {
+		if err := s.writeAggregates(serial, ResolutionHourly, keepHourly); err != nil {
+			return err
+		}
+	}
+	if len(oldRaw) > 0 {
+		if err := s.filterRaw(serial, rawCutoff); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
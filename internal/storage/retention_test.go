@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFutureRaw 写入更新版本（#schema=3，多一列 future_column）的原始采样文件
+func writeFutureRaw(t *testing.T, path string, timestamps ...time.Time) {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("#schema=3\n")
+	w := csv.NewWriter(&buf)
+	header := append(rawHeader(), "future_column")
+	w.Write(header)
+	for _, ts := range timestamps {
+		row := make([]string, len(header))
+		row[0] = ts.UTC().Format(time.RFC3339)
+		row[1] = "35"
+		row[len(row)-1] = "kept"
+		w.Write(row)
+	}
+	w.Flush()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkFutureRaw 检查文件仍是版本 3、保留了 future_column，且只剩 rows 行数据
+func checkFutureRaw(t *testing.T, path string, rows int) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := schemaVersion(content); v != 3 {
+		t.Errorf("schema version = %d after rewrite, want 3", v)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2+rows {
+		t.Fatalf("file has %d lines, want %d:\n%s", len(lines), 2+rows, content)
+	}
+	if !strings.HasSuffix(lines[1], ",future_column") {
+		t.Errorf("header lost future_column: %s", lines[1])
+	}
+	for _, line := range lines[2:] {
+		if !strings.HasSuffix(line, ",kept") {
+			t.Errorf("row lost the future_column value: %s", line)
+		}
+	}
+}
+
+func TestRetentionKeepsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewCSVStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetRetentionPolicy(RetentionPolicy{RawDays: 7, HourlyDays: 30, DailyDays: 365})
+
+	now := time.Now().Truncate(time.Second)
+	old := now.AddDate(0, 0, -10)
+	path := filepath.Join(dir, "AAA.csv")
+	writeFutureRaw(t, path, old, now.Add(-time.Hour))
+
+	if err := store.ApplyRetention(); err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	checkFutureRaw(t, path, 1)
+
+	// 过期的原始采样汇总到小时数据
+	hourly, err := store.readAggregates("AAA", ResolutionHourly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 1 || hourly[0].samples != 1 {
+		t.Errorf("hourly = %+v, want one bucket with the expired sample", hourly)
+	}
+
+	records, err := store.GetHistory("AAA", now.Add(-2*time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Temperature != 35 {
+		t.Errorf("GetHistory = %+v, want the recent sample", records)
+	}
+}
+
+func TestCleanOldRecordsKeepsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewCSVStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	path := filepath.Join(dir, "AAA.csv")
+	writeFutureRaw(t, path, now.AddDate(0, 0, -40), now.AddDate(0, 0, -2), now.Add(-time.Hour))
+
+	if err := store.CleanOldRecords(30); err != nil {
+		t.Fatalf("CleanOldRecords: %v", err)
+	}
+	checkFutureRaw(t, path, 2)
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-cat/internal/smart"
+)
+
+// rawSchemaVersion 原始采样文件的格式版本，记录在文件第一行（#schema=N）
+//
+//	1：没有版本行，按位置读取：基础 8 列，之后是 NVMe 列（旧文件的头部可能只有基础列）
+//	2：有版本行，按头部的列名读写；新增的列追加在 historyFields 末尾并提升版本号
+//
+// 版本低于当前版本或缺少当前的列的文件在下一次追加时按当前头部重写（惰性升级）；
+// 更新版本写入的文件追加时不重写，不认识的列读取时忽略、追加时留空。
+const rawSchemaVersion = 2
+
+// schemaPrefix 版本行的前缀，读取 CSV 时以 # 开头的行作为注释跳过
+const schemaPrefix = "#schema="
+
+// rawColumnsV1 版本 1 的列，按位置对应；已经固定，不再修改
+var rawColumnsV1 = []string{
+	"timestamp",
+	"temperature",
+	"power_on_hours",
+	"power_cycle_count",
+	"reallocated_sectors",
+	"pending_sectors",
+	"uncorrectable_errors",
+	"health_percent",
+	"nvme_critical_warning",
+	"nvme_available_spare",
+	"nvme_available_spare_threshold",
+	"nvme_percentage_used",
+	"nvme_data_units_read",
+	"nvme_data_units_written",
+	"nvme_host_read_commands",
+	"nvme_host_write_commands",
+	"nvme_controller_busy_time",
+	"nvme_unsafe_shutdowns",
+	"nvme_media_errors",
+	"nvme_error_log_entries",
+	"nvme_warning_temp_time",
+	"nvme_critical_comp_time",
+}
+
+// rawHeader 当前版本的头部：时间加 historyFields 的各字段
+func rawHeader() []string {
+	header := []string{"timestamp"}
+	for _, f := range historyFields {
+		header = append(header, f.name)
+	}
+	return header
+}
+
+// rawHead 新文件开头的版本行和头部
+func rawHead() [][]string {
+	return [][]string{{schemaPrefix + strconv.Itoa(rawSchemaVersion)}, rawHeader()}
+}
+
+// schemaVersion 文件第一行记录的格式版本，没有版本行的旧文件为 1
+func schemaVersion(content []byte) int {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	v, ok := strings.CutPrefix(strings.TrimSpace(string(line)), schemaPrefix)
+	if !ok {
+		return 1
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 1
+	}
+	return version
+}
+
+// rawBaseColumnsV1 版本 1 的行至少有的列数（基础列），NVMe 列可以整体缺失
+const rawBaseColumnsV1 = 8
+
+// rawColumns 文件中各列的名称和一行至少的列数：版本 1 按固定的位置，旧的行只有基础列；
+// 之后的版本按头部，每行都按头部写出，列数与头部相同
+func rawColumns(version int, header []string) (columns []string, minLen int) {
+	if version < 2 {
+		return rawColumnsV1, rawBaseColumnsV1
+	}
+	return header, len(header)
+}
+
+// readRawHead 只读取文件开头的版本行和头部；文件为空时 header 为 nil
+func readRawHead(filename string) (version int, header []string, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	var head []byte
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		head = append(head, line...)
+		if err != nil || line[0] != '#' {
+			break
+		}
+	}
+
+	rows, _, _ := parseCSV(head)
+	if len(rows) == 0 {
+		return rawSchemaVersion, nil, nil
+	}
+	return schemaVersion(head), rows[0], nil
+}
+
+// needsUpgrade 文件是否需要按当前头部重写
+func needsUpgrade(version int, header []string) bool {
+	if version > rawSchemaVersion {
+		return false
+	}
+	if version < rawSchemaVersion {
+		return true
+	}
+	present := make(map[string]bool, len(header))
+	for _, name := range header {
+		present[name] = true
+	}
+	for _, name := range rawHeader() {
+		if !present[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// formatRaw 按列名格式化一条记录，没有值的字段和不认识的列留空
+func formatRaw(rec *smart.HistoryRecord, columns []string) []string {
+	row := make([]string, len(columns))
+	for i, name := range columns {
+		if name == "timestamp" {
+			row[i] = rec.Timestamp.Format(time.RFC3339)
+			continue
+		}
+		j, ok := historyFieldIndex[name]
+		if !ok {
+			continue
+		}
+		if v, ok := historyFields[j].get(rec); ok {
+			row[i] = strconv.FormatInt(int64(math.Round(v)), 10)
+		}
+	}
+	return row
+}
+
+// parseRaw 按列名解析一行，列数不在 [minLen, len(columns)] 之间（截断的行）或时间无效时返回 false；
+// 空值和不认识的列跳过
+func parseRaw(row, columns []string, minLen int) (smart.HistoryRecord, bool) {
+	var rec smart.HistoryRecord
+	if len(row) < minLen || len(row) > len(columns) {
+		return rec, false
+	}
+	valid := false
+	for i, c := range row {
+		if columns[i] == "timestamp" {
+			ts, err := time.Parse(time.RFC3339, c)
+			if err != nil {
+				return rec, false
+			}
+			rec.Timestamp = ts
+			valid = true
+			continue
+		}
+		j, ok := historyFieldIndex[columns[i]]
+		if !ok || c == "" {
+			continue
+		}
+		if v, err := strconv.ParseInt(c, 10, 64); err == nil {
+			historyFields[j].set(&rec, float64(v))
+		}
+	}
+	return rec, valid
+}
+
+// upgradeRaw 把旧格式的原始采样文件按当前头部重写（调用方持有锁）
+func (s *CSVStorage) upgradeRaw(serial string) error {
+	records, err := s.readRaw(serial, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	if err := s.rewriteFile(s.rawFile(serial), records); err != nil {
+		return fmt.Errorf("upgrade %s: %w", s.rawFile(serial), err)
+	}
+	return nil
+}
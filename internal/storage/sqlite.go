@@ -0,0 +1,750 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // 纯 Go 的 SQLite 驱动，不需要 cgo
+
+	"smart-cat/internal/smart"
+)
+
+// SQLiteFile 数据目录中 SQLite 数据库的文件名
+const SQLiteFile = "smartcat.db"
+
+// sqliteSchemaVersion 数据库结构版本，保存在 PRAGMA user_version 中
+const sqliteSchemaVersion = 1
+
+// SQLiteStorage SQLite 存储实现
+//
+// 所有设备共用一个数据库文件，各表按 (device, timestamp) 建索引，查询不再需要读取整个文件。
+// 每次写入在一个事务中完成，保留策略的汇总和删除也在同一个事务中，中途崩溃不会丢失或截断历史。
+// 数据库使用 WAL 模式，读取之间、读取和写入之间互不阻塞。
+type SQLiteStorage struct {
+	db     *sql.DB
+	mu     sync.RWMutex // 只保护 policy
+	policy RetentionPolicy
+
+	insertRecord     string
+	insertAggregate  string
+	recordColumns    string
+	aggregateColumns string
+}
+
+// NewSQLiteStorage 打开（不存在时创建）path 处的 SQLite 数据库
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	// 写事务以 BEGIN IMMEDIATE 开始，避免两个事务同时从读升级为写时互相等待
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_pragma=synchronous(NORMAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+
+	s := &SQLiteStorage{db: db, policy: DefaultRetentionPolicy()}
+	s.prepareStatements()
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Close 关闭数据库
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// SetRetentionPolicy 设置保留策略（同时决定 GetHistory 使用的分辨率）
+func (s *SQLiteStorage) SetRetentionPolicy(policy RetentionPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+func (s *SQLiteStorage) retentionPolicy() RetentionPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// prepareStatements 按 historyFields 生成各字段的列名和插入语句
+func (s *SQLiteStorage) prepareStatements() {
+	var recordCols, aggregateCols []string
+	for _, f := range historyFields {
+		recordCols = append(recordCols, f.name)
+		aggregateCols = append(aggregateCols, f.name+"_min", f.name+"_max", f.name+"_avg", f.name+"_last")
+	}
+	s.recordColumns = strings.Join(recordCols, ", ")
+	s.aggregateColumns = strings.Join(aggregateCols, ", ")
+	s.insertRecord = fmt.Sprintf("INSERT OR REPLACE INTO records (device, timestamp, %s) VALUES (?, ?%s)",
+		s.recordColumns, strings.Repeat(", ?", len(recordCols)))
+	s.insertAggregate = fmt.Sprintf("INSERT OR REPLACE INTO aggregates (device, resolution, start, samples, %s) VALUES (?, ?, ?, ?%s)",
+		s.aggregateColumns, strings.Repeat(", ?", len(aggregateCols)))
+}
+
+// migrate 创建或升级数据库结构
+//
+// 表结构随 historyFields 生成，每次打开都检查 records 和 aggregates 的列，
+// historyFields 新增字段后在已有数据库上补齐缺少的列（旧数据为 NULL）。
+func (s *SQLiteStorage) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if version > sqliteSchemaVersion {
+		return fmt.Errorf("schema version %d is newer than supported %d", version, sqliteSchemaVersion)
+	}
+
+	var recordCols, aggregateCols []string
+	for _, f := range historyFields {
+		recordCols = append(recordCols, f.name+" INTEGER")
+		aggregateCols = append(aggregateCols, f.name+"_min REAL", f.name+"_max REAL", f.name+"_avg REAL", f.name+"_last REAL")
+	}
+	statements := []string{
+		// 原始采样，NVMe 字段在非 NVMe 设备上为 NULL
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS records (
+			device TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			%s,
+			PRIMARY KEY (device, timestamp)
+		) WITHOUT ROWID`, strings.Join(recordCols, ",\n\t\t\t")),
+		// 小时/天汇总，列与汇总 CSV 相同
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS aggregates (
+			device TEXT NOT NULL,
+			resolution TEXT NOT NULL,
+			start INTEGER NOT NULL,
+			samples INTEGER NOT NULL,
+			%s,
+			PRIMARY KEY (device, resolution, start)
+		) WITHOUT ROWID`, strings.Join(aggregateCols, ",\n\t\t\t")),
+		// 完整的属性表，每次采集每个属性一行
+		`CREATE TABLE IF NOT EXISTS attributes (
+			device TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			value INTEGER NOT NULL,
+			worst INTEGER NOT NULL,
+			threshold INTEGER NOT NULL,
+			raw_value INTEGER NOT NULL,
+			when_failed TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (device, id, timestamp)
+		) WITHOUT ROWID`,
+		`CREATE INDEX IF NOT EXISTS attributes_device_timestamp ON attributes (device, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS power_states (
+			device TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			state TEXT NOT NULL,
+			PRIMARY KEY (device, timestamp)
+		) WITHOUT ROWID`,
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := addMissingColumns(tx, "records", recordCols); err != nil {
+		return err
+	}
+	if err := addMissingColumns(tx, "aggregates", aggregateCols); err != nil {
+		return err
+	}
+	if version < sqliteSchemaVersion {
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// addMissingColumns 给表补上 columns（"名称 类型"）中缺少的列
+func addMissingColumns(tx *sql.Tx, table string, columns []string) error {
+	rows, err := tx.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return fmt.Errorf("read columns of %s: %w", table, err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("read columns of %s: %w", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read columns of %s: %w", table, err)
+	}
+
+	for _, column := range columns {
+		name, _, _ := strings.Cut(column, " ")
+		if existing[name] {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column)); err != nil {
+			return fmt.Errorf("add column %s to %s: %w", name, table, err)
+		}
+	}
+	return nil
+}
+
+// withTx 在一个写事务中执行 fn，fn 返回错误时回滚
+func (s *SQLiteStorage) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// queryer 数据库或事务
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// deviceKey 与 CSV 存储相同，空键记为 unknown
+func deviceKey(serial string) string {
+	if serial == "" {
+		return "unknown"
+	}
+	return serial
+}
+
+// timeRange 把可为零值的时间范围转换为 Unix 秒的闭区间
+func timeRange(from, to time.Time) (int64, int64) {
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	if !from.IsZero() {
+		lo = from.Unix()
+	}
+	if !to.IsZero() {
+		hi = to.Unix()
+	}
+	return lo, hi
+}
+
+// SaveRecord 实现 Storage 接口
+func (s *SQLiteStorage) SaveRecord(serial string, data *smart.SMARTData) error {
+	rec := historyRecordOf(data)
+	return s.withTx(func(tx *sql.Tx) error {
+		return s.insertRecords(tx, deviceKey(serial), []smart.HistoryRecord{rec})
+	})
+}
+
+// insertRecords 写入原始采样，同一时间的采样覆盖旧值
+func (s *SQLiteStorage) insertRecords(q queryer, device string, records []smart.HistoryRecord) error {
+	for i := range records {
+		args := []any{device, records[i].Timestamp.Unix()}
+		for _, f := range historyFields {
+			if v, ok := f.get(&records[i]); ok {
+				args = append(args, int64(math.Round(v)))
+			} else {
+				args = append(args, nil)
+			}
+		}
+		if _, err := q.Exec(s.insertRecord, args...); err != nil {
+			return fmt.Errorf("insert record: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetHistory 实现 Storage 接口，按时间范围自动选择原始、小时或天级分辨率
+func (s *SQLiteStorage) GetHistory(serial string, from, to time.Time) ([]smart.HistoryRecord, error) {
+	device := deviceKey(serial)
+
+	// 汇总和原始采样在同一个快照中读取，避免与保留策略交错时重复或遗漏
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldest time.Time
+	if from.IsZero() {
+		var start sql.NullInt64
+		if err := tx.QueryRow("SELECT MIN(start) FROM aggregates WHERE device = ?", device).Scan(&start); err != nil {
+			return nil, fmt.Errorf("query oldest aggregate: %w", err)
+		}
+		if start.Valid {
+			oldest = time.Unix(start.Int64, 0)
+		}
+	}
+	resolution := s.retentionPolicy().resolutionFor(from, oldest, time.Now())
+
+	if resolution == ResolutionRaw {
+		records, err := s.queryRecords(tx, device, from, to)
+		for i := range records {
+			records[i].Resolution = ResolutionRaw
+		}
+		if records == nil && err == nil {
+			records = []smart.HistoryRecord{}
+		}
+		return records, err
+	}
+	return s.readAggregated(tx, device, resolution, from, to)
+}
+
+// queryRecords 读取时间范围内的原始采样，按时间排序
+func (s *SQLiteStorage) queryRecords(q queryer, device string, from, to time.Time) ([]smart.HistoryRecord, error) {
+	lo, hi := timeRange(from, to)
+	rows, err := q.Query(fmt.Sprintf("SELECT timestamp, %s FROM records WHERE device = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp",
+		s.recordColumns), device, lo, hi)
+	if err != nil {
+		return nil, fmt.Errorf("query records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []smart.HistoryRecord
+	values := make([]sql.NullInt64, len(historyFields))
+	dest := make([]any, len(historyFields)+1)
+	var ts int64
+	dest[0] = &ts
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan record: %w", err)
+		}
+		rec := smart.HistoryRecord{Timestamp: time.Unix(ts, 0)}
+		for i, f := range historyFields {
+			if values[i].Valid {
+				f.set(&rec, float64(values[i].Int64))
+			}
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read records: %w", err)
+	}
+	return records, nil
+}
+
+// queryAggregates 读取 start 不早于 from 的汇总，按时间排序
+func (s *SQLiteStorage) queryAggregates(q queryer, device, resolution string, from time.Time) ([]*aggregate, error) {
+	lo, _ := timeRange(from, time.Time{})
+	rows, err := q.Query(fmt.Sprintf("SELECT start, samples, %s FROM aggregates WHERE device = ? AND resolution = ? AND start >= ? ORDER BY start",
+		s.aggregateColumns), device, resolution, lo)
+	if err != nil {
+		return nil, fmt.Errorf("query %s aggregates: %w", resolution, err)
+	}
+	defer rows.Close()
+
+	var aggs []*aggregate
+	values := make([]sql.NullFloat64, 4*len(historyFields))
+	dest := make([]any, len(values)+2)
+	var start int64
+	var samples int
+	dest[0], dest[1] = &start, &samples
+	for i := range values {
+		dest[i+2] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan %s aggregate: %w", resolution, err)
+		}
+		a := newAggregate(time.Unix(start, 0))
+		a.samples = samples
+		for i := range historyFields {
+			v := values[4*i : 4*i+4]
+			if !v[0].Valid {
+				continue
+			}
+			// 与汇总 CSV 相同，只有总采样数，按该字段每次都有值处理
+			a.has[i] = true
+			a.count[i] = samples
+			a.min[i], a.max[i] = v[0].Float64, v[1].Float64
+			a.sum[i] = v[2].Float64 * float64(samples)
+			a.last[i] = v[3].Float64
+		}
+		aggs = append(aggs, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read %s aggregates: %w", resolution, err)
+	}
+	return aggs, nil
+}
+
+// replaceAggregates 用 aggs 替换设备某个分辨率的全部汇总
+func (s *SQLiteStorage) replaceAggregates(q queryer, device, resolution string, aggs []*aggregate) error {
+	if _, err := q.Exec("DELETE FROM aggregates WHERE device = ? AND resolution = ?", device, resolution); err != nil {
+		return fmt.Errorf("delete %s aggregates: %w", resolution, err)
+	}
+	return s.insertAggregates(q, device, resolution, aggs)
+}
+
+// insertAggregates 写入汇总，同一区间覆盖旧值
+func (s *SQLiteStorage) insertAggregates(q queryer, device, resolution string, aggs []*aggregate) error {
+	for _, a := range aggs {
+		args := []any{device, resolution, a.start.Unix(), a.samples}
+		for i := range historyFields {
+			if !a.has[i] {
+				args = append(args, nil, nil, nil, nil)
+				continue
+			}
+			args = append(args, a.min[i], a.max[i], a.avg(i), a.last[i])
+		}
+		if _, err := q.Exec(s.insertAggregate, args...); err != nil {
+			return fmt.Errorf("insert %s aggregate: %w", resolution, err)
+		}
+	}
+	return nil
+}
+
+// readAggregated 按指定分辨率读取历史：已汇总的数据加上尚未汇总的较细数据
+func (s *SQLiteStorage) readAggregated(q queryer, device, resolution string, from, to time.Time) ([]smart.HistoryRecord, error) {
+	// 包含 from 所在的区间
+	if !from.IsZero() {
+		from = bucketStart(from, resolution)
+	}
+
+	raw, err := s.queryRecords(q, device, from, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	aggs := aggregateRecords(raw, ResolutionHourly)
+
+	hourly, err := s.queryAggregates(q, device, ResolutionHourly, from)
+	if err != nil {
+		return nil, err
+	}
+	aggs = append(hourly, aggs...)
+
+	if resolution == ResolutionDaily {
+		daily, err := s.queryAggregates(q, device, ResolutionDaily, from)
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(daily, aggs...)
+	}
+	aggs = rebucket(aggs, resolution)
+
+	records := []smart.HistoryRecord{}
+	for _, a := range aggs {
+		if !to.IsZero() && a.start.After(to) {
+			continue
+		}
+		records = append(records, a.record(resolution))
+	}
+	return records, nil
+}
+
+// SaveAttributes 实现 Storage 接口
+func (s *SQLiteStorage) SaveAttributes(serial string, timestamp time.Time, attrs []smart.SMARTAttribute) error {
+	if len(attrs) == 0 {
+		return nil
+	}
+	records := make([]smart.AttributeRecord, len(attrs))
+	for i, attr := range attrs {
+		records[i] = smart.AttributeRecord{Timestamp: timestamp, SMARTAttribute: attr}
+	}
+	return s.withTx(func(tx *sql.Tx) error {
+		return insertAttributes(tx, deviceKey(serial), records)
+	})
+}
+
+// insertAttributes 写入属性，同一时间的同一属性覆盖旧值
+func insertAttributes(q queryer, device string, records []smart.AttributeRecord) error {
+	for _, r := range records {
+		if _, err := q.Exec(`INSERT OR REPLACE INTO attributes
+			(device, timestamp, id, name, value, worst, threshold, raw_value, when_failed)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			device, r.Timestamp.Unix(), r.ID, r.Name, r.Value, r.Worst, r.Threshold, r.RawValue, r.WhenFailed); err != nil {
+			return fmt.Errorf("insert attribute: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetAttributeHistory 实现 Storage 接口
+func (s *SQLiteStorage) GetAttributeHistory(serial string, id int, from, to time.Time) ([]smart.AttributeRecord, error) {
+	lo, hi := timeRange(from, to)
+	rows, err := s.db.Query(`SELECT timestamp, name, value, worst, threshold, raw_value, when_failed
+		FROM attributes WHERE device = ? AND id = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp`,
+		deviceKey(serial), id, lo, hi)
+	if err != nil {
+		return nil, fmt.Errorf("query attributes: %w", err)
+	}
+	defer rows.Close()
+
+	records := []smart.AttributeRecord{}
+	for rows.Next() {
+		var ts int64
+		r := smart.AttributeRecord{SMARTAttribute: smart.SMARTAttribute{ID: id}}
+		if err := rows.Scan(&ts, &r.Name, &r.Value, &r.Worst, &r.Threshold, &r.RawValue, &r.WhenFailed); err != nil {
+			return nil, fmt.Errorf("scan attribute: %w", err)
+		}
+		r.Timestamp = time.Unix(ts, 0)
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read attributes: %w", err)
+	}
+	return records, nil
+}
+
+// SavePowerState 实现 Storage 接口
+func (s *SQLiteStorage) SavePowerState(serial string, timestamp time.Time, state string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return insertPowerState(tx, deviceKey(serial), timestamp, state)
+	})
+}
+
+func insertPowerState(q queryer, device string, timestamp time.Time, state string) error {
+	if _, err := q.Exec("INSERT OR REPLACE INTO power_states (device, timestamp, state) VALUES (?, ?, ?)",
+		device, timestamp.Unix(), state); err != nil {
+		return fmt.Errorf("insert power state: %w", err)
+	}
+	return nil
+}
+
+// GetPowerStats 实现 Storage 接口
+func (s *SQLiteStorage) GetPowerStats(serial string, from, to time.Time) (smart.PowerStats, error) {
+	var stats smart.PowerStats
+	lo, hi := timeRange(from, to)
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(state = ?), 0)
+		FROM power_states WHERE device = ? AND timestamp BETWEEN ? AND ?`,
+		smart.PowerStateStandby, deviceKey(serial), lo, hi).Scan(&stats.Samples, &stats.Standby)
+	if err != nil {
+		return stats, fmt.Errorf("query power states: %w", err)
+	}
+	if stats.Samples > 0 {
+		stats.AsleepPercent = float64(stats.Standby) * 100 / float64(stats.Samples)
+	}
+	return stats, nil
+}
+
+// GetAllSerials 实现 Storage 接口
+func (s *SQLiteStorage) GetAllSerials() ([]string, error) {
+	return s.devices(s.db)
+}
+
+// devices 有原始采样、汇总或属性数据的设备
+//
+// 原始采样过期后设备的汇总和属性仍要参与保留策略，与 CSV 存储保留原始采样文件相同。
+func (s *SQLiteStorage) devices(q queryer) ([]string, error) {
+	rows, err := q.Query(`SELECT device FROM records
+		UNION SELECT device FROM aggregates
+		UNION SELECT device FROM attributes
+		ORDER BY device`)
+	if err != nil {
+		return nil, fmt.Errorf("query devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []string
+	for rows.Next() {
+		var device string
+		if err := rows.Scan(&device); err != nil {
+			return nil, fmt.Errorf("scan device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// sqliteTables 保存设备数据的表，RenameDevice 逐表迁移
+var sqliteTables = []string{"records", "aggregates", "attributes", "power_states"}
+
+// RenameDevice 实现 Storage 接口，目标键在某个表中已有数据时跳过该表
+func (s *SQLiteStorage) RenameDevice(from, to string) error {
+	var errs []error
+	err := s.withTx(func(tx *sql.Tx) error {
+		for _, table := range sqliteTables {
+			var found, exists bool
+			query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE device = ?)", table)
+			if err := tx.QueryRow(query, from).Scan(&found); err != nil {
+				return fmt.Errorf("rename %s in %s: %w", from, table, err)
+			}
+			if !found {
+				continue // 没有旧数据
+			}
+			if err := tx.QueryRow(query, to).Scan(&exists); err != nil {
+				return fmt.Errorf("rename %s in %s: %w", from, table, err)
+			}
+			if exists {
+				errs = append(errs, fmt.Errorf("rename %s in %s: %s already exists", from, table, to))
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET device = ? WHERE device = ?", table), to, from); err != nil {
+				return fmt.Errorf("rename %s in %s: %w", from, table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// CleanOldRecords 实现 Storage 接口，直接删除 days 天前的原始采样（不做汇总）
+func (s *SQLiteStorage) CleanOldRecords(days int) error {
+	cutoff := time.Now().AddDate(0, 0, -days)
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM records WHERE timestamp < ?", cutoff.Unix()); err != nil {
+			return fmt.Errorf("delete records: %w", err)
+		}
+		return nil
+	})
+}
+
+// ApplyRetention 实现 Storage 接口，每个设备在一个事务中完成
+func (s *SQLiteStorage) ApplyRetention() error {
+	policy := s.retentionPolicy()
+	now := time.Now()
+	// 按完整区间截断，避免把尚未结束的小时或天拆成两段
+	rawCutoff := bucketStart(now.AddDate(0, 0, -policy.RawDays), ResolutionHourly)
+	hourlyCutoff := bucketStart(now.AddDate(0, 0, -policy.HourlyDays), ResolutionDaily)
+	dailyCutoff := bucketStart(now.AddDate(0, 0, -policy.DailyDays), ResolutionDaily)
+
+	devices, err := s.devices(s.db)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		err := s.withTx(func(tx *sql.Tx) error {
+			if err := s.retainDevice(tx, device, rawCutoff, hourlyCutoff, dailyCutoff); err != nil {
+				return err
+			}
+			return thinAttributeRows(tx, device, rawCutoff)
+		})
+		if err != nil {
+			return fmt.Errorf("retention %s: %w", device, err)
+		}
+	}
+
+	// 电源状态只用于统计待机占比，和天数据保留同样久
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM power_states WHERE timestamp < ?", dailyCutoff.Unix()); err != nil {
+			return fmt.Errorf("retention power states: %w", err)
+		}
+		return nil
+	})
+}
+
+// retainDevice 对一个设备执行保留策略，汇总规则与 CSV 存储相同
+func (s *SQLiteStorage) retainDevice(tx *sql.Tx, device string, rawCutoff, hourlyCutoff, dailyCutoff time.Time) error {
+	oldRaw, err := s.queryRecords(tx, device, time.Time{}, rawCutoff.Add(-time.Second))
+	if err != nil {
+		return err
+	}
+	hourly, err := s.queryAggregates(tx, device, ResolutionHourly, time.Time{})
+	if err != nil {
+		return err
+	}
+	daily, err := s.queryAggregates(tx, device, ResolutionDaily, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	// 原始采样 → 小时
+	hourlyChanged := len(oldRaw) > 0
+	if hourlyChanged {
+		hourly = rebucket(append(hourly, aggregateRecords(oldRaw, ResolutionHourly)...), ResolutionHourly)
+	}
+
+	// 小时 → 天
+	var keepHourly, oldHourly []*aggregate
+	for _, a := range hourly {
+		if a.start.Before(hourlyCutoff) {
+			oldHourly = append(oldHourly, a)
+		} else {
+			keepHourly = append(keepHourly, a)
+		}
+	}
+	dailyChanged := len(oldHourly) > 0
+	if dailyChanged {
+		hourlyChanged = true
+		daily = rebucket(append(daily, oldHourly...), ResolutionDaily)
+	}
+
+	// 删除超期的天数据
+	keepDaily := daily[:0:0]
+	for _, a := range daily {
+		if a.start.Before(dailyCutoff) {
+			dailyChanged = true
+			continue
+		}
+		keepDaily = append(keepDaily, a)
+	}
+
+	if dailyChanged {
+		if err := s.replaceAggregates(tx, device, ResolutionDaily, keepDaily); err != nil {
+			return err
+		}
+	}
+	if hourlyChanged {
+		if err := s.replaceAggregates(tx, device, ResolutionHourly, keepHourly); err != nil {
+			return err
+		}
+	}
+	if len(oldRaw) > 0 {
+		if _, err := tx.Exec("DELETE FROM records WHERE device = ? AND timestamp < ?", device, rawCutoff.Unix()); err != nil {
+			return fmt.Errorf("delete records: %w", err)
+		}
+	}
+	return nil
+}
+
+// thinAttributeRows 早于 cutoff 的属性表每天只保留最后一次采集
+func thinAttributeRows(tx *sql.Tx, device string, cutoff time.Time) error {
+	rows, err := tx.Query("SELECT DISTINCT timestamp FROM attributes WHERE device = ? AND timestamp < ? ORDER BY timestamp",
+		device, cutoff.Unix())
+	if err != nil {
+		return fmt.Errorf("query attributes: %w", err)
+	}
+	// 日期按本地时区划分，与 CSV 存储相同
+	lastOfDay := make(map[string]int64)
+	var timestamps []int64
+	for rows.Next() {
+		var ts int64
+		if err := rows.Scan(&ts); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan attributes: %w", err)
+		}
+		timestamps = append(timestamps, ts)
+		lastOfDay[time.Unix(ts, 0).Format("2006-01-02")] = ts
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read attributes: %w", err)
+	}
+
+	for _, ts := range timestamps {
+		if lastOfDay[time.Unix(ts, 0).Format("2006-01-02")] == ts {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM attributes WHERE device = ? AND timestamp = ?", device, ts); err != nil {
+			return fmt.Errorf("delete attributes: %w", err)
+		}
+	}
+	return nil
+}
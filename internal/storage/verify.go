@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileReport 一个 CSV 文件的检查结果
+type FileReport struct {
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`                 // raw、hourly、daily、attributes、power
+	Rows      int    `json:"rows"`                 // 有效的数据行
+	Partial   bool   `json:"partial,omitempty"`    // 最后一行写入中断
+	Malformed int    `json:"malformed,omitempty"`  // 无法解析或字段无效的行
+	BadHeader bool   `json:"bad_header,omitempty"` // 头部缺失或损坏
+	Leftover  bool   `json:"leftover,omitempty"`   // 原子重写中断留下的临时文件
+	Repaired  bool   `json:"repaired,omitempty"`
+}
+
+// Damaged 文件是否需要修复
+func (r FileReport) Damaged() bool {
+	return r.Partial || r.Malformed > 0 || r.BadHeader || r.Leftover
+}
+
+// csvKind 一类 CSV 文件：所在子目录、标准头部和行校验
+type csvKind struct {
+	name  string
+	dir   string
+	head  func() [][]string
+	valid func(row, columns []string) bool
+}
+
+var csvKinds = []csvKind{
+	{ResolutionRaw, "", rawHead, validRaw},
+	{ResolutionHourly, ResolutionHourly, func() [][]string { return [][]string{aggregateHeader()} }, validAggregate},
+	{ResolutionDaily, ResolutionDaily, func() [][]string { return [][]string{aggregateHeader()} }, validAggregate},
+	{attributesDir, attributesDir, func() [][]string { return [][]string{attributeHeader} }, validAttribute},
+	{powerDir, powerDir, func() [][]string { return [][]string{powerHeader} }, validPower},
+}
+
+// Verify 检查数据目录中的全部 CSV 文件，不修改文件
+func (s *CSVStorage) Verify() ([]FileReport, error) {
+	return s.check(false)
+}
+
+// Repair 检查并修复数据目录中的 CSV 文件
+//
+// 损坏的文件只保留头部和有效的行，原子地重写；头部损坏时换成标准头部；
+// 删除原子重写中断留下的临时文件（原文件没有被替换，仍然完整）。
+// 运行中的服务会同时追加数据，修复前应先停止服务。
+func (s *CSVStorage) Repair() ([]FileReport, error) {
+	return s.check(true)
+}
+
+// check 逐个检查文件，repair 时修复损坏的文件
+func (s *CSVStorage) check(repair bool) ([]FileReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reports []FileReport
+	for _, kind := range csvKinds {
+		dir := filepath.Join(s.dataDir, kind.dir)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return reports, fmt.Errorf("read dir: %w", err)
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, name)
+
+			switch {
+			case strings.HasSuffix(name, ".csv"+tmpSuffix):
+				r := FileReport{Path: path, Kind: kind.name, Leftover: true}
+				if repair {
+					if err := os.Remove(path); err != nil {
+						return reports, fmt.Errorf("remove %s: %w", path, err)
+					}
+					r.Repaired = true
+				}
+				reports = append(reports, r)
+			case strings.HasSuffix(name, ".csv"):
+				r, err := checkFile(path, kind, repair)
+				if err != nil {
+					return reports, err
+				}
+				reports = append(reports, r)
+			}
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Path < reports[j].Path
+	})
+	return reports, nil
+}
+
+// checkFile 检查一个文件，repair 且文件损坏时只保留有效的行重写
+func checkFile(path string, kind csvKind, repair bool) (FileReport, error) {
+	r := FileReport{Path: path, Kind: kind.name}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return r, fmt.Errorf("read %s: %w", path, err)
+	}
+	// 创建后还没来得及写入头部的空文件，下次追加时会写入头部
+	if len(content) == 0 {
+		return r, nil
+	}
+
+	rows, partial, malformed := parseCSV(content)
+	r.Partial = partial
+	r.Malformed = malformed
+
+	// 旧文件的头部可能比标准头部短，只要是头部（连同版本行）就保留
+	head := kind.head()
+	header := head[len(head)-1]
+	if len(rows) > 0 && len(rows[0]) > 0 && rows[0][0] == header[0] {
+		header = rows[0]
+		head = [][]string{header}
+		if line, _, _ := bytes.Cut(content, []byte("\n")); bytes.HasPrefix(line, []byte("#")) {
+			head = [][]string{{strings.TrimSpace(string(line))}, header}
+		}
+		rows = rows[1:]
+	} else {
+		r.BadHeader = true
+	}
+
+	// 截断的行列数不足，也算无效的行
+	columns, minLen := header, 0
+	if kind.name == ResolutionRaw {
+		columns, minLen = rawColumns(schemaVersion(content), header)
+	}
+
+	kept := head
+	for _, row := range rows {
+		if len(row) >= minLen && kind.valid(row, columns) {
+			kept = append(kept, row)
+		} else {
+			r.Malformed++
+		}
+	}
+	r.Rows = len(kept) - len(head)
+
+	if repair && r.Damaged() {
+		if err := writeCSVAtomic(path, kept); err != nil {
+			return r, err
+		}
+		r.Repaired = true
+	}
+	return r, nil
+}
+
+// validTime 时间列是否有效
+func validTime(s string) bool {
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+// validInts 列是否都是整数，allowEmpty 时允许为空
+func validInts(cols []string, allowEmpty bool) bool {
+	for _, c := range cols {
+		if c == "" && allowEmpty {
+			continue
+		}
+		if _, err := strconv.ParseInt(c, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// validRaw 原始采样行：不超过头部的列数（不少于最少列数由调用方按版本检查），认识的字段为整数，
+// 其余的列（更新版本写入的）不检查
+func validRaw(row, columns []string) bool {
+	if len(row) > len(columns) || !validTime(row[0]) {
+		return false
+	}
+	for i := 1; i < len(row); i++ {
+		if _, ok := historyFieldIndex[columns[i]]; ok && !validInts(row[i:i+1], true) {
+			return false
+		}
+	}
+	return true
+}
+
+// validAggregate 汇总行：列数与头部一致，没有值的字段为空
+func validAggregate(row, columns []string) bool {
+	if len(row) != len(columns) || !validTime(row[0]) || !validInts(row[1:2], false) {
+		return false
+	}
+	for _, c := range row[2:] {
+		if c == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(c, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// validAttribute 属性表行
+func validAttribute(row, _ []string) bool {
+	if len(row) != len(attributeHeader) || !validTime(row[0]) {
+		return false
+	}
+	return validInts(row[1:2], false) && validInts(row[3:7], false)
+}
+
+// validPower 电源状态行
+func validPower(row, _ []string) bool {
+	return len(row) == len(powerHeader) && validTime(row[0]) && row[1] != ""
+}
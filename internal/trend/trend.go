@@ -0,0 +1,267 @@
+package trend
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"smart-cat/internal/smart"
+	"smart-cat/internal/storage"
+)
+
+// 参与预测的指标，名称与告警规则的指标名相同
+const (
+	MetricReallocated   = "reallocated_sectors"
+	MetricPending       = "pending_sectors"
+	MetricUncorrectable = "uncorrectable_errors"
+	MetricNVMeWear      = "nvme_percentage_used"
+)
+
+// Metrics 参与预测的全部指标
+var Metrics = []string{MetricReallocated, MetricPending, MetricUncorrectable, MetricNVMeWear}
+
+// 置信度达到 1 需要的样本数和历史跨度
+const (
+	fullSamples = 12
+	fullSpan    = 7 * 24 * time.Hour
+)
+
+// Config 趋势预测配置
+type Config struct {
+	Window     time.Duration      `json:"window" yaml:"window"`         // 拟合增长率使用的历史窗口
+	Thresholds map[string]float64 `json:"thresholds" yaml:"thresholds"` // 指标 -> 阈值，达到时视为需要更换
+}
+
+// DefaultConfig 默认配置：NVMe 寿命已用达到 100%，或坏扇区类计数达到经验上需要更换的水平
+func DefaultConfig() Config {
+	return Config{
+		Window: 30 * 24 * time.Hour,
+		Thresholds: map[string]float64{
+			MetricReallocated:   100,
+			MetricPending:       50,
+			MetricUncorrectable: 50,
+			MetricNVMeWear:      100,
+		},
+	}
+}
+
+// Validate 检查配置
+func (c Config) Validate() error {
+	if c.Window < 24*time.Hour {
+		return fmt.Errorf("window must be at least 24h, got %v", c.Window)
+	}
+	for metric, threshold := range c.Thresholds {
+		if !known(metric) {
+			return fmt.Errorf("unknown metric %q", metric)
+		}
+		if threshold <= 0 {
+			return fmt.Errorf("threshold of %s must be positive, got %v", metric, threshold)
+		}
+	}
+	return nil
+}
+
+// known 判断是否为参与预测的指标
+func known(metric string) bool {
+	for _, m := range Metrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyzer 趋势分析器：从历史记录拟合增长率，预测达到阈值的天数
+type Analyzer struct {
+	config Config
+}
+
+// NewAnalyzer 创建趋势分析器
+func NewAnalyzer(config Config) *Analyzer {
+	return &Analyzer{config: config}
+}
+
+// Apply 读取设备在窗口内的历史，分析后写入 data.Trend；data 是刚读到的数据，可以已经保存也可以还没有保存
+func (a *Analyzer) Apply(store storage.Storage, key string, data *smart.SMARTData) error {
+	now := data.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	since := now.Add(-a.config.Window)
+	records, err := store.GetHistory(key, since, now)
+	if err != nil {
+		return fmt.Errorf("read history of %s: %w", key, err)
+	}
+	data.Trend = a.Analyze(records, data, since)
+	return nil
+}
+
+// Analyze 对历史记录和当前数据做线性拟合，没有可分析的指标时返回 nil
+func (a *Analyzer) Analyze(records []smart.HistoryRecord, current *smart.SMARTData, since time.Time) *smart.TrendReport {
+	report := &smart.TrendReport{Since: since}
+	for _, metric := range Metrics {
+		threshold, ok := a.config.Thresholds[metric]
+		if !ok {
+			continue
+		}
+		points := series(records, current, metric)
+		if len(points) == 0 {
+			continue
+		}
+		t := analyzeMetric(points, threshold)
+		t.Metric = metric
+		report.Metrics = append(report.Metrics, t)
+
+		if t.DaysRemaining != nil && (report.DaysRemaining == nil || *t.DaysRemaining < *report.DaysRemaining) {
+			days := *t.DaysRemaining
+			report.DaysRemaining = &days
+			report.Limiting = metric
+			report.Confidence = t.Confidence
+		}
+	}
+	if len(report.Metrics) == 0 {
+		return nil
+	}
+	return report
+}
+
+// point 一个时间点的指标值
+type point struct {
+	t time.Time
+	v float64
+}
+
+// series 取出指标的时间序列，按时间排序，当前数据比最后一条记录新时追加在末尾
+func series(records []smart.HistoryRecord, current *smart.SMARTData, metric string) []point {
+	var points []point
+	for i := range records {
+		if v, ok := recordValue(&records[i], metric); ok {
+			points = append(points, point{records[i].Timestamp, v})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].t.Before(points[j].t)
+	})
+
+	if current != nil {
+		if v, ok := dataValue(current, metric); ok {
+			if len(points) == 0 || current.Timestamp.After(points[len(points)-1].t) {
+				points = append(points, point{current.Timestamp, v})
+			}
+		}
+	}
+	return points
+}
+
+// recordValue 历史记录中的指标值
+func recordValue(r *smart.HistoryRecord, metric string) (float64, bool) {
+	switch metric {
+	case MetricReallocated:
+		return float64(r.ReallocatedSectors), true
+	case MetricPending:
+		return float64(r.PendingSectors), true
+	case MetricUncorrectable:
+		return float64(r.UncorrectableErrors), true
+	case MetricNVMeWear:
+		if r.NVMe == nil {
+			return 0, false
+		}
+		return float64(r.NVMe.PercentageUsed), true
+	}
+	return 0, false
+}
+
+// dataValue 快照中的指标值
+func dataValue(d *smart.SMARTData, metric string) (float64, bool) {
+	switch metric {
+	case MetricReallocated:
+		return float64(d.ReallocatedSectors), true
+	case MetricPending:
+		return float64(d.PendingSectors), true
+	case MetricUncorrectable:
+		return float64(d.UncorrectableErrors), true
+	case MetricNVMeWear:
+		if d.NVMe == nil {
+			return 0, false
+		}
+		return float64(d.NVMe.PercentageUsed), true
+	}
+	return 0, false
+}
+
+// analyzeMetric 按当前值和拟合的增长率预测达到阈值的天数，已达到阈值时为 0，置信度为 1
+func analyzeMetric(points []point, threshold float64) smart.MetricTrend {
+	current := points[len(points)-1].v
+	slope, confidence := fit(points)
+	t := smart.MetricTrend{
+		Current:    current,
+		Threshold:  threshold,
+		Confidence: round(confidence, 2),
+		Samples:    len(points),
+	}
+	if slope > 0 {
+		t.RatePerDay = round(slope, 3)
+	}
+
+	switch {
+	case current >= threshold:
+		zero := 0.0
+		t.DaysRemaining = &zero
+		t.Confidence = 1
+	case slope > 0:
+		days := round((threshold-current)/slope, 1)
+		t.DaysRemaining = &days
+	}
+	return t
+}
+
+// fit 最小二乘拟合每天的增长量
+//
+// 计数只会因为重映射等原因偶尔下降，调用方把负增长按 0 处理。置信度为拟合优度 R²
+// 乘以样本数和历史跨度的充分程度，样本少或历史短时即使拟合得很好置信度也低。
+func fit(points []point) (slope, confidence float64) {
+	if len(points) < 3 {
+		return 0, 0
+	}
+	start := points[0].t
+	span := points[len(points)-1].t.Sub(start)
+	if span <= 0 {
+		return 0, 0
+	}
+
+	var sumX, sumY float64
+	for _, p := range points {
+		sumX += p.t.Sub(start).Hours() / 24
+		sumY += p.v
+	}
+	n := float64(len(points))
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, sxy, syy float64
+	for _, p := range points {
+		dx := p.t.Sub(start).Hours()/24 - meanX
+		dy := p.v - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, 0
+	}
+	slope = sxy / sxx
+
+	// 值没有变化时拟合是确定的
+	r2 := 1.0
+	if syy > 0 {
+		r2 = sxy * sxy / (sxx * syy)
+	}
+	confidence = r2 * math.Min(1, (n-2)/(fullSamples-2)) * math.Min(1, float64(span)/float64(fullSpan))
+	return slope, confidence
+}
+
+// round 保留 n 位小数
+func round(v float64, n int) float64 {
+	p := math.Pow(10, float64(n))
+	return math.Round(v*p) / p
+}
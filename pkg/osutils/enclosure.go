@@ -0,0 +1,43 @@
+package osutils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// EnclosureID 返回设备所在硬盘柜/控制器的标识，同一标识下的硬盘共享总线带宽
+//
+// Linux 下取 /sys/block/<dev> 指向的 sysfs 路径中 SCSI hostN 之前的部分
+// （多盘位 USB 硬盘柜的各个 LUN 位于同一个 host 下），NVMe 取到控制器为止；
+// 其他系统或无法解析时返回设备名本身，即每块硬盘视为独立的硬盘柜。
+func EnclosureID(deviceName string) string {
+	if runtime.GOOS == "linux" {
+		if id := linuxEnclosureID(deviceName); id != "" {
+			return id
+		}
+	}
+	return deviceName
+}
+
+// linuxEnclosureID 解析 sysfs 中的设备路径
+func linuxEnclosureID(deviceName string) string {
+	base := filepath.Base(deviceName)
+	target, err := os.Readlink(filepath.Join("/sys/block", base))
+	if err != nil {
+		return ""
+	}
+
+	parts := strings.Split(target, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "host") || (part == "nvme" && i+1 < len(parts)) {
+			end := i + 1
+			if part == "nvme" {
+				end = i + 2
+			}
+			return strings.TrimLeft(strings.Join(parts[:end], "/"), "./")
+		}
+	}
+	return ""
+}
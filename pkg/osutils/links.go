@@ -0,0 +1,50 @@
+package osutils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// DiskByID 返回 /dev/disk/by-id 中指向该设备的链接名（不含分区），仅 Linux 支持
+func DiskByID(deviceName string) []string {
+	return diskLinks("/dev/disk/by-id", deviceName)
+}
+
+// DiskByPath 返回 /dev/disk/by-path 中指向该设备的第一个链接名（按控制器端口区分），仅 Linux 支持
+func DiskByPath(deviceName string) string {
+	links := diskLinks("/dev/disk/by-path", deviceName)
+	if len(links) == 0 {
+		return ""
+	}
+	return links[0]
+}
+
+// diskLinks 列出 dir 中解析后指向 deviceName 的符号链接
+func diskLinks(dir, deviceName string) []string {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	target, err := filepath.EvalSymlinks(deviceName)
+	if err != nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	for _, entry := range entries {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(dir, entry.Name()))
+		if err != nil || resolved != target {
+			continue
+		}
+		links = append(links, entry.Name())
+	}
+	sort.Strings(links)
+	return links
+}
@@ -31,7 +31,7 @@ fi
 # 编译（如果需要）
 if [ ! -f "./smart-cat" ]; then
     echo "📦 正在编译..."
-    go build -o smart-cat
+    go build -o smart-cat ./cmd/server
     echo "✅ 编译完成"
     echo ""
 fi
@@ -39,8 +39,8 @@ fi
 # 启动服务器
 echo "🚀 启动服务器..."
 echo ""
-echo "访问地址: http://localhost:8080"
+echo "访问地址: http://localhost:10044（可用 -addr 或 SMARTCAT_ADDR 修改）"
 echo "按 Ctrl+C 停止服务器"
 echo ""
 
-./smart-cat
+./smart-cat "$@"
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -22,6 +25,21 @@ type HistoryRecord struct {
 	HealthPercent       int       `json:"health_percent"`
 }
 
+// historyColumns 新建文件时写入的列
+//
+// 读写都按文件头部的列名对应，不依赖列的位置：新版本的文件开头有版本行（#schema=N），
+// 列更多、顺序也可能不同，不认识的列读取时忽略，追加时留空。
+var historyColumns = []string{
+	"timestamp",
+	"temperature",
+	"power_on_hours",
+	"power_cycle_count",
+	"reallocated_sectors",
+	"pending_sectors",
+	"uncorrectable_errors",
+	"health_percent",
+}
+
 // Storage CSV 存储层
 type Storage struct {
 	dataDir string
@@ -50,10 +68,14 @@ func (s *Storage) SaveRecord(serial string, data *SMARTData) error {
 
 	filename := filepath.Join(s.dataDir, fmt.Sprintf("%s.csv", serial))
 
-	// 检查文件是否存在，不存在则创建并写入头部
-	needHeader := false
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		needHeader = true
+	// 已有文件按它的头部写入，不存在（或为空）时创建并写入头部
+	header, err := readHeader(filename)
+	if err != nil {
+		return err
+	}
+	needHeader := header == nil
+	if needHeader {
+		header = historyColumns
 	}
 
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -63,49 +85,126 @@ func (s *Storage) SaveRecord(serial string, data *SMARTData) error {
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
-	defer writer.Flush()
 
-	// 写入头部
 	if needHeader {
-		header := []string{
-			"timestamp",
-			"temperature",
-			"power_on_hours",
-			"power_cycle_count",
-			"reallocated_sectors",
-			"pending_sectors",
-			"uncorrectable_errors",
-			"health_percent",
-		}
 		if err := writer.Write(header); err != nil {
 			return fmt.Errorf("write header: %w", err)
 		}
 	}
 
 	// 写入数据行
-	record := []string{
-		time.Now().Format(time.RFC3339),
-		strconv.Itoa(data.Temperature),
-		strconv.FormatInt(data.PowerOnHours, 10),
-		strconv.FormatInt(data.PowerCycleCount, 10),
-		strconv.FormatInt(data.ReallocatedSectors, 10),
-		strconv.FormatInt(data.PendingSectors, 10),
-		strconv.FormatInt(data.UncorrectableErrors, 10),
-		strconv.Itoa(data.HealthPercent),
-	}
+	record := formatRecord(HistoryRecord{
+		Timestamp:           time.Now(),
+		Temperature:         data.Temperature,
+		PowerOnHours:        data.PowerOnHours,
+		PowerCycleCount:     data.PowerCycleCount,
+		ReallocatedSectors:  data.ReallocatedSectors,
+		PendingSectors:      data.PendingSectors,
+		UncorrectableErrors: data.UncorrectableErrors,
+		HealthPercent:       data.HealthPercent,
+	}, header)
 
 	if err := writer.Write(record); err != nil {
 		return fmt.Errorf("write record: %w", err)
 	}
 
-	return nil
+	writer.Flush()
+	return writer.Error()
+}
+
+// readHeader 读取文件头部，文件不存在或为空时返回 nil
+func readHeader(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	reader := newReader(file)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	return header, nil
+}
+
+// newReader 创建 CSV 读取器：跳过版本行，允许行长度不一致
+func newReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// formatRecord 按头部的列名格式化一条记录，不认识的列留空
+func formatRecord(rec HistoryRecord, header []string) []string {
+	values := map[string]string{
+		"timestamp":            rec.Timestamp.Format(time.RFC3339),
+		"temperature":          strconv.Itoa(rec.Temperature),
+		"power_on_hours":       strconv.FormatInt(rec.PowerOnHours, 10),
+		"power_cycle_count":    strconv.FormatInt(rec.PowerCycleCount, 10),
+		"reallocated_sectors":  strconv.FormatInt(rec.ReallocatedSectors, 10),
+		"pending_sectors":      strconv.FormatInt(rec.PendingSectors, 10),
+		"uncorrectable_errors": strconv.FormatInt(rec.UncorrectableErrors, 10),
+		"health_percent":       strconv.Itoa(rec.HealthPercent),
+	}
+
+	row := make([]string, len(header))
+	for i, name := range header {
+		row[i] = values[name]
+	}
+	return row
+}
+
+// parseRecord 按头部的列名解析一行，时间无效时返回 false
+func parseRecord(row, header []string) (HistoryRecord, bool) {
+	values := make(map[string]string, len(header))
+	for i, name := range header {
+		if i < len(row) {
+			values[name] = row[i]
+		}
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, values["timestamp"])
+	if err != nil {
+		return HistoryRecord{}, false
+	}
+
+	temp, _ := strconv.Atoi(values["temperature"])
+	powerOnHours, _ := strconv.ParseInt(values["power_on_hours"], 10, 64)
+	powerCycleCount, _ := strconv.ParseInt(values["power_cycle_count"], 10, 64)
+	reallocated, _ := strconv.ParseInt(values["reallocated_sectors"], 10, 64)
+	pending, _ := strconv.ParseInt(values["pending_sectors"], 10, 64)
+	uncorrectable, _ := strconv.ParseInt(values["uncorrectable_errors"], 10, 64)
+	health, _ := strconv.Atoi(values["health_percent"])
+
+	return HistoryRecord{
+		Timestamp:           timestamp,
+		Temperature:         temp,
+		PowerOnHours:        powerOnHours,
+		PowerCycleCount:     powerCycleCount,
+		ReallocatedSectors:  reallocated,
+		PendingSectors:      pending,
+		UncorrectableErrors: uncorrectable,
+		HealthPercent:       health,
+	}, true
 }
 
 // GetHistory 获取历史记录
 func (s *Storage) GetHistory(serial string, from, to time.Time) ([]HistoryRecord, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.history(serial, from, to)
+}
 
+// history 读取历史记录，调用方持有锁
+func (s *Storage) history(serial string, from, to time.Time) ([]HistoryRecord, error) {
 	if serial == "" {
 		serial = "unknown"
 	}
@@ -121,10 +220,10 @@ func (s *Storage) GetHistory(serial string, from, to time.Time) ([]HistoryRecord
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
+	reader := newReader(file)
 
-	// 跳过头部
-	if _, err := reader.Read(); err != nil {
+	header, err := reader.Read()
+	if err != nil {
 		return nil, fmt.Errorf("read header: %w", err)
 	}
 
@@ -132,45 +231,32 @@ func (s *Storage) GetHistory(serial string, from, to time.Time) ([]HistoryRecord
 
 	for {
 		row, err := reader.Read()
-		if err != nil {
+		if err == io.EOF {
 			break
 		}
-
-		if len(row) < 8 {
-			continue
+		if err != nil {
+			// 无法解析的行跳过，不影响后面的记录
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			return nil, fmt.Errorf("read %s: %w", filename, err)
 		}
 
-		timestamp, err := time.Parse(time.RFC3339, row[0])
-		if err != nil {
+		rec, ok := parseRecord(row, header)
+		if !ok {
 			continue
 		}
 
 		// 时间过滤
-		if !from.IsZero() && timestamp.Before(from) {
+		if !from.IsZero() && rec.Timestamp.Before(from) {
 			continue
 		}
-		if !to.IsZero() && timestamp.After(to) {
+		if !to.IsZero() && rec.Timestamp.After(to) {
 			continue
 		}
 
-		temp, _ := strconv.Atoi(row[1])
-		powerOnHours, _ := strconv.ParseInt(row[2], 10, 64)
-		powerCycleCount, _ := strconv.ParseInt(row[3], 10, 64)
-		reallocated, _ := strconv.ParseInt(row[4], 10, 64)
-		pending, _ := strconv.ParseInt(row[5], 10, 64)
-		uncorrectable, _ := strconv.ParseInt(row[6], 10, 64)
-		health, _ := strconv.Atoi(row[7])
-
-		records = append(records, HistoryRecord{
-			Timestamp:           timestamp,
-			Temperature:         temp,
-			PowerOnHours:        powerOnHours,
-			PowerCycleCount:     powerCycleCount,
-			ReallocatedSectors:  reallocated,
-			PendingSectors:      pending,
-			UncorrectableErrors: uncorrectable,
-			HealthPercent:       health,
-		})
+		records = append(records, rec)
 	}
 
 	return records, nil
@@ -180,7 +266,11 @@ func (s *Storage) GetHistory(serial string, from, to time.Time) ([]HistoryRecord
 func (s *Storage) GetAllSerials() ([]string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.serials()
+}
 
+// serials 列出已记录的设备序列号，调用方持有锁
+func (s *Storage) serials() ([]string, error) {
 	entries, err := os.ReadDir(s.dataDir)
 	if err != nil {
 		return nil, fmt.Errorf("read dir: %w", err)
@@ -201,14 +291,16 @@ func (s *Storage) GetAllSerials() ([]string, error) {
 	return serials, nil
 }
 
-// CleanOldRecords 清理旧记录（保留最近30天）
+// CleanOldRecords 清理 days 天之前的记录
+//
+// 读取和重写之间一直持有锁，期间保存的记录不会被重写覆盖。
 func (s *Storage) CleanOldRecords(days int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	cutoff := time.Now().AddDate(0, 0, -days)
 
-	serials, err := s.GetAllSerials()
+	serials, err := s.serials()
 	if err != nil {
 		return err
 	}
@@ -216,13 +308,8 @@ func (s *Storage) CleanOldRecords(days int) error {
 	for _, serial := range serials {
 		filename := filepath.Join(s.dataDir, fmt.Sprintf("%s.csv", serial))
 
-		records, err := s.GetHistory(serial, cutoff, time.Time{})
-		if err != nil {
-			continue
-		}
-
 		// 重写文件，只保留新记录
-		if err := s.rewriteFile(filename, records); err != nil {
+		if err := s.rewriteFile(filename, cutoff); err != nil {
 			return err
 		}
 	}
@@ -230,48 +317,77 @@ func (s *Storage) CleanOldRecords(days int) error {
 	return nil
 }
 
-// rewriteFile 重写文件
-func (s *Storage) rewriteFile(filename string, records []HistoryRecord) error {
-	file, err := os.Create(filename)
+// rewriteFile 重写文件，只保留 cutoff 之后的记录
+//
+// 版本行、头部和保留的行原样写回，文件的格式和列不变；写入中断留下的半行和无法解析的行丢弃。
+// 先写临时文件再重命名，中途失败时原文件不受影响。
+func (s *Storage) rewriteFile(filename string, cutoff time.Time) error {
+	content, err := os.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("create file: %w", err)
+		return fmt.Errorf("read file: %w", err)
+	}
+	if n := len(content); n > 0 && content[n-1] != '\n' {
+		content = content[:bytes.LastIndexByte(content, '\n')+1]
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// 写入头部
-	header := []string{
-		"timestamp",
-		"temperature",
-		"power_on_hours",
-		"power_cycle_count",
-		"reallocated_sectors",
-		"pending_sectors",
-		"uncorrectable_errors",
-		"health_percent",
+	reader := newReader(bytes.NewReader(content))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
 	}
-	if err := writer.Write(header); err != nil {
-		return err
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
 	}
 
-	// 写入记录
-	for _, rec := range records {
-		row := []string{
-			rec.Timestamp.Format(time.RFC3339),
-			strconv.Itoa(rec.Temperature),
-			strconv.FormatInt(rec.PowerOnHours, 10),
-			strconv.FormatInt(rec.PowerCycleCount, 10),
-			strconv.FormatInt(rec.ReallocatedSectors, 10),
-			strconv.FormatInt(rec.PendingSectors, 10),
-			strconv.FormatInt(rec.UncorrectableErrors, 10),
-			strconv.Itoa(rec.HealthPercent),
+	var buf bytes.Buffer
+	if line, _, _ := bytes.Cut(content, []byte("\n")); bytes.HasPrefix(line, []byte("#")) {
+		buf.Write(bytes.TrimSpace(line))
+		buf.WriteByte('\n')
+	}
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		rec, ok := parseRecord(row, header)
+		if !ok || rec.Timestamp.Before(cutoff) {
+			continue
 		}
 		if err := writer.Write(row); err != nil {
-			return err
+			return fmt.Errorf("write record: %w", err)
 		}
 	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("write record: %w", err)
+	}
 
+	tmp := filename + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	_, err = file.Write(buf.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
 	return nil
 }